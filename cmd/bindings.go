@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/sergey121/nes-emulator/internal/config"
+	"github.com/sergey121/nes-emulator/internal/input"
+)
+
+// gamepadButtonNames maps config names to buttons of the standard gamepad layout
+// (Xbox style names: A is the bottom face button, B the right one)
+var gamepadButtonNames = map[string]ebiten.StandardGamepadButton{
+	"A":         ebiten.StandardGamepadButtonRightBottom,
+	"B":         ebiten.StandardGamepadButtonRightRight,
+	"X":         ebiten.StandardGamepadButtonRightLeft,
+	"Y":         ebiten.StandardGamepadButtonRightTop,
+	"LB":        ebiten.StandardGamepadButtonFrontTopLeft,
+	"RB":        ebiten.StandardGamepadButtonFrontTopRight,
+	"LT":        ebiten.StandardGamepadButtonFrontBottomLeft,
+	"RT":        ebiten.StandardGamepadButtonFrontBottomRight,
+	"Back":      ebiten.StandardGamepadButtonCenterLeft,
+	"Start":     ebiten.StandardGamepadButtonCenterRight,
+	"LS":        ebiten.StandardGamepadButtonLeftStick,
+	"RS":        ebiten.StandardGamepadButtonRightStick,
+	"DPadUp":    ebiten.StandardGamepadButtonLeftTop,
+	"DPadDown":  ebiten.StandardGamepadButtonLeftBottom,
+	"DPadLeft":  ebiten.StandardGamepadButtonLeftLeft,
+	"DPadRight": ebiten.StandardGamepadButtonLeftRight,
+	"Guide":     ebiten.StandardGamepadButtonCenterCenter,
+}
+
+func gamepadButtonName(button ebiten.StandardGamepadButton) string {
+	for name, b := range gamepadButtonNames {
+		if b == button {
+			return name
+		}
+	}
+	return ""
+}
+
+// keyBinding is a keyboard key, unbound if ok is false
+type keyBinding struct {
+	key ebiten.Key
+	ok  bool
+}
+
+// padBinding is a standard layout gamepad button, unbound if ok is false
+type padBinding struct {
+	button ebiten.StandardGamepadButton
+	ok     bool
+}
+
+// playerBindings is the resolved form of config.Player
+type playerBindings struct {
+	keys     [10]keyBinding // Indexed like config.ButtonNames
+	pad      [10]padBinding
+	gamepad  int // Index in connection order, -1 if disabled
+	analog   bool
+	deadzone float64
+}
+
+// bindings holds all inputs resolved from the config file
+type bindings struct {
+	players [4]playerBindings
+	mat     [12]keyBinding
+	hotkeys struct {
+		reset, pause, saveState, loadState, nextSlot  keyBinding
+		fastForward, screenshot, bindings             keyBinding
+		nextPalette, nextFilter, nextScaler           keyBinding
+		fullscreen, debugView, debugPalette, debugger keyBinding
+	}
+}
+
+func parseKey(name string) (keyBinding, error) {
+	if name == "" {
+		return keyBinding{}, nil
+	}
+	var key ebiten.Key
+	if err := key.UnmarshalText([]byte(name)); err != nil {
+		return keyBinding{}, err
+	}
+	return keyBinding{key: key, ok: true}, nil
+}
+
+func parseGamepadButton(name string) (padBinding, error) {
+	if name == "" {
+		return padBinding{}, nil
+	}
+	button, ok := gamepadButtonNames[name]
+	if !ok {
+		return padBinding{}, fmt.Errorf("unknown gamepad button: %q", name)
+	}
+	return padBinding{button: button, ok: true}, nil
+}
+
+// resolveBindings converts the names in the config file to ebiten inputs
+func resolveBindings(cfg *config.Config) (*bindings, error) {
+	b := &bindings{}
+
+	for i := range cfg.Players {
+		player := &cfg.Players[i]
+		keys := player.Keyboard.Fields()
+		buttons := player.Gamepad.Buttons.Fields()
+		for n := range keys {
+			var err error
+			if b.players[i].keys[n], err = parseKey(*keys[n]); err != nil {
+				return nil, fmt.Errorf("player %d %s: %w", i+1, config.ButtonNames[n], err)
+			}
+			if b.players[i].pad[n], err = parseGamepadButton(*buttons[n]); err != nil {
+				return nil, fmt.Errorf("player %d %s: %w", i+1, config.ButtonNames[n], err)
+			}
+		}
+		b.players[i].gamepad = player.Gamepad.Index
+		b.players[i].analog = player.Gamepad.AnalogStick
+		b.players[i].deadzone = player.Gamepad.Deadzone
+	}
+
+	for n, name := range cfg.Mat {
+		var err error
+		if b.mat[n], err = parseKey(name); err != nil {
+			return nil, fmt.Errorf("mat button %d: %w", n+1, err)
+		}
+	}
+
+	hk := &cfg.Hotkeys
+	for _, h := range []struct {
+		name string
+		dst  *keyBinding
+	}{
+		{hk.Reset, &b.hotkeys.reset},
+		{hk.Pause, &b.hotkeys.pause},
+		{hk.SaveState, &b.hotkeys.saveState},
+		{hk.LoadState, &b.hotkeys.loadState},
+		{hk.NextSlot, &b.hotkeys.nextSlot},
+		{hk.FastForward, &b.hotkeys.fastForward},
+		{hk.Screenshot, &b.hotkeys.screenshot},
+		{hk.Bindings, &b.hotkeys.bindings},
+		{hk.NextPalette, &b.hotkeys.nextPalette},
+		{hk.NextFilter, &b.hotkeys.nextFilter},
+		{hk.NextScaler, &b.hotkeys.nextScaler},
+		{hk.Fullscreen, &b.hotkeys.fullscreen},
+		{hk.DebugView, &b.hotkeys.debugView},
+		{hk.DebugPalette, &b.hotkeys.debugPalette},
+		{hk.Debugger, &b.hotkeys.debugger},
+	} {
+		var err error
+		if *h.dst, err = parseKey(h.name); err != nil {
+			return nil, fmt.Errorf("hotkey: %w", err)
+		}
+	}
+
+	return b, nil
+}
+
+// applyControllerSettings passes the turbo rate and direction filter to the joypads
+func applyControllerSettings(cfg *config.Config, players [4]*input.Controller) {
+	for i, c := range players {
+		c.SetTurboRate(cfg.Players[i].Turbo.On, cfg.Players[i].Turbo.Off)
+		if cfg.Players[i].AllowOpposite {
+			c.SetDirectionFilter(input.AllowOpposite)
+		} else {
+			c.SetDirectionFilter(input.BlockOpposite)
+		}
+	}
+}
+
+func (k keyBinding) pressed() bool {
+	return k.ok && ebiten.IsKeyPressed(k.key)
+}
+
+// connectedGamepads returns the IDs of standard layout gamepads in connection order
+func connectedGamepads() []ebiten.GamepadID {
+	var ids []ebiten.GamepadID
+	for _, id := range ebiten.AppendGamepadIDs(nil) {
+		if ebiten.IsStandardGamepadLayoutAvailable(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// buttons returns the held and autofire buttons from the player's gamepad,
+// and from the keyboard unless keys is false
+func (p *playerBindings) buttons(gamepads []ebiten.GamepadID, keys bool) (held, turbo byte) {
+	var pressed uint16
+	for n, k := range p.keys {
+		if keys && k.pressed() {
+			pressed |= 1 << n
+		}
+	}
+
+	var id ebiten.GamepadID
+	connected := p.gamepad >= 0 && p.gamepad < len(gamepads)
+	if connected {
+		id = gamepads[p.gamepad]
+		for n, b := range p.pad {
+			if b.ok && ebiten.IsStandardGamepadButtonPressed(id, b.button) {
+				pressed |= 1 << n
+			}
+		}
+	}
+
+	// Bits 8 and 9 are Turbo A and Turbo B
+	held = byte(pressed)
+	turbo = byte(pressed>>8) & (input.ButtonA | input.ButtonB)
+	if !connected {
+		return held, turbo
+	}
+
+	if p.analog {
+		x := ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickHorizontal)
+		y := ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickVertical)
+		if x < -p.deadzone {
+			held |= input.ButtonLeft
+		}
+		if x > p.deadzone {
+			held |= input.ButtonRight
+		}
+		if y < -p.deadzone {
+			held |= input.ButtonUp
+		}
+		if y > p.deadzone {
+			held |= input.ButtonDown
+		}
+	}
+	return held, turbo
+}
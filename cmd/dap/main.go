@@ -0,0 +1,18 @@
+// Command dap is a Debug Adapter Protocol server for the emulator. Editors
+// start it and talk to it over stdin and stdout, see package dap for the
+// launch configuration.
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/sergey121/nes-emulator/internal/dap"
+)
+
+func main() {
+	// stdout carries the protocol, log messages go to stderr
+	if err := dap.Serve(os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/sergey121/nes-emulator/internal/debugger"
+)
+
+const (
+	debugLogLines  = 12 // Lines of command output kept for the overlay
+	disassemblyLen = 10 // Instructions shown from PC
+)
+
+// debugLog keeps the last lines written to it
+type debugLog struct {
+	lines   []string
+	partial string // Line without its newline yet
+}
+
+func (l *debugLog) Write(p []byte) (int, error) {
+	lines := strings.Split(l.partial+string(p), "\n")
+	l.partial = lines[len(lines)-1]
+	l.lines = append(l.lines, lines[:len(lines)-1]...)
+	if extra := len(l.lines) - debugLogLines; extra > 0 {
+		l.lines = append(l.lines[:0], l.lines[extra:]...)
+	}
+	return len(p), nil
+}
+
+// attachDebugger stops the console under the debugger. With stdin the
+// commands are also read from the terminal, and the output goes there too.
+func (g *Game) attachDebugger(stdin bool) {
+	g.debugger = debugger.New(g.console)
+	if g.debugOut == nil {
+		g.debugOut = &g.debugLog
+	}
+	if stdin {
+		g.debugOut = io.MultiWriter(os.Stdout, &g.debugLog)
+		g.debugStdin = make(chan string)
+		go func() {
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				g.debugStdin <- scanner.Text()
+			}
+		}()
+	}
+	if err := g.debugger.LoadSymbols(g.romPath); err != nil {
+		fmt.Fprintln(g.debugOut, "Symbols:", err)
+	}
+	fmt.Fprintln(g.debugOut, g.debugger.Location())
+	g.debuggerOpen = true
+}
+
+// openDebugger shows the overlay, attaching the debugger the first time.
+// A running console stops after the current instruction.
+func (g *Game) openDebugger() {
+	if g.debugger == nil {
+		g.attachDebugger(false)
+		return
+	}
+	if g.debugger.Running() {
+		g.debugger.Interrupt()
+	}
+	g.debuggerOpen = true
+}
+
+// closeDebugger hides the overlay and lets the console run
+func (g *Game) closeDebugger() {
+	g.debuggerOpen = false
+	if !g.debugger.Running() {
+		g.debugger.Continue()
+	}
+}
+
+// debugCommand runs a line of the command line, an empty line repeats the last one
+func (g *Game) debugCommand(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		line = g.debugLast
+	}
+	g.debugLast = line
+	fmt.Fprintln(g.debugOut, "(nes) "+line)
+
+	switch err := g.debugger.Exec(line, g.debugOut); err {
+	case nil:
+	case debugger.ErrQuit:
+		// The console runs without the debugger until it is opened again
+		g.debugger.Detach()
+		g.debugger = nil
+		g.debuggerOpen = false
+	default:
+		fmt.Fprintln(g.debugOut, "Error:", err)
+	}
+}
+
+// updateDebugger runs the commands typed into the overlay or the terminal
+func (g *Game) updateDebugger() {
+	for pending := true; pending && g.debugger != nil; {
+		select {
+		case line := <-g.debugStdin:
+			g.debugCommand(line)
+		default:
+			pending = false
+		}
+	}
+	if !g.debuggerOpen {
+		return
+	}
+	if g.bindings.hotkeys.debugger.justPressed() {
+		g.closeDebugger()
+		return
+	}
+
+	g.debugChars = ebiten.AppendInputChars(g.debugChars[:0])
+	g.debugInput += string(g.debugChars)
+	if inpututil.IsKeyJustPressed(ebiten.KeyBackspace) && g.debugInput != "" {
+		runes := []rune(g.debugInput)
+		g.debugInput = string(runes[:len(runes)-1])
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		line := g.debugInput
+		g.debugInput = ""
+		g.debugCommand(line)
+	}
+}
+
+// runDebugger emulates a frame under the debugger and opens the overlay when it stops
+func (g *Game) runDebugger() {
+	if stop := g.debugger.RunFrame(); stop != nil {
+		g.debugger.PrintStop(g.debugOut, stop)
+		g.debuggerOpen = true
+	}
+}
+
+// drawDebugger draws the registers, code, breakpoints and command line
+func (g *Game) drawDebugger(screen *ebiten.Image) {
+	w, h := g.screenSize()
+	ebitenutil.DrawRect(screen, 0, 0, float64(w), float64(h), overlayColor)
+	d := g.debugger
+
+	lines := []string{d.Registers()}
+	switch stop := d.LastStop(); {
+	case d.Running():
+		lines = append(lines, "Running")
+	case stop != nil:
+		lines = append(lines, "Stopped: "+stop.String())
+	}
+	lines = append(lines, "")
+	for i, line := range d.Disassembly(g.cpu.PC, disassemblyLen) {
+		marker := "  "
+		if i == 0 {
+			marker = "> "
+		}
+		lines = append(lines, marker+line)
+	}
+	lines = append(lines, "")
+	for _, bp := range d.Breakpoints() {
+		lines = append(lines, bp.String())
+	}
+	for y, line := range lines {
+		ebitenutil.DebugPrintAt(screen, line, 4, 4+y*debugLineHeight)
+	}
+
+	// Output at the bottom, above the command line
+	prompt := h - debugLineHeight - 4
+	for i, line := range g.debugLog.lines {
+		y := prompt - (len(g.debugLog.lines)-i)*debugLineHeight
+		ebitenutil.DebugPrintAt(screen, line, 4, y)
+	}
+	ebitenutil.DebugPrintAt(screen, "(nes) "+g.debugInput+"_", 4, prompt)
+}
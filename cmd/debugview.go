@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/sergey121/nes-emulator/internal/bus"
+	"github.com/sergey121/nes-emulator/internal/ppu"
+)
+
+// PPU debug views drawn over the picture. ebiten has a single window, so
+// the views replace each other instead of opening windows of their own.
+const (
+	debugOff = iota
+	debugPatterns
+	debugNametables
+	debugSprites
+	debugPalettes
+	debugEvents
+	debugViewCount
+)
+
+var debugViewNames = [debugViewCount]string{
+	debugPatterns:   "Pattern tables",
+	debugNametables: "Nametables",
+	debugSprites:    "OAM",
+	debugPalettes:   "Palette RAM",
+	debugEvents:     "Register writes",
+}
+
+const (
+	debugLineHeight = 16 // Height of a line of the debug font
+	debugCharWidth  = 6
+	debugGap        = 8  // Pixels between the two pattern tables
+	spriteListWidth = 34 // Characters per column of the OAM list
+	eventListLines  = 8  // Events listed under the cursor at most
+)
+
+// nextDebugView cycles through the debug views and back to the game.
+// Register writes are only recorded while their view is shown.
+func (g *Game) nextDebugView() {
+	g.debugView = (g.debugView + 1) % debugViewCount
+	if g.debugView == debugEvents {
+		g.bus.Events = bus.NewEventRecorder(g.ppu)
+	} else {
+		g.bus.Events = nil
+	}
+}
+
+// nextDebugPalette changes the palette the pattern tables are drawn with
+func (g *Game) nextDebugPalette() {
+	g.debugPalette = (g.debugPalette + 1) % 8
+	g.showMessage(fmt.Sprintf("Pattern palette %d", g.debugPalette))
+}
+
+// patternTables draws both pattern tables side by side
+func (g *Game) patternTables() *image.RGBA {
+	const size = ppu.PatternTableSize
+	img := image.NewRGBA(image.Rect(0, 0, 2*size+debugGap, size))
+	for table := 0; table < 2; table++ {
+		r := image.Rect(table*(size+debugGap), 0, table*(size+debugGap)+size, size)
+		draw.Draw(img, r, g.ppu.PatternTable(table, g.debugPalette), image.Point{}, draw.Src)
+	}
+	return img
+}
+
+// debugImage renders the current debug view
+func (g *Game) debugImage() *image.RGBA {
+	switch g.debugView {
+	case debugPatterns:
+		return g.patternTables()
+	case debugNametables:
+		return g.ppu.Nametables()
+	case debugSprites:
+		return g.ppu.SpriteTiles()
+	case debugEvents:
+		return bus.EventImage(g.bus.Events.LastFrame(), g.ppu.Timing())
+	default:
+		return g.ppu.PaletteRAM()
+	}
+}
+
+// drawDebugView draws the current debug view over the whole window
+func (g *Game) drawDebugView(screen *ebiten.Image) {
+	w, h := g.screenSize()
+	ebitenutil.DrawRect(screen, 0, 0, float64(w), float64(h), overlayColor)
+
+	title := debugViewNames[g.debugView]
+	if g.debugView == debugPatterns {
+		title += fmt.Sprintf(", palette %d", g.debugPalette)
+	}
+	ebitenutil.DebugPrintAt(screen, title, 4, 0)
+
+	img := g.debugImage()
+	if g.debugImageBuffer == nil || g.debugImageBuffer.Bounds() != img.Rect {
+		if g.debugImageBuffer != nil {
+			g.debugImageBuffer.Deallocate()
+		}
+		g.debugImageBuffer = ebiten.NewImage(img.Rect.Dx(), img.Rect.Dy())
+	}
+	g.debugImageBuffer.WritePixels(img.Pix)
+
+	// The OAM list takes the right two thirds
+	areaW, areaH := w, h-debugLineHeight
+	if g.debugView == debugSprites {
+		areaW = w / 3
+	}
+	scale := math.Min(float64(areaW)/float64(img.Rect.Dx()), float64(areaH)/float64(img.Rect.Dy()))
+	if scale >= 1 {
+		scale = math.Floor(scale) // Whole pixels while they fit
+	}
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(scale, scale)
+	op.GeoM.Translate(0, debugLineHeight)
+	screen.DrawImage(g.debugImageBuffer, op)
+
+	switch g.debugView {
+	case debugSprites:
+		g.drawSpriteList(screen, int(float64(img.Rect.Dx())*scale)+debugGap, areaH)
+	case debugEvents:
+		g.drawEventList(screen, scale, debugLineHeight+int(float64(img.Rect.Dy())*scale))
+	}
+}
+
+// drawSpriteList prints the OAM entries in as many columns as the height needs
+func (g *Game) drawSpriteList(screen *ebiten.Image, x, height int) {
+	perColumn := max(1, height/debugLineHeight)
+	for i, s := range g.ppu.Sprites() {
+		line := fmt.Sprintf("%02d %v", i, s)
+		col, row := i/perColumn, i%perColumn
+		ebitenutil.DebugPrintAt(screen, line, x+col*spriteListWidth*debugCharWidth, debugLineHeight+row*debugLineHeight)
+	}
+}
+
+// drawEventList prints below the event grid the register writes of the
+// last frame near the mouse cursor
+func (g *Game) drawEventList(screen *ebiten.Image, scale float64, y int) {
+	events := g.bus.Events.LastFrame()
+	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%d writes, point at a dot for details", len(events)), 4, y)
+
+	x, cy := ebiten.CursorPosition()
+	dot := int(float64(x) / scale)
+	line := int(float64(cy-debugLineHeight) / scale)
+	n := 0
+	for _, e := range events {
+		if abs(e.Cycle-dot) > 2 || abs(e.Scanline-line) > 2 {
+			continue
+		}
+		n++
+		if n > eventListLines {
+			break
+		}
+		ebitenutil.DebugPrintAt(screen, e.String(), 4, y+n*debugLineHeight)
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/sergey121/nes-emulator/internal/input"
+	"github.com/sergey121/nes-emulator/internal/rom"
+)
+
+// buttonMat is a Power Pad or a Family Trainer
+type buttonMat interface {
+	SetButtons(buttons uint16)
+}
+
+// attachInputDevices plugs the selected devices into the controller ports
+// and the expansion port. Ports without an explicit selection use the
+// NES 2.0 default expansion device, falling back to two joypads.
+func (g *Game) attachInputDevices(cartridge *rom.Cartridge, opts inputOptions) error {
+	port1, port2, expansion, _ := input.DefaultDevices(cartridge.ExpansionDevice)
+
+	g.matSideA = input.DefaultMatSideA(cartridge.ExpansionDevice)
+	switch opts.matSide {
+	case "":
+	case "a", "A":
+		g.matSideA = true
+	case "b", "B":
+		g.matSideA = false
+	default:
+		return fmt.Errorf("unknown mat side %q, expected a or b", opts.matSide)
+	}
+
+	for _, sel := range []struct {
+		name      string
+		device    *input.DeviceType
+		expansion bool // The selection is for the expansion port
+	}{
+		{opts.port1, &port1, false},
+		{opts.port2, &port2, false},
+		{opts.expansion, &expansion, true},
+	} {
+		if sel.name == "" {
+			continue
+		}
+		d, err := input.ParseDeviceType(sel.name)
+		if err != nil {
+			return err
+		}
+		if d != input.DeviceNone && d.IsExpansion() != sel.expansion {
+			if sel.expansion {
+				return fmt.Errorf("%s plugs into a controller port, not the expansion port", d)
+			}
+			return fmt.Errorf("%s plugs into the expansion port, not a controller port", d)
+		}
+		*sel.device = d
+	}
+
+	var err error
+	if g.bus.Port1, err = g.portDevice(1, port1); err != nil {
+		return err
+	}
+	if g.bus.Port2, err = g.portDevice(2, port2); err != nil {
+		return err
+	}
+	g.bus.Expansion, err = g.expansionDevice(expansion)
+	return err
+}
+
+// portDevice creates the device for controller port 1 or 2
+func (g *Game) portDevice(port int, d input.DeviceType) (input.InputDevice, error) {
+	switch d {
+	case input.DeviceNone:
+		return nil, nil
+	case input.DeviceJoypad:
+		return g.players[port-1], nil
+	case input.DeviceFourScore:
+		// Port 1 reports players 1 and 3, port 2 reports players 2 and 4
+		return input.NewFourScore(port, g.players[port-1], g.players[port+1]), nil
+	case input.DeviceZapper:
+		// Both Zappers (if two are attached) follow the same mouse
+		if g.zapper == nil {
+			g.zapper = input.NewZapper(g.ppu)
+			ebiten.SetCursorShape(ebiten.CursorShapeCrosshair)
+		}
+		return g.zapper, nil
+	case input.DeviceVaus:
+		g.vaus = input.NewVaus()
+		return g.vaus, nil
+	case input.DevicePowerPad:
+		pad := input.NewPowerPad()
+		g.mat = pad
+		return pad, nil
+	}
+	return nil, fmt.Errorf("%s can not be plugged into controller port %d", d, port)
+}
+
+// expansionDevice creates the device for the Famicom expansion port
+func (g *Game) expansionDevice(d input.DeviceType) (input.ExpansionDevice, error) {
+	switch d {
+	case input.DeviceNone:
+		return nil, nil
+	case input.DeviceHori:
+		return input.NewHoriAdapter(g.players[0], g.players[1], g.players[2], g.players[3], true), nil
+	case input.DeviceFamicomPads:
+		return input.NewHoriAdapter(g.players[0], g.players[1], g.players[2], g.players[3], false), nil
+	case input.DeviceVausFamicom:
+		g.vaus = input.NewVaus()
+		return g.vaus, nil
+	case input.DeviceFamilyTrainer:
+		trainer := input.NewFamilyTrainer()
+		g.mat = trainer
+		return trainer, nil
+	case input.DeviceKeyboard:
+		g.keyboard = input.NewFamilyKeyboard()
+		g.keyboardCaptured = true
+		g.showMessage("Keyboard captured, Scroll Lock releases it")
+		return g.keyboard, nil
+	}
+	return nil, fmt.Errorf("%s can not be plugged into the expansion port", d)
+}
+
+// updateDevices feeds the host mouse and keyboard to the attached peripherals
+func (g *Game) updateDevices() {
+	x, y := g.cursorPosition()
+	left := ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft)
+	right := ebiten.IsMouseButtonPressed(ebiten.MouseButtonRight)
+
+	if g.zapper != nil {
+		// Left click pulls the trigger, right click fires away from the screen
+		g.zapper.Aim(x, y)
+		if right {
+			g.zapper.AimOffscreen()
+		}
+		g.zapper.SetTrigger(left || right)
+	}
+
+	if g.vaus != nil {
+		g.vaus.SetPosition(x)
+		g.vaus.SetButton(left)
+	}
+
+	if g.mat != nil {
+		var buttons uint16
+		for i, key := range g.bindings.mat {
+			if key.pressed() {
+				buttons |= input.PowerPadButton(i + 1)
+			}
+		}
+		if g.matSideA {
+			buttons = input.MirrorPowerPad(buttons)
+		}
+		g.mat.SetButtons(buttons)
+	}
+
+	if g.keyboard != nil {
+		for key, familyKey := range familyKeys {
+			g.keyboard.SetKey(familyKey, g.keyboardCaptured && ebiten.IsKeyPressed(key))
+		}
+	}
+}
+
+// captureKey gives the host keyboard to the Family BASIC keyboard and takes it back
+const captureKey = ebiten.KeyScrollLock
+
+// familyKeys maps host keys to the Family BASIC keyboard by position
+var familyKeys = map[ebiten.Key]input.FamilyKey{
+	ebiten.KeyA: input.FamilyKeyA, ebiten.KeyB: input.FamilyKeyB, ebiten.KeyC: input.FamilyKeyC,
+	ebiten.KeyD: input.FamilyKeyD, ebiten.KeyE: input.FamilyKeyE, ebiten.KeyF: input.FamilyKeyF,
+	ebiten.KeyG: input.FamilyKeyG, ebiten.KeyH: input.FamilyKeyH, ebiten.KeyI: input.FamilyKeyI,
+	ebiten.KeyJ: input.FamilyKeyJ, ebiten.KeyK: input.FamilyKeyK, ebiten.KeyL: input.FamilyKeyL,
+	ebiten.KeyM: input.FamilyKeyM, ebiten.KeyN: input.FamilyKeyN, ebiten.KeyO: input.FamilyKeyO,
+	ebiten.KeyP: input.FamilyKeyP, ebiten.KeyQ: input.FamilyKeyQ, ebiten.KeyR: input.FamilyKeyR,
+	ebiten.KeyS: input.FamilyKeyS, ebiten.KeyT: input.FamilyKeyT, ebiten.KeyU: input.FamilyKeyU,
+	ebiten.KeyV: input.FamilyKeyV, ebiten.KeyW: input.FamilyKeyW, ebiten.KeyX: input.FamilyKeyX,
+	ebiten.KeyY: input.FamilyKeyY, ebiten.KeyZ: input.FamilyKeyZ,
+
+	ebiten.Key0: input.FamilyKey0, ebiten.Key1: input.FamilyKey1, ebiten.Key2: input.FamilyKey2,
+	ebiten.Key3: input.FamilyKey3, ebiten.Key4: input.FamilyKey4, ebiten.Key5: input.FamilyKey5,
+	ebiten.Key6: input.FamilyKey6, ebiten.Key7: input.FamilyKey7, ebiten.Key8: input.FamilyKey8,
+	ebiten.Key9: input.FamilyKey9,
+
+	ebiten.KeyF1: input.FamilyKeyF1, ebiten.KeyF2: input.FamilyKeyF2, ebiten.KeyF3: input.FamilyKeyF3,
+	ebiten.KeyF4: input.FamilyKeyF4, ebiten.KeyF5: input.FamilyKeyF5, ebiten.KeyF6: input.FamilyKeyF6,
+	ebiten.KeyF7: input.FamilyKeyF7, ebiten.KeyF8: input.FamilyKeyF8,
+
+	ebiten.KeyMinus:        input.FamilyKeyMinus,
+	ebiten.KeyEqual:        input.FamilyKeyCaret,
+	ebiten.KeyBackslash:    input.FamilyKeyRightBracket,
+	ebiten.KeyBracketLeft:  input.FamilyKeyAt,
+	ebiten.KeyBracketRight: input.FamilyKeyLeftBracket,
+	ebiten.KeySemicolon:    input.FamilyKeySemicolon,
+	ebiten.KeyQuote:        input.FamilyKeyColon,
+	ebiten.KeyBackquote:    input.FamilyKeyYen,
+	ebiten.KeyComma:        input.FamilyKeyComma,
+	ebiten.KeyPeriod:       input.FamilyKeyPeriod,
+	ebiten.KeySlash:        input.FamilyKeySlash,
+	ebiten.KeyEnd:          input.FamilyKeyUnderscore,
+
+	ebiten.KeyEnter:        input.FamilyKeyReturn,
+	ebiten.KeySpace:        input.FamilyKeySpace,
+	ebiten.KeyEscape:       input.FamilyKeyEsc,
+	ebiten.KeyControlLeft:  input.FamilyKeyCtrl,
+	ebiten.KeyControlRight: input.FamilyKeyCtrl,
+	ebiten.KeyShiftLeft:    input.FamilyKeyLeftShift,
+	ebiten.KeyShiftRight:   input.FamilyKeyRightShift,
+	ebiten.KeyAltLeft:      input.FamilyKeyGraph,
+	ebiten.KeyAltRight:     input.FamilyKeyKana,
+	ebiten.KeyPause:        input.FamilyKeyStop,
+	ebiten.KeyHome:         input.FamilyKeyClrHome,
+	ebiten.KeyInsert:       input.FamilyKeyIns,
+	ebiten.KeyBackspace:    input.FamilyKeyDel,
+	ebiten.KeyDelete:       input.FamilyKeyDel,
+
+	ebiten.KeyUp:    input.FamilyKeyUp,
+	ebiten.KeyDown:  input.FamilyKeyDown,
+	ebiten.KeyLeft:  input.FamilyKeyLeft,
+	ebiten.KeyRight: input.FamilyKeyRight,
+}
@@ -0,0 +1,242 @@
+// Command headless runs a ROM without a window and exports the picture,
+// with the same palette, NTSC filter and scaler options as the frontend.
+//
+//	go run ./cmd/headless -rom game.nes -frames 600 -scaler xbrz4x -screenshot out.png
+//	go run ./cmd/headless -rom game.nes -frames 600 -record out.y4m
+//	go run ./cmd/headless -rom game.nes -frames 600 -debug-dir ppu
+//	go run ./cmd/headless -rom game.nes -debug
+//	go run ./cmd/headless -rom game.nes -gdb localhost:2345
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/sergey121/nes-emulator/internal/bus"
+	"github.com/sergey121/nes-emulator/internal/console"
+	"github.com/sergey121/nes-emulator/internal/debugger"
+	"github.com/sergey121/nes-emulator/internal/gdbstub"
+	"github.com/sergey121/nes-emulator/internal/ppu"
+	"github.com/sergey121/nes-emulator/internal/rom"
+	"github.com/sergey121/nes-emulator/internal/video"
+)
+
+func main() {
+	romPath := flag.String("rom", "", "path to the .nes file")
+	frames := flag.Int("frames", 60, "number of frames to run")
+	screenshot := flag.String("screenshot", "", "write the last frame to this PNG file")
+	record := flag.String("record", "", "write every frame to this YUV4MPEG2 (.y4m) file")
+	palette := flag.String("palette", "2c02", "palette preset (2c02, fceux, nestopia-yuv, sony-cxa, pvm, rgb) or .pal file")
+	ntsc := flag.String("ntsc", "", "NTSC filter preset: none, composite, svideo, rgb, mono")
+	scaler := flag.String("scaler", "", "pixel-art scaler: none, nearest2x-4x, bilinear2x-4x, scale2x, scale3x, hq2x-hq4x, xbrz2x-xbrz6x")
+	scanlines := flag.Float64("scanlines", 0, "darkness of the CRT scanlines, 0-1 (needs a scaler or the NTSC filter)")
+	region := flag.String("region", "auto", "console timing: auto (from the ROM header, database or file name), ntsc, pal or dendy")
+	overscanFlag := flag.String("overscan", "8,8,0,0", "NES pixels cropped as top,bottom,left,right, or one number for all sides")
+	debugDir := flag.String("debug-dir", "", "write the PPU debug views and register writes of the last frame to this directory")
+	debugPalette := flag.Int("debug-palette", 0, "palette of the pattern tables in the debug views, 0-7")
+	unlimitedSprites := flag.Bool("unlimited-sprites", false, "draw more than 8 sprites per line")
+	gdb := flag.String("gdb", "", "serve the GDB remote protocol on this address, e.g. localhost:2345, until killed")
+	debug := flag.Bool("debug", false, "run the debugger on stdin instead of -frames frames, Ctrl-C stops the console")
+	dbPath := flag.String("db", "", "NES 2.0 XML database (nes20db.xml) with the regions and devices of iNES 1.0 ROMs")
+	flag.Parse()
+
+	if *romPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var db rom.Database
+	if *dbPath != "" {
+		var err error
+		if db, err = rom.LoadDatabase(*dbPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	nes, err := console.LoadWith(*romPath, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *region != "auto" {
+		r, err := rom.ParseRegion(*region)
+		if err != nil {
+			log.Fatal(err)
+		}
+		nes.SetRegion(r)
+	}
+	nes.PPU.UnlimitedSprites = *unlimitedSprites
+
+	pipeline, err := newPipeline(*palette, *ntsc, *scaler, *scanlines)
+	if err != nil {
+		log.Fatal(err)
+	}
+	overscan, err := video.ParseOverscan(*overscanFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	render := func() *image.RGBA {
+		frame := pipeline.Render(nes.PPU.FrameBuffer(), video.NTSCFramePhase(nes.PPU.FrameCount()))
+		return frame.SubImage(overscan.Crop(frame.Rect)).(*image.RGBA)
+	}
+
+	var recorder *video.Y4MWriter
+	if *record != "" {
+		f, err := os.Create(*record)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+
+		w, h := pipeline.Size()
+		visible := overscan.Crop(image.Rect(0, 0, w, h))
+		if recorder, err = video.NewY4MWriter(f, visible.Dx(), visible.Dy(), nes.FrameRate()); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *debugDir != "" {
+		nes.Bus.Events = bus.NewEventRecorder(nes.PPU)
+	}
+
+	if *gdb != "" {
+		log.Printf("Waiting for GDB on %s", *gdb)
+		d := debugger.New(nes)
+		if err := d.LoadSymbols(*romPath); err != nil {
+			log.Fatal(err)
+		}
+		log.Fatal(gdbstub.New(d).ListenAndServe(*gdb))
+	}
+	if *debug {
+		if err := runDebugger(nes, *romPath); err != nil {
+			log.Fatal(err)
+		}
+		*frames = 0
+	}
+	for i := 0; i < *frames; i++ {
+		nes.StepFrame()
+		if recorder != nil {
+			if err := recorder.WriteFrame(render()); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	if recorder != nil {
+		if err := recorder.Flush(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *screenshot != "" {
+		if err := writePNG(*screenshot, render()); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *debugDir != "" {
+		// The views use the palette of the picture
+		nes.PPU.Palette = pipeline.Palette
+		if err := writeDebugViews(*debugDir, nes.PPU, byte(*debugPalette)); err != nil {
+			log.Fatal(err)
+		}
+		if err := writeEvents(*debugDir, nes.Bus.Events.LastFrame(), nes.PPU.Timing()); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// runDebugger runs the debugger REPL until quit or the end of stdin, with
+// the symbols next to the ROM
+func runDebugger(nes *console.Console, romPath string) error {
+	d := debugger.New(nes)
+	defer d.Detach()
+	if err := d.LoadSymbols(romPath); err != nil {
+		return err
+	}
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		for range interrupts {
+			d.Interrupt()
+		}
+	}()
+
+	return d.REPL(os.Stdin, os.Stdout)
+}
+
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, img); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// writeDebugViews exports the pattern tables, nametables, sprites and
+// palette RAM as PNG files, and the OAM entries as text
+func writeDebugViews(dir string, p *ppu.PPU, palette byte) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	views := map[string]*image.RGBA{
+		"pattern0.png":   p.PatternTable(0, palette),
+		"pattern1.png":   p.PatternTable(1, palette),
+		"nametables.png": p.Nametables(),
+		"oam.png":        p.SpriteTiles(),
+		"palette.png":    p.PaletteRAM(),
+	}
+	for name, img := range views {
+		if err := writePNG(filepath.Join(dir, name), img); err != nil {
+			return err
+		}
+	}
+
+	var list strings.Builder
+	for i, s := range p.Sprites() {
+		fmt.Fprintf(&list, "%02d %v\n", i, s)
+	}
+	return os.WriteFile(filepath.Join(dir, "oam.txt"), []byte(list.String()), 0o644)
+}
+
+func newPipeline(palette, ntsc, scaler string, scanlines float64) (*video.Pipeline, error) {
+	p := &video.Pipeline{Scanlines: scanlines}
+
+	var err error
+	if p.Palette, err = ppu.FindPalette(palette); err != nil {
+		return nil, err
+	}
+	if ntsc != "" && ntsc != "none" {
+		settings, err := video.FindNTSCPreset(ntsc)
+		if err != nil {
+			return nil, err
+		}
+		p.NTSC = video.NewNTSC(settings)
+	}
+	if p.Scaler, err = video.NewScaler(scaler); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// writeEvents exports the register writes of the last frame on the dot grid, and as text
+func writeEvents(dir string, events []bus.Event, timing ppu.Timing) error {
+	if err := writePNG(filepath.Join(dir, "events.png"), bus.EventImage(events, timing)); err != nil {
+		return err
+	}
+	var list strings.Builder
+	for _, e := range events {
+		fmt.Fprintln(&list, e)
+	}
+	return os.WriteFile(filepath.Join(dir, "events.txt"), []byte(list.String()), 0o644)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+const (
+	saveSlots        = 10
+	fastForwardSpeed = 4 // Frames emulated per update while fast-forwarding
+	messageFrames    = 120
+	screenshotDir    = "screenshots"
+)
+
+func (k keyBinding) justPressed() bool {
+	return k.ok && inpututil.IsKeyJustPressed(k.key)
+}
+
+// handleHotkeys runs the frontend actions bound in the config file
+func (g *Game) handleHotkeys() {
+	hk := &g.bindings.hotkeys
+
+	if hk.reset.justPressed() {
+		g.reset()
+		g.showMessage("Reset")
+	}
+	if hk.pause.justPressed() {
+		g.paused = !g.paused
+	}
+	if hk.nextSlot.justPressed() {
+		g.slot = (g.slot + 1) % saveSlots
+		g.showMessage(fmt.Sprintf("Slot %d", g.slot))
+	}
+	if hk.saveState.justPressed() {
+		g.states[g.slot] = g.bus.SaveState()
+		g.showMessage(fmt.Sprintf("Saved slot %d", g.slot))
+	}
+	if hk.loadState.justPressed() {
+		if state := g.states[g.slot]; state != nil {
+			g.bus.LoadState(state)
+			g.showMessage(fmt.Sprintf("Loaded slot %d", g.slot))
+		} else {
+			g.showMessage(fmt.Sprintf("Slot %d is empty", g.slot))
+		}
+	}
+	if hk.screenshot.justPressed() {
+		if path, err := g.saveScreenshot(); err != nil {
+			g.showMessage("Screenshot failed: " + err.Error())
+		} else {
+			g.showMessage("Saved " + path)
+		}
+	}
+	if hk.nextPalette.justPressed() {
+		g.nextPalette()
+	}
+	if hk.nextFilter.justPressed() {
+		g.nextNTSC()
+	}
+	if hk.nextScaler.justPressed() {
+		g.nextScaler()
+	}
+	if hk.fullscreen.justPressed() {
+		g.setFullscreen(!g.config.Video.Fullscreen)
+		g.saveConfig()
+	}
+	if hk.debugView.justPressed() {
+		g.nextDebugView()
+	}
+	if hk.debugPalette.justPressed() {
+		g.nextDebugPalette()
+	}
+	if hk.debugger.justPressed() {
+		g.openDebugger()
+	}
+	g.fastForward = hk.fastForward.pressed()
+}
+
+// reset behaves like the console reset button
+func (g *Game) reset() {
+	g.console.Reset()
+}
+
+func (g *Game) showMessage(msg string) {
+	g.message = msg
+	g.messageTimer = messageFrames
+}
+
+// saveScreenshot writes the current frame as shown, filters included, as a PNG file in screenshotDir
+func (g *Game) saveScreenshot() (string, error) {
+	if err := os.MkdirAll(screenshotDir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(screenshotDir, time.Now().Format("2006-01-02_15-04-05.000")+".png")
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, g.visibleFrame()); err != nil {
+		return "", err
+	}
+	return path, f.Close()
+}
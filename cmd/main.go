@@ -1,110 +1,364 @@
 package main
 
 import (
+	"flag"
+	"image/color"
+	"io"
+	"log"
+	"math"
+
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/sergey121/nes-emulator/internal/bus"
+	"github.com/sergey121/nes-emulator/internal/config"
+	"github.com/sergey121/nes-emulator/internal/console"
 	"github.com/sergey121/nes-emulator/internal/cpu"
+	"github.com/sergey121/nes-emulator/internal/debugger"
 	"github.com/sergey121/nes-emulator/internal/input"
 	"github.com/sergey121/nes-emulator/internal/ppu"
 	"github.com/sergey121/nes-emulator/internal/rom"
+	"github.com/sergey121/nes-emulator/internal/video"
 )
 
 type Game struct {
+	console *console.Console
+	romPath string // Symbols for the debugger are looked for next to it
 	cpu     *cpu.CPU
 	ppu     *ppu.PPU
 	bus     *bus.Bus
-	ebImage *ebiten.Image
+
+	// Palette, NTSC filter, scaler and scanlines
+	video      video.Pipeline
+	frameImage *ebiten.Image // Output of the pipeline, resized with it
+	// Crop and placement of the picture in the window
+	overscan         video.Overscan
+	pixelAspect      float64
+	screenW, screenH int
+
+	// Joypads of players 1-4, whatever ports they are plugged into
+	players [4]*input.Controller
+	// Other attached devices, nil when not attached
+	zapper   *input.Zapper
+	vaus     *input.Vaus
+	mat      buttonMat
+	matSideA bool // The mat lies with side A up, its keys are mirrored
+	keyboard *input.FamilyKeyboard
+	// The Family BASIC keyboard takes the whole host keyboard until captureKey
+	keyboardCaptured bool
+
+	config     *config.Config
+	configPath string // Empty if the config can not be saved
+	bindings   *bindings
+
+	paused       bool
+	fastForward  bool
+	slot         int
+	states       [saveSlots]*bus.State
+	message      string
+	messageTimer int
+
+	rebinding bool
+	rebind    rebindScreen
+
+	// PPU debug view shown over the picture, debugOff for none
+	debugView        int
+	debugPalette     byte // Palette of the pattern tables, 0-7
+	debugImageBuffer *ebiten.Image
+
+	// CPU debugger, nil until it is first opened.
+	// The overlay takes the keyboard for its command line.
+	debugger     *debugger.Debugger
+	debuggerOpen bool
+	debugInput   string
+	debugChars   []rune
+	debugLast    string // Command an empty line repeats
+	debugLog     debugLog
+	debugOut     io.Writer   // Output of the commands: the log, and stdout with -debug
+	debugStdin   chan string // Commands typed in the terminal with -debug
+}
+
+// overlayColor darkens the picture behind on-screen text
+var overlayColor = color.RGBA{0, 0, 0, 0xC0}
+
+// inputOptions selects the devices attached to the console.
+// Empty names mean "use the default from the ROM header".
+type inputOptions struct {
+	port1, port2, expansion string
+	matSide                 string // a or b
 }
 
 func getTestPath(part string) string {
 	return "./assets/tests/" + part + ".nes"
 }
 
-func NewGame() *Game {
+func NewGame(inputOpts inputOptions, cfg *config.Config, configPath string, db rom.Database) *Game {
 	// path := "./assets/roms/Tetris.nes"
 	path := "./assets/roms/Super Mario Bros (E).nes"
 	// path := "./assets/roms/test_cpu_exec_space_apu.nes"
 
 	// path := getTestPath("palette")
 
-	cartridge, err := rom.LoadRom(path)
+	nes, err := console.LoadWith(path, db)
 	if err != nil {
 		panic(err)
 	}
+	if cfg.Region != "" {
+		region, err := rom.ParseRegion(cfg.Region)
+		if err != nil {
+			panic(err)
+		}
+		nes.SetRegion(region)
+	}
+	bus := nes.Bus
 
-	ppu := ppu.New(cartridge.CHR)
-
-	bus := bus.New(ppu, cartridge)
-	cpuInstance := cpu.New()
+	bindings, err := resolveBindings(cfg)
+	if err != nil {
+		panic(err)
+	}
 
-	cpuInstance.AttachBus(bus)
-	bus.AttachCPU(cpuInstance)
+	game := &Game{
+		console: nes,
+		romPath: path,
+		cpu:     nes.CPU,
+		ppu:     nes.PPU,
+		bus:     bus,
+		players: [4]*input.Controller{
+			bus.Controller1,
+			bus.Controller2,
+			input.NewController(),
+			input.NewController(),
+		},
+		config:     cfg,
+		configPath: configPath,
+		bindings:   bindings,
+	}
 
-	cpuInstance.Reset()
+	applyControllerSettings(cfg, game.players)
+	game.ppu.UnlimitedSprites = cfg.Video.UnlimitedSprites
 
-	ebImage := ebiten.NewImage(256, 240)
+	// A saved setting may be a typo or a .pal file that has moved, which
+	// must not keep the emulator from starting
+	defaults := config.Default().Video
+	if err := game.setPalette(cfg.Video.Palette); err != nil {
+		log.Printf("%v, using the %s palette", err, defaults.Palette)
+		if err := game.setPalette(defaults.Palette); err != nil {
+			panic(err)
+		}
+	}
+	if err := game.setNTSC(cfg.Video.NTSC); err != nil {
+		log.Printf("%v, using no NTSC filter", err)
+		game.setNTSC(defaults.NTSC)
+	}
+	if err := game.setScaler(cfg.Video.Scaler); err != nil {
+		log.Printf("%v, using no scaler", err)
+		game.setScaler(defaults.Scaler)
+	}
+	game.video.Scanlines = cfg.Video.Scanlines
+	if err := game.setOverscan(cfg.Video.Overscan); err != nil {
+		panic(err)
+	}
+	if err := game.setPixelAspect(cfg.Video.PixelAspect); err != nil {
+		panic(err)
+	}
 
-	return &Game{
-		cpu:     cpuInstance,
-		ppu:     ppu,
-		bus:     bus,
-		ebImage: ebImage,
+	if err := game.attachInputDevices(nes.Cartridge, inputOpts); err != nil {
+		panic(err)
 	}
+
+	return game
 }
 
 func (g *Game) Update() error {
-	// Update controller state
-	var buttons byte
-	if ebiten.IsKeyPressed(ebiten.KeyZ) {
-		buttons |= input.ButtonA
+	if g.messageTimer > 0 {
+		g.messageTimer--
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyX) {
-		buttons |= input.ButtonB
+
+	if g.rebinding {
+		g.updateRebind()
+		return nil
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyShift) {
-		buttons |= input.ButtonSelect
+	if g.debugger != nil {
+		g.updateDebugger()
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyEnter) {
-		buttons |= input.ButtonStart
+	if g.debuggerOpen {
+		// Commands like continue keep the console running under the overlay
+		if g.debugger != nil && g.debugger.Running() {
+			g.runDebugger()
+		}
+		return nil
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyUp) {
-		buttons |= input.ButtonUp
+	if g.keyboard != nil && inpututil.IsKeyJustPressed(captureKey) {
+		g.keyboardCaptured = !g.keyboardCaptured
+		if g.keyboardCaptured {
+			g.showMessage("Keyboard captured, Scroll Lock releases it")
+		} else {
+			g.showMessage("Keyboard released, Scroll Lock captures it")
+		}
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyDown) {
-		buttons |= input.ButtonDown
+	// Hotkeys would also reach the emulated keyboard
+	if !g.keyboardCaptured {
+		if g.bindings.hotkeys.bindings.justPressed() {
+			g.rebinding = true
+			g.rebind = rebindScreen{}
+			return nil
+		}
+		g.handleHotkeys()
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyLeft) {
-		buttons |= input.ButtonLeft
+	if g.paused {
+		return nil
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyRight) {
-		buttons |= input.ButtonRight
+
+	// Read the host input once, the joypads take it every emulated frame.
+	// The captured keyboard only types on the Family BASIC keyboard, gamepads still play
+	gamepads := connectedGamepads()
+	var held, turbo [len(g.players)]byte
+	for i := range g.players {
+		held[i], turbo[i] = g.bindings.players[i].buttons(gamepads, !g.keyboardCaptured)
 	}
-	g.bus.Controller1.SetButtons(buttons)
+	g.updateDevices()
 
-	// Один кадр ≈ 29780 PPU-тактов
-	for i := 0; i < 29780; i++ {
-		g.cpu.Clock()
+	frames := 1
+	if g.fastForward {
+		frames = fastForwardSpeed
+	}
+	for f := 0; f < frames; f++ {
+		// Autofire counts emulated frames, also when fast-forwarding
+		for i, player := range g.players {
+			player.Update(held[i], turbo[i])
+		}
+		if g.debugger != nil {
+			g.runDebugger()
+		} else {
+			g.console.StepFrame()
+		}
 	}
 
 	return nil
 }
 
 func (g *Game) Draw(screen *ebiten.Image) {
-	g.ppu.DrawToImage(g.ebImage)     // твой метод отрисовки framebuffer в ebiten.Image
-	screen.DrawImage(g.ebImage, nil) // вывод на экран
+	g.drawVideo(screen)
+
+	if g.rebinding {
+		g.drawRebind(screen)
+		return
+	}
+	if g.debugView != debugOff {
+		g.drawDebugView(screen)
+	}
+	if g.debuggerOpen {
+		g.drawDebugger(screen)
+	}
+	if g.paused {
+		ebitenutil.DebugPrintAt(screen, "Paused", 8, 8)
+	}
+	if g.messageTimer > 0 {
+		w, h := g.screenSize()
+		ebitenutil.DrawRect(screen, 0, float64(h-16), float64(w), 16, overlayColor)
+		ebitenutil.DebugPrintAt(screen, g.message, 4, h-16)
+	}
 }
 
+// Layout uses the whole window, drawVideo fits the picture into it
 func (g *Game) Layout(outW, outH int) (int, int) {
-	return 256, 240
+	g.screenW, g.screenH = outW, outH
+	return outW, outH
 }
 
 func main() {
-	game := NewGame()
+	var inputOpts inputOptions
+	flag.StringVar(&inputOpts.port1, "port1", "", "device in controller port 1: none, joypad, fourscore, zapper, vaus, powerpad (default from ROM header)")
+	flag.StringVar(&inputOpts.port2, "port2", "", "device in controller port 2: none, joypad, fourscore, zapper, vaus, powerpad (default from ROM header)")
+	flag.StringVar(&inputOpts.expansion, "expansion", "", "Famicom expansion port device: none, hori, famicom-pads, vaus-famicom, family-trainer, keyboard (default from ROM header)")
+	flag.StringVar(&inputOpts.matSide, "mat-side", "", "side of the Power Pad or Family Trainer facing up: a or b (default from ROM header, else b)")
+	palette := flag.String("palette", "", "palette preset (2c02, fceux, nestopia-yuv, sony-cxa, pvm, rgb) or .pal file")
+	ntsc := flag.String("ntsc", "", "NTSC filter preset: none, composite, svideo, rgb, mono")
+	scaler := flag.String("scaler", "", "pixel-art scaler: none, nearest2x-4x, bilinear2x-4x, scale2x, scale3x, hq2x-hq4x, xbrz2x-xbrz6x")
+	scanlines := flag.Float64("scanlines", -1, "darkness of the CRT scanlines, 0-1 (needs a scaler or the NTSC filter)")
+	overscan := flag.String("overscan", "", "NES pixels cropped as top,bottom,left,right, or one number for all sides (default 8,8,0,0)")
+	aspect := flag.String("aspect", "", "pixel aspect ratio: 1:1 (square) or 8:7 (TV)")
+	integer := flag.Bool("integer", false, "scale only by whole numbers, with black bars around the picture")
+	fullscreen := flag.Bool("fullscreen", false, "start in fullscreen mode")
+	unlimitedSprites := flag.Bool("unlimited-sprites", false, "draw more than 8 sprites per line to remove flicker")
+	region := flag.String("region", "", "console timing: auto (from the ROM header, database or file name), ntsc, pal or dendy")
+	debug := flag.Bool("debug", false, "start stopped in the debugger, with commands also read from the terminal")
+	configPath := flag.String("config", "", "path to the bindings config file (default in the user config directory)")
+	dbPath := flag.String("db", "", "NES 2.0 XML database (nes20db.xml) with the regions and devices of iNES 1.0 ROMs")
+	flag.Parse()
+
+	var db rom.Database
+	if *dbPath != "" {
+		var err error
+		if db, err = rom.LoadDatabase(*dbPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *configPath == "" {
+		// Without a config directory the defaults are used and never saved
+		*configPath, _ = config.DefaultPath()
+	}
+	cfg := config.Default()
+	if *configPath != "" {
+		var err error
+		if cfg, err = config.Load(*configPath); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	ebiten.SetWindowSize(512, 480)
+	if *palette != "" {
+		cfg.Video.Palette = *palette
+	}
+	if *ntsc != "" {
+		cfg.Video.NTSC = *ntsc
+	}
+	if *scaler != "" {
+		cfg.Video.Scaler = *scaler
+	}
+	if *scanlines >= 0 {
+		cfg.Video.Scanlines = *scanlines
+	}
+	if *region == "auto" {
+		cfg.Region = ""
+	} else if *region != "" {
+		cfg.Region = *region
+	}
+	if *overscan != "" {
+		o, err := video.ParseOverscan(*overscan)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.Video.Overscan = config.Overscan(o)
+	}
+	if *aspect != "" {
+		cfg.Video.PixelAspect = *aspect
+	}
+	// Boolean flags only override the config when given, so -integer=false works too
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "integer":
+			cfg.Video.IntegerScaling = *integer
+		case "fullscreen":
+			cfg.Video.Fullscreen = *fullscreen
+		case "unlimited-sprites":
+			cfg.Video.UnlimitedSprites = *unlimitedSprites
+		}
+	})
+
+	game := NewGame(inputOpts, cfg, *configPath, db)
+	if *debug {
+		game.attachDebugger(true)
+	}
+
+	ebiten.SetWindowSize(game.windowSize())
+	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
 	ebiten.SetWindowTitle("NES Emulator")
+	// 60 Hz NTSC, 50 Hz PAL and Dendy
+	ebiten.SetTPS(int(math.Round(game.console.FrameRate())))
+	game.setFullscreen(cfg.Video.Fullscreen)
 
 	if err := ebiten.RunGame(game); err != nil {
-		panic(err)
+		log.Fatal(err)
 	}
 }
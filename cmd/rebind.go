@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/sergey121/nes-emulator/internal/config"
+)
+
+// rebindScreen lets the user change the joypad bindings in the app.
+// Up/Down select a button, Left/Right select a player, Tab switches
+// between keyboard and gamepad, Enter waits for a new input,
+// Delete clears the binding and Escape saves the config and closes.
+type rebindScreen struct {
+	player  int
+	button  int
+	gamepad bool
+	waiting bool
+}
+
+// updateRebind handles input while the rebinding screen is open
+func (g *Game) updateRebind() {
+	r := &g.rebind
+
+	if r.waiting {
+		if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+			r.waiting = false
+			return
+		}
+		if name, ok := r.captureInput(); ok {
+			fields := g.playerButtons(r.player, r.gamepad)
+			*fields[r.button] = name
+			r.waiting = false
+			g.applyConfig()
+		}
+		return
+	}
+
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		g.closeRebind()
+	case inpututil.IsKeyJustPressed(ebiten.KeyUp):
+		r.button = (r.button + len(config.ButtonNames) - 1) % len(config.ButtonNames)
+	case inpututil.IsKeyJustPressed(ebiten.KeyDown):
+		r.button = (r.button + 1) % len(config.ButtonNames)
+	case inpututil.IsKeyJustPressed(ebiten.KeyLeft):
+		r.player = (r.player + len(g.config.Players) - 1) % len(g.config.Players)
+	case inpututil.IsKeyJustPressed(ebiten.KeyRight):
+		r.player = (r.player + 1) % len(g.config.Players)
+	case inpututil.IsKeyJustPressed(ebiten.KeyTab):
+		r.gamepad = !r.gamepad
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
+		r.waiting = true
+	case inpututil.IsKeyJustPressed(ebiten.KeyDelete), inpututil.IsKeyJustPressed(ebiten.KeyBackspace):
+		*g.playerButtons(r.player, r.gamepad)[r.button] = ""
+		g.applyConfig()
+	}
+}
+
+// captureInput returns the name of the first key or gamepad button pressed this frame
+func (r *rebindScreen) captureInput() (string, bool) {
+	if !r.gamepad {
+		keys := inpututil.AppendJustPressedKeys(nil)
+		if len(keys) == 0 {
+			return "", false
+		}
+		return keys[0].String(), true
+	}
+
+	for _, id := range connectedGamepads() {
+		buttons := inpututil.AppendJustPressedStandardGamepadButtons(id, nil)
+		for _, b := range buttons {
+			if name := gamepadButtonName(b); name != "" {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (g *Game) playerButtons(player int, gamepad bool) [10]*string {
+	if gamepad {
+		return g.config.Players[player].Gamepad.Buttons.Fields()
+	}
+	return g.config.Players[player].Keyboard.Fields()
+}
+
+// applyConfig resolves the edited config, keeping the old bindings on error
+func (g *Game) applyConfig() {
+	b, err := resolveBindings(g.config)
+	if err != nil {
+		g.showMessage(err.Error())
+		return
+	}
+	g.bindings = b
+}
+
+func (g *Game) closeRebind() {
+	g.rebinding = false
+	if g.saveConfig() {
+		g.showMessage("Bindings saved")
+	}
+}
+
+// saveConfig writes the config file, reporting failures on screen
+func (g *Game) saveConfig() bool {
+	if g.configPath == "" {
+		return false
+	}
+	if err := g.config.Save(g.configPath); err != nil {
+		g.showMessage("Config not saved: " + err.Error())
+		return false
+	}
+	return true
+}
+
+func (g *Game) drawRebind(screen *ebiten.Image) {
+	r := &g.rebind
+	w, h := g.screenSize()
+	ebitenutil.DrawRect(screen, 0, 0, float64(w), float64(h), overlayColor)
+
+	source := "Keyboard"
+	if r.gamepad {
+		source = fmt.Sprintf("Gamepad %d", g.config.Players[r.player].Gamepad.Index+1)
+	}
+	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("< Player %d >  %s", r.player+1, source), 8, 8)
+
+	fields := g.playerButtons(r.player, r.gamepad)
+	for i, name := range config.ButtonNames {
+		value := *fields[i]
+		if value == "" {
+			value = "-"
+		}
+		if i == r.button && r.waiting {
+			value = "press a key..."
+		}
+		cursor := "  "
+		if i == r.button {
+			cursor = "> "
+		}
+		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%s%-7s %s", cursor, name, value), 8, 28+i*14)
+	}
+
+	ebitenutil.DebugPrintAt(screen, "Enter: bind  Del: clear", 8, 180)
+	ebitenutil.DebugPrintAt(screen, "Tab: keyboard/gamepad", 8, 196)
+	ebitenutil.DebugPrintAt(screen, "Esc: save and close", 8, 212)
+}
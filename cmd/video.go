@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/sergey121/nes-emulator/internal/config"
+	"github.com/sergey121/nes-emulator/internal/ppu"
+	"github.com/sergey121/nes-emulator/internal/video"
+)
+
+// setPalette switches to a built-in palette or a .pal file and remembers it in the config
+func (g *Game) setPalette(name string) error {
+	pal, err := ppu.FindPalette(name)
+	if err != nil {
+		return err
+	}
+	g.ppu.Palette = pal
+	g.video.Palette = pal
+	g.config.Video.Palette = name
+	return nil
+}
+
+// nextPalette cycles through the built-in palettes
+func (g *Game) nextPalette() {
+	next := 0
+	for i, preset := range ppu.PalettePresets {
+		if preset.Name == g.config.Video.Palette {
+			next = (i + 1) % len(ppu.PalettePresets)
+		}
+	}
+	preset := ppu.PalettePresets[next]
+	if err := g.setPalette(preset.Name); err != nil {
+		g.showMessage(err.Error())
+		return
+	}
+	g.saveConfig()
+	g.showMessage("Palette: " + preset.Description)
+}
+
+// setNTSC enables the NTSC filter with a preset, "" or "none" disables it
+func (g *Game) setNTSC(name string) error {
+	if name == "" || name == "none" {
+		g.video.NTSC = nil
+		g.config.Video.NTSC = ""
+		return nil
+	}
+	settings, err := video.FindNTSCPreset(name)
+	if err != nil {
+		return err
+	}
+	g.video.NTSC = video.NewNTSC(settings)
+	g.config.Video.NTSC = name
+	return nil
+}
+
+// nextNTSC cycles through off and the NTSC presets
+func (g *Game) nextNTSC() {
+	names := append([]string{"none"}, video.NTSCPresetNames...)
+	next := 0
+	for i, name := range names {
+		if name == g.config.Video.NTSC {
+			next = (i + 1) % len(names)
+		}
+	}
+	if err := g.setNTSC(names[next]); err != nil {
+		g.showMessage(err.Error())
+		return
+	}
+	g.saveConfig()
+	g.showMessage("NTSC filter: " + names[next])
+}
+
+// setScaler selects a pixel-art scaler, "" or "none" disables it
+func (g *Game) setScaler(name string) error {
+	scaler, err := video.NewScaler(name)
+	if err != nil {
+		return err
+	}
+	g.video.Scaler = scaler
+	if scaler == nil {
+		name = ""
+	}
+	g.config.Video.Scaler = name
+	return nil
+}
+
+// nextScaler cycles through the scalers
+func (g *Game) nextScaler() {
+	next := 0
+	for i, name := range video.ScalerNames {
+		if name == g.config.Video.Scaler {
+			next = (i + 1) % len(video.ScalerNames)
+		}
+	}
+	name := video.ScalerNames[next]
+	if err := g.setScaler(name); err != nil {
+		g.showMessage(err.Error())
+		return
+	}
+	g.saveConfig()
+	if g.video.NTSC != nil {
+		g.showMessage(fmt.Sprintf("Scaler: %s (unused with the NTSC filter)", name))
+		return
+	}
+	g.showMessage("Scaler: " + name)
+}
+
+// setOverscan sets the pixels cropped on each side
+func (g *Game) setOverscan(o config.Overscan) error {
+	overscan := video.Overscan(o)
+	if err := overscan.Validate(); err != nil {
+		return err
+	}
+	g.overscan = overscan
+	g.config.Video.Overscan = o
+	return nil
+}
+
+// setPixelAspect selects square ("1:1") or TV ("8:7") pixels
+func (g *Game) setPixelAspect(name string) error {
+	switch name {
+	case "", "1:1":
+		g.pixelAspect = 1
+		name = "1:1"
+	case "8:7":
+		g.pixelAspect = video.NTSCPixelAspect
+	default:
+		return fmt.Errorf("unknown pixel aspect ratio: %q (expected 1:1 or 8:7)", name)
+	}
+	g.config.Video.PixelAspect = name
+	return nil
+}
+
+func (g *Game) setFullscreen(fullscreen bool) {
+	ebiten.SetFullscreen(fullscreen)
+	g.config.Video.Fullscreen = fullscreen
+}
+
+// windowSize returns the initial window size: the visible picture at 2x
+func (g *Game) windowSize() (int, int) {
+	w, h := g.overscan.Size()
+	return int(math.Round(float64(w) * g.pixelAspect * 2)), h * 2
+}
+
+// screenSize returns the size of the screen image, which is the window size
+func (g *Game) screenSize() (int, int) {
+	if g.screenW == 0 {
+		return g.windowSize()
+	}
+	return g.screenW, g.screenH
+}
+
+// viewport returns where the visible picture is drawn on screen
+func (g *Game) viewport() video.Viewport {
+	w, h := g.overscan.Size()
+	screenW, screenH := g.screenSize()
+	return video.FitViewport(w, h, screenW, screenH, g.pixelAspect, g.config.Video.IntegerScaling)
+}
+
+// cursorPosition returns the mouse position in NES pixels
+func (g *Game) cursorPosition() (int, int) {
+	x, y := ebiten.CursorPosition()
+	vp := g.viewport()
+	w, h := g.overscan.Size()
+	nesX := math.Floor((float64(x) - vp.X) * float64(w) / vp.Width)
+	nesY := math.Floor((float64(y) - vp.Y) * float64(h) / vp.Height)
+	return int(nesX) + g.overscan.Left, int(nesY) + g.overscan.Top
+}
+
+// renderFrame runs the last frame through the video pipeline
+func (g *Game) renderFrame() *image.RGBA {
+	return g.video.Render(g.ppu.FrameBuffer(), video.NTSCFramePhase(g.ppu.FrameCount()))
+}
+
+// visibleFrame returns the rendered frame without the overscan
+func (g *Game) visibleFrame() image.Image {
+	frame := g.renderFrame()
+	return frame.SubImage(g.overscan.Crop(frame.Rect))
+}
+
+// drawVideo uploads the last frame, filtered if enabled, and draws the
+// visible part of it on screen
+func (g *Game) drawVideo(screen *ebiten.Image) {
+	frame := g.renderFrame()
+	// The size changes with the scaler
+	if g.frameImage == nil || g.frameImage.Bounds() != frame.Rect {
+		if g.frameImage != nil {
+			g.frameImage.Deallocate()
+		}
+		g.frameImage = ebiten.NewImage(frame.Rect.Dx(), frame.Rect.Dy())
+	}
+	g.frameImage.WritePixels(frame.Pix) // один upload на кадр
+
+	visible := g.overscan.Crop(frame.Rect)
+	vp := g.viewport()
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(vp.Width/float64(visible.Dx()), vp.Height/float64(visible.Dy()))
+	op.GeoM.Translate(vp.X, vp.Y)
+	// Letterbox bars stay black
+	screen.Clear()
+	screen.DrawImage(g.frameImage.SubImage(visible).(*ebiten.Image), op) // вывод на экран
+}
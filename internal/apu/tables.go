@@ -0,0 +1,39 @@
+package apu
+
+import "github.com/sergey121/nes-emulator/internal/rom"
+
+// Timing holds the periods of the APU that depend on the region, in CPU cycles.
+// https://www.nesdev.org/wiki/APU_Noise
+// https://www.nesdev.org/wiki/APU_DMC
+// https://www.nesdev.org/wiki/APU_Frame_Counter
+type Timing struct {
+	NoisePeriods [16]uint16
+	DMCRates     [16]uint16
+	// FrameSteps are the CPU cycles of the frame counter steps. The 4-step
+	// sequence ends at step 4, the 5-step sequence at step 5.
+	FrameSteps [5]int
+}
+
+var (
+	// NTSCTiming is the RP2A03. Dendy clones use it too: their CPU runs at
+	// the PAL master clock divided by 15, so in CPU cycles nothing changes.
+	NTSCTiming = Timing{
+		NoisePeriods: [16]uint16{4, 8, 16, 32, 64, 96, 128, 160, 202, 254, 380, 508, 762, 1016, 2034, 4068},
+		DMCRates:     [16]uint16{428, 380, 340, 320, 286, 254, 226, 214, 190, 160, 142, 128, 106, 84, 72, 54},
+		FrameSteps:   [5]int{7457, 14913, 22371, 29829, 37281},
+	}
+	// PALTiming is the RP2A07
+	PALTiming = Timing{
+		NoisePeriods: [16]uint16{4, 8, 14, 30, 60, 88, 118, 148, 188, 236, 354, 472, 708, 944, 1890, 3778},
+		DMCRates:     [16]uint16{398, 354, 316, 298, 276, 236, 210, 198, 176, 148, 132, 118, 98, 78, 66, 50},
+		FrameSteps:   [5]int{8313, 16627, 24939, 33253, 41565},
+	}
+)
+
+// TimingFor returns the APU periods of a region
+func TimingFor(region rom.Region) *Timing {
+	if region == rom.RegionPAL {
+		return &PALTiming
+	}
+	return &NTSCTiming
+}
@@ -8,22 +8,81 @@ import (
 )
 
 type Bus struct {
-	CPU         *cpu.CPU
-	PPU         *ppu.PPU
-	Cartridge   *rom.Cartridge
+	CPU       *cpu.CPU
+	PPU       *ppu.PPU
+	Cartridge *rom.Cartridge
+	// Standard joypads, plugged into Port1 and Port2 by default
 	Controller1 *input.Controller
+	Controller2 *input.Controller
+
+	Port1     input.InputDevice     // Device read through $4016, nil if empty
+	Port2     input.InputDevice     // Device read through $4017, nil if empty
+	Expansion input.ExpansionDevice // Famicom expansion port, nil if empty
 	// RAM is the 2KB of RAM in the NES
 	RAM [0x800]byte // 2KB of RAM
+
+	// dataBus holds the last value driven on the CPU data bus.
+	// Bits that a device does not drive on a read keep this value (open bus).
+	dataBus byte
+
+	// Events records the register writes when set
+	Events *EventRecorder
+
+	// Debugger hooks, nil when no debugger is attached.
+	// OnAccess sees every CPU read after it and every write before it.
+	OnAccess func(addr uint16, value byte, write bool)
+	// OnInterrupt is called when the CPU takes an interrupt
+	OnInterrupt func(nmi bool)
+
+	region rom.Region
+	// PPU dots per CPU cycle in fifths, and the fifths not run yet
+	ppuRatio, ppuFraction int
+	// PPU dots already run for the coming cycles of the current
+	// instruction, to reach the cycle of a PPU register access
+	ppuAhead int
 }
 
 func New(ppu *ppu.PPU, cartridge *rom.Cartridge) *Bus {
-	return &Bus{
+	b := &Bus{
 		PPU:         ppu,
 		Cartridge:   cartridge,
 		Controller1: input.NewController(),
+		Controller2: input.NewController(),
+	}
+	b.Port1 = b.Controller1
+	b.Port2 = b.Controller2
+	b.SetRegion(cartridge.Region)
+	return b
+}
+
+// SetRegion switches the console timing: the PPU frame and the number of
+// PPU dots per CPU cycle. It is 3 for NTSC and Dendy and 3.2 for PAL, where
+// the CPU divides the master clock by 16 and the PPU by 5.
+// Multi-region games run as NTSC.
+func (b *Bus) SetRegion(region rom.Region) {
+	if region == rom.RegionMulti {
+		region = rom.RegionNTSC
+	}
+	b.region = region
+	b.ppuFraction, b.ppuAhead = 0, 0
+	switch region {
+	case rom.RegionPAL:
+		b.PPU.SetTiming(ppu.PALTiming)
+		b.ppuRatio = 16
+	case rom.RegionDendy:
+		b.PPU.SetTiming(ppu.DendyTiming)
+		b.ppuRatio = 15
+	default:
+		b.PPU.SetTiming(ppu.NTSCTiming)
+		b.ppuRatio = 15
 	}
 }
 
+// Region returns the console timing
+func (b *Bus) Region() rom.Region {
+	return b.region
+}
+
 func (b *Bus) AttachCPU(cpu *cpu.CPU) {
 	b.CPU = cpu
 }
@@ -34,29 +93,77 @@ func (b *Bus) ShouldTriggerNMI() bool {
 
 func (b *Bus) AcknowledgeNMI() {
 	b.PPU.ClearNMI()
+	if b.OnInterrupt != nil {
+		b.OnInterrupt(true)
+	}
 }
 
 func (b *Bus) CPURead(addr uint16) byte {
-	// TODO: Add APU/controller read
+	value := b.read(addr)
+	// $4015 is read inside the 2A03 and is not driven on the external bus
+	if addr != 0x4015 {
+		b.dataBus = value
+	}
+	if b.OnAccess != nil {
+		b.OnAccess(addr, value, false)
+	}
+	return value
+}
+
+func (b *Bus) read(addr uint16) byte {
+	// TODO: Add APU read
 	switch {
 	case addr < 0x2000:
 		// Read from RAM and mirrors
 		return b.RAM[addr%0x800]
 	case addr >= 0x2000 && addr < 0x4000:
 		// PPU registers ($2000-$3FFF), mirrors every 8 bytes
+		b.catchUpPPU()
 		return b.PPU.ReadRegister(0x2000 + (addr % 8))
+	case addr == 0x4015:
+		// APU status. Bit 5 is not driven. There is no APU yet,
+		// so length counters and interrupt flags always read 0.
+		return b.dataBus & 0x20
 	case addr == 0x4016:
-		return b.Controller1.Read()
+		return b.controllerRead(b.Port1, 0)
+	case addr == 0x4017:
+		return b.controllerRead(b.Port2, 1)
 	case addr >= 0x8000:
 		// Cartridge ROM ($8000-$FFFF)
 		return b.Cartridge.ReadPRG(addr)
 	default:
-		// Unmapped memory returns open bus (usually high byte of address)
-		return byte(addr >> 8)
+		// Write-only APU registers, the CPU test registers at $4018-$401F
+		// and the expansion area at $4020-$7FFF are open bus: the last value
+		// on the data bus, e.g. the high byte of the operand of LDA $5000
+		return b.dataBus
+	}
+}
+
+// controllerRead returns the bits driven by the device on a controller port
+// and the expansion port. Devices only drive the low 5 bits, the upper 3 bits are open bus.
+func (b *Bus) controllerRead(device input.InputDevice, port int) byte {
+	var value byte
+	if device != nil {
+		value = device.Read()
+	}
+	if b.Expansion != nil {
+		value |= b.Expansion.ReadPort(port)
 	}
+	return (b.dataBus & 0xE0) | (value & 0x1F)
 }
 
 func (b *Bus) CPUWrite(addr uint16, value byte) {
+	b.dataBus = value
+	if addr >= 0x2000 && addr <= 0x3FFF {
+		b.catchUpPPU()
+	}
+	if b.Events != nil && isEventRegister(addr) {
+		b.Events.record(addr, value, b.accessDelay())
+	}
+	if b.OnAccess != nil {
+		b.OnAccess(addr, value, true)
+	}
+
 	switch {
 	case addr >= 0x0000 && addr <= 0x1FFF:
 		// 2KB internal RAM, mirrored every 0x800
@@ -92,10 +199,19 @@ func (b *Bus) CPUWrite(addr uint16, value byte) {
 		// but immediate copy works for functionality.
 
 	case addr == 0x4016:
-		b.Controller1.Write(value)
+		// The strobe line (OUT0) is shared by both controller ports and the expansion port
+		if b.Port1 != nil {
+			b.Port1.Write(value)
+		}
+		if b.Port2 != nil {
+			b.Port2.Write(value)
+		}
+		if b.Expansion != nil {
+			b.Expansion.Write(value)
+		}
 
 	case addr == 0x4017:
-		// Controller 2 (not implemented yet)
+		// APU frame counter, controllers are not written here
 
 	case addr >= 0x8000:
 		// PRG ROM — обычно нельзя писать, но можно обработать
@@ -103,9 +219,36 @@ func (b *Bus) CPUWrite(addr uint16, value byte) {
 	}
 }
 
-func (b *Bus) ClockPPU() {
-	for i := 0; i < 3; i++ {
+// accessDelay returns the PPU dots from the current one to the cycle of the
+// current access. The CPU runs an instruction on its first cycle, but loads,
+// stores and read-modify-write instructions access memory on their last one.
+func (b *Bus) accessDelay() int {
+	if b.CPU == nil || b.CPU.CyclesLeft <= 1 {
+		return 0
+	}
+	return (b.ppuFraction+(b.CPU.CyclesLeft-1)*b.ppuRatio)/5 - b.ppuAhead
+}
+
+// catchUpPPU runs the PPU to the cycle of the current access, so a register
+// read or write sees the dot it really happens on, e.g. LDA $2002 racing
+// the vblank flag. ClockPPU skips the dots run ahead.
+func (b *Bus) catchUpPPU() {
+	for n := b.accessDelay(); n > 0; n-- {
 		b.PPU.Step()
+		b.ppuAhead++
+	}
+}
+
+// ClockPPU runs the PPU for one CPU cycle
+func (b *Bus) ClockPPU() {
+	b.ppuFraction += b.ppuRatio
+	for b.ppuFraction >= 5 {
+		if b.ppuAhead > 0 {
+			b.ppuAhead--
+		} else {
+			b.PPU.Step()
+		}
+		b.ppuFraction -= 5
 	}
 }
 
@@ -0,0 +1,197 @@
+package bus
+
+import (
+	"testing"
+
+	"github.com/sergey121/nes-emulator/internal/cpu"
+	"github.com/sergey121/nes-emulator/internal/input"
+	"github.com/sergey121/nes-emulator/internal/ppu"
+	"github.com/sergey121/nes-emulator/internal/rom"
+)
+
+func newTestBus() *Bus {
+	cartridge := &rom.Cartridge{
+		PRG: make([]byte, 0x4000),
+		CHR: make([]byte, 0x2000),
+	}
+	return New(ppu.New(cartridge.CHR), cartridge)
+}
+
+func TestController2Read(t *testing.T) {
+	b := newTestBus()
+	b.Controller1.SetButtons(input.ButtonA)
+	b.Controller2.SetButtons(input.ButtonB | input.ButtonRight)
+
+	// Strobe both controllers through $4016
+	b.CPUWrite(0x4016, 1)
+	b.CPUWrite(0x4016, 0)
+
+	expected := []byte{0, 1, 0, 0, 0, 0, 0, 1}
+	for i, want := range expected {
+		if got := b.CPURead(0x4017) & 0x01; got != want {
+			t.Errorf("$4017 read %d: expected %d, got %d", i, want, got)
+		}
+	}
+
+	// Controller 1 was latched by the same strobe
+	if got := b.CPURead(0x4016) & 0x01; got != 1 {
+		t.Errorf("$4016 read 0: expected 1, got %d", got)
+	}
+}
+
+func TestControllerOpenBusBits(t *testing.T) {
+	b := newTestBus()
+	b.CPUWrite(0x4016, 0)
+
+	// LDA $4016 leaves $40 (high byte of the operand) on the data bus
+	b.dataBus = 0x40
+	if got := b.CPURead(0x4016); got != 0x40 {
+		t.Errorf("expected $40 from $4016, got %02X", got)
+	}
+
+	b.dataBus = 0xFF
+	if got := b.CPURead(0x4017); got != 0xE0 {
+		t.Errorf("expected $E0 from $4017, got %02X", got)
+	}
+}
+
+func TestUnmappedReadsOpenBus(t *testing.T) {
+	b := newTestBus()
+
+	b.RAM[0] = 0x77
+	b.CPURead(0x0000)
+	for _, addr := range []uint16{0x4000, 0x4014, 0x4018, 0x4020, 0x5000, 0x6000, 0x7FFF} {
+		if got := b.CPURead(addr); got != 0x77 {
+			t.Errorf("$%04X: expected open bus $77, got $%02X", addr, got)
+		}
+	}
+
+	// Only bit 5 of $4015 is open bus
+	b.CPUWrite(0x0000, 0xFF)
+	if got := b.CPURead(0x4015); got != 0x20 {
+		t.Errorf("$4015: expected $20, got $%02X", got)
+	}
+	// and the read does not reach the external bus
+	if got := b.CPURead(0x5000); got != 0xFF {
+		t.Errorf("after $4015: expected open bus $FF, got $%02X", got)
+	}
+}
+
+func TestSaveLoadState(t *testing.T) {
+	b := newTestBus()
+	b.AttachCPU(cpu.New())
+	b.CPU.A = 0x12
+	b.CPUWrite(0x0300, 0x34)
+
+	state := b.SaveState()
+
+	b.CPU.A = 0
+	b.CPUWrite(0x0300, 0)
+	b.LoadState(state)
+
+	if b.CPU.A != 0x12 {
+		t.Errorf("expected A=$12, got %02X", b.CPU.A)
+	}
+	if got := b.CPURead(0x0300); got != 0x34 {
+		t.Errorf("expected $34 at $0300, got %02X", got)
+	}
+}
+
+// Settings changed after a save are not undone by loading it
+func TestLoadStateKeepsSettings(t *testing.T) {
+	b := newTestBus()
+	b.AttachCPU(cpu.New())
+	state := b.SaveState()
+
+	palette := new(ppu.Palette)
+	b.PPU.UnlimitedSprites = true
+	b.PPU.Palette = palette
+	b.LoadState(state)
+
+	if !b.PPU.UnlimitedSprites {
+		t.Errorf("expected the sprite limit to stay off")
+	}
+	if b.PPU.Palette != palette {
+		t.Errorf("expected the palette kept")
+	}
+}
+
+func TestRegionPPUClock(t *testing.T) {
+	tests := []struct {
+		region rom.Region
+		dots   int // PPU dots after 50 CPU cycles
+		frame  int // PPU dots per frame
+	}{
+		{rom.RegionNTSC, 150, 341 * 262},
+		{rom.RegionPAL, 160, 341 * 312},
+		{rom.RegionDendy, 150, 341 * 312},
+	}
+	for _, tt := range tests {
+		b := newTestBus()
+		b.SetRegion(tt.region)
+		for i := 0; i < 50; i++ {
+			b.ClockPPU()
+		}
+		if got := b.PPU.Scanline()*341 + b.PPU.Cycle(); got != tt.dots {
+			t.Errorf("%v: expected %d dots, got %d", tt.region, tt.dots, got)
+		}
+
+		for b.PPU.FrameCount() == 0 {
+			b.PPU.Step()
+		}
+		dots := 0
+		for b.PPU.FrameCount() == 1 {
+			b.PPU.Step()
+			dots++
+		}
+		if dots != tt.frame {
+			t.Errorf("%v: expected %d dots per frame, got %d", tt.region, tt.frame, dots)
+		}
+	}
+}
+
+// LDA $2002 reads on its 4th cycle, 9 dots after the 3 of its first one on
+// NTSC, and races the vblank flag set on dot 1 of line 241 at that dot
+func TestStatusReadCycle(t *testing.T) {
+	tests := []struct {
+		dot        int // Dot of line 241 of the read
+		wantStatus byte
+		wantNMI    bool
+	}{
+		{dot: 0, wantStatus: 0, wantNMI: false},
+		{dot: 1, wantStatus: 0x80, wantNMI: false},
+		{dot: 2, wantStatus: 0x80, wantNMI: false},
+		{dot: 3, wantStatus: 0x80, wantNMI: true},
+	}
+	for _, tt := range tests {
+		b := newTestBus()
+		copy(b.Cartridge.PRG, []byte{0xAD, 0x02, 0x20}) // LDA $2002
+		b.Cartridge.PRG[0x3FFD] = 0x80                  // Reset vector $8000
+		c := cpu.New()
+		c.AttachBus(b)
+		b.AttachCPU(c)
+		c.Reset()
+		b.PPU.WriteRegister(0x2000, 0x80)
+
+		for b.PPU.Scanline() != 240 || b.PPU.Cycle() != 329+tt.dot {
+			b.PPU.Step()
+		}
+		c.Clock()
+		if b.PPU.Scanline() != 241 || b.PPU.Cycle() != tt.dot {
+			t.Errorf("dot %d: expected the read at line 241 dot %d, got line %d dot %d",
+				tt.dot, tt.dot, b.PPU.Scanline(), b.PPU.Cycle())
+		}
+		if got := c.A & 0x80; got != tt.wantStatus {
+			t.Errorf("dot %d: expected status $%02X, got $%02X", tt.dot, tt.wantStatus, got)
+		}
+		for c.CyclesLeft > 0 {
+			c.Clock()
+		}
+		if got := b.PPU.Cycle(); got != tt.dot {
+			t.Errorf("dot %d: expected the instruction to end on dot %d, got %d", tt.dot, tt.dot, got)
+		}
+		if b.PPU.NMIOccurred() != tt.wantNMI {
+			t.Errorf("dot %d: expected NMI %v", tt.dot, tt.wantNMI)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package bus
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/sergey121/nes-emulator/internal/ppu"
+)
+
+// Event is a CPU write to a PPU or mapper register, with the dot the PPU is
+// at on the cycle of the write, the last cycle of the instruction
+type Event struct {
+	Scanline, Cycle int
+	Addr            uint16
+	Value           byte
+}
+
+var registerNames = map[uint16]string{
+	0x2000: "PPUCTRL",
+	0x2001: "PPUMASK",
+	0x2002: "PPUSTATUS",
+	0x2003: "OAMADDR",
+	0x2004: "OAMDATA",
+	0x2005: "PPUSCROLL",
+	0x2006: "PPUADDR",
+	0x2007: "PPUDATA",
+	0x4014: "OAMDMA",
+}
+
+func (e Event) String() string {
+	name, ok := registerNames[e.Addr]
+	if !ok {
+		name = "mapper"
+	}
+	return fmt.Sprintf("L%3d D%3d $%04X %-9s = $%02X", e.Scanline, e.Cycle, e.Addr, name, e.Value)
+}
+
+// EventRecorder logs the register writes of every frame.
+// Set Bus.Events to start recording.
+type EventRecorder struct {
+	ppu *ppu.PPU
+
+	frame  int // Frame the events are from
+	events []Event
+	// Events of the frame before, and its number
+	done      []Event
+	doneFrame int
+}
+
+func NewEventRecorder(p *ppu.PPU) *EventRecorder {
+	return &EventRecorder{ppu: p, frame: p.FrameCount()}
+}
+
+// isEventRegister reports whether writes to addr are recorded: the PPU
+// registers, OAM DMA and the mapper registers. $6000-$7FFF is left out,
+// games use the PRG RAM there as work RAM.
+func isEventRegister(addr uint16) bool {
+	switch {
+	case addr >= 0x2000 && addr <= 0x3FFF, addr == 0x4014:
+		return true
+	case addr >= 0x4020 && addr <= 0x5FFF, addr >= 0x8000:
+		return true
+	}
+	return false
+}
+
+// record logs a write that happens delay dots after the current one.
+// A write that falls in the next frame is drawn at its top.
+func (r *EventRecorder) record(addr uint16, value byte, delay int) {
+	if addr < 0x4000 {
+		addr = 0x2000 + addr%8
+	}
+	if frame := r.ppu.FrameCount(); frame != r.frame {
+		r.done, r.events = r.events, r.done[:0]
+		r.doneFrame = r.frame
+		r.frame = frame
+	}
+	const dots = 341
+	dot := r.ppu.Scanline()*dots + r.ppu.Cycle() + delay
+	dot %= r.ppu.Timing().Scanlines * dots
+	r.events = append(r.events, Event{
+		Scanline: dot / dots,
+		Cycle:    dot % dots,
+		Addr:     addr,
+		Value:    value,
+	})
+}
+
+// Current returns the writes of the frame being rendered so far
+func (r *EventRecorder) Current() []Event {
+	if r.ppu.FrameCount() != r.frame {
+		return nil
+	}
+	return r.events
+}
+
+// LastFrame returns the writes of the last complete frame.
+// The slice is reused when the next frame starts.
+func (r *EventRecorder) LastFrame() []Event {
+	switch frame := r.ppu.FrameCount(); {
+	case frame == r.frame+1:
+		return r.events
+	case frame == r.frame && r.doneFrame == frame-1:
+		return r.done
+	}
+	return nil
+}
+
+// Background of the event grid
+var (
+	eventVisible   = color.RGBA{0x30, 0x30, 0x30, 0xFF}
+	eventHBlank    = color.RGBA{0x20, 0x20, 0x20, 0xFF}
+	eventVBlank    = color.RGBA{0x14, 0x14, 0x28, 0xFF}
+	eventPreRender = color.RGBA{0x28, 0x14, 0x14, 0xFF}
+)
+
+// EventColor returns the colour events of a register are drawn with
+func EventColor(addr uint16) color.RGBA {
+	switch addr {
+	case 0x2000:
+		return color.RGBA{0xFF, 0x40, 0x40, 0xFF}
+	case 0x2001:
+		return color.RGBA{0x40, 0xFF, 0x40, 0xFF}
+	case 0x2003, 0x2004:
+		return color.RGBA{0xFF, 0xA0, 0x00, 0xFF}
+	case 0x2005:
+		return color.RGBA{0xFF, 0xFF, 0x40, 0xFF}
+	case 0x2006:
+		return color.RGBA{0x40, 0xFF, 0xFF, 0xFF}
+	case 0x2007:
+		return color.RGBA{0x60, 0x80, 0xFF, 0xFF}
+	case 0x4014:
+		return color.RGBA{0xC0, 0x60, 0xFF, 0xFF}
+	case 0x2002:
+		return color.RGBA{0xA0, 0xA0, 0xA0, 0xFF}
+	}
+	// Mapper registers
+	return color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+}
+
+// EventImage draws events on a grid of one pixel per dot, 341 dots by the
+// scanlines of the frame. Each event is a small cross centred on its dot.
+func EventImage(events []Event, timing ppu.Timing) *image.RGBA {
+	const dots = 341
+	img := image.NewRGBA(image.Rect(0, 0, dots, timing.Scanlines))
+	for y := 0; y < timing.Scanlines; y++ {
+		for x := 0; x < dots; x++ {
+			c := eventHBlank
+			switch {
+			case y == timing.Scanlines-1:
+				c = eventPreRender
+			case y >= timing.VBlankLine:
+				c = eventVBlank
+			case y < ppu.ScreenHeight && x >= 1 && x <= ppu.ScreenWidth:
+				c = eventVisible
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	for _, e := range events {
+		c := EventColor(e.Addr)
+		for _, d := range [][2]int{{0, 0}, {-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+			// SetRGBA ignores the points outside the grid
+			img.SetRGBA(e.Cycle+d[0], e.Scanline+d[1], c)
+		}
+	}
+	return img
+}
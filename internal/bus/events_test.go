@@ -0,0 +1,91 @@
+package bus
+
+import (
+	"testing"
+
+	"github.com/sergey121/nes-emulator/internal/cpu"
+	"github.com/sergey121/nes-emulator/internal/ppu"
+)
+
+func TestEventRecorder(t *testing.T) {
+	b := newTestBus()
+	b.Events = NewEventRecorder(b.PPU)
+
+	for b.PPU.Scanline() != 32 {
+		b.PPU.Step()
+	}
+	b.CPUWrite(0x2005, 0x10)
+	b.CPUWrite(0x200D, 0x20) // Mirror of $2005
+	b.CPUWrite(0x0300, 0x30) // RAM is not recorded
+	b.CPUWrite(0x6000, 0x40) // Nor PRG RAM
+	b.CPUWrite(0x4014, 0x02)
+
+	events := b.Events.Current()
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %v", events)
+	}
+	if e := events[0]; e.Scanline != 32 || e.Addr != 0x2005 || e.Value != 0x10 {
+		t.Errorf("unexpected first event %v", e)
+	}
+	if e := events[1]; e.Addr != 0x2005 || e.Value != 0x20 {
+		t.Errorf("expected the mirror recorded as $2005, got %v", e)
+	}
+	if b.Events.LastFrame() != nil {
+		t.Errorf("expected no complete frame yet")
+	}
+
+	// The frame ends: its events become the last frame
+	frame := b.PPU.FrameCount()
+	for b.PPU.FrameCount() == frame {
+		b.PPU.Step()
+	}
+	if got := len(b.Events.LastFrame()); got != 3 {
+		t.Errorf("expected 3 events in the last frame, got %d", got)
+	}
+	if got := len(b.Events.Current()); got != 0 {
+		t.Errorf("expected no events in the new frame, got %d", got)
+	}
+	b.CPUWrite(0x2000, 0x80)
+	if got := b.Events.LastFrame(); len(got) != 3 || got[0].Value != 0x10 {
+		t.Errorf("expected the last frame kept, got %v", got)
+	}
+}
+
+// STA $2005 writes on its 4th cycle, 9 dots after it started on NTSC
+func TestEventWriteCycle(t *testing.T) {
+	b := newTestBus()
+	copy(b.Cartridge.PRG, []byte{0x8D, 0x05, 0x20}) // STA $2005
+	b.Cartridge.PRG[0x3FFD] = 0x80                  // Reset vector $8000
+	c := cpu.New()
+	c.AttachBus(b)
+	b.AttachCPU(c)
+	c.Reset()
+	b.Events = NewEventRecorder(b.PPU)
+
+	for b.PPU.Scanline() != 32 || b.PPU.Cycle() != 336 {
+		b.PPU.Step()
+	}
+	c.Clock()
+	events := b.Events.Current()
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %v", events)
+	}
+	// 3 dots per cycle: dot 339 after the first cycle, 9 more by the write
+	if e := events[0]; e.Scanline != 33 || e.Cycle != 7 {
+		t.Errorf("expected the write at line 33 dot 7, got %v", e)
+	}
+}
+
+func TestEventImage(t *testing.T) {
+	events := []Event{{Scanline: 100, Cycle: 200, Addr: 0x2006, Value: 0}}
+	img := EventImage(events, ppu.NTSCTiming)
+	if img.Rect.Dx() != 341 || img.Rect.Dy() != 262 {
+		t.Fatalf("expected a 341x262 grid, got %v", img.Rect)
+	}
+	if got := img.RGBAAt(200, 100); got != EventColor(0x2006) {
+		t.Errorf("expected the event colour, got %v", got)
+	}
+	if got := img.RGBAAt(10, 250); got != eventVBlank {
+		t.Errorf("expected the vblank background, got %v", got)
+	}
+}
@@ -0,0 +1,53 @@
+package bus
+
+import "github.com/sergey121/nes-emulator/internal/input"
+
+// Peek returns what CPURead would at addr without its side effects: VBlank
+// and the PPU write toggle stay, PPUDATA and the joypad reports do not
+// advance, the open bus keeps its value and OnAccess is not called.
+// Tracers, disassemblers and memory viewers read through it.
+func (b *Bus) Peek(addr uint16) byte {
+	switch {
+	case addr < 0x2000:
+		return b.RAM[addr%0x800]
+	case addr < 0x4000:
+		return b.PPU.PeekRegister(0x2000 + (addr % 8))
+	case addr == 0x4015:
+		return b.dataBus & 0x20
+	case addr == 0x4016:
+		return b.controllerPeek(b.Port1, 0)
+	case addr == 0x4017:
+		return b.controllerPeek(b.Port2, 1)
+	case addr >= 0x8000:
+		return b.Cartridge.Peek(addr)
+	default:
+		return b.dataBus
+	}
+}
+
+// controllerPeek is controllerRead without shifting the reports
+func (b *Bus) controllerPeek(device input.InputDevice, port int) byte {
+	var value byte
+	if device != nil {
+		value = device.Peek()
+	}
+	if b.Expansion != nil {
+		value |= b.Expansion.PeekPort(port)
+	}
+	return (b.dataBus & 0xE0) | (value & 0x1F)
+}
+
+// Poke stores value at addr without the side effects of CPUWrite: RAM,
+// what the PPU registers hold (see PPU.PokeRegister) and PRG ROM, which
+// it patches. Other addresses are ignored, OAM DMA and the joypad strobe
+// do not happen and the events and OnAccess do not see it.
+func (b *Bus) Poke(addr uint16, value byte) {
+	switch {
+	case addr < 0x2000:
+		b.RAM[addr%0x800] = value
+	case addr < 0x4000:
+		b.PPU.PokeRegister(0x2000+(addr%8), value)
+	case addr >= 0x8000:
+		b.Cartridge.Poke(addr, value)
+	}
+}
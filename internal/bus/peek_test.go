@@ -0,0 +1,50 @@
+package bus
+
+import (
+	"testing"
+
+	"github.com/sergey121/nes-emulator/internal/input"
+)
+
+func TestPeekHasNoSideEffects(t *testing.T) {
+	b := newTestBus()
+	b.Controller1.SetButtons(input.ButtonB)
+	b.CPUWrite(0x4016, 1)
+	b.CPUWrite(0x4016, 0)
+	b.PPU.PPUStatus = 0x80
+	var accesses int
+	b.OnAccess = func(uint16, byte, bool) { accesses++ }
+
+	// A peek returns what the read will, and the read still sees it
+	for i := 0; i < 3; i++ {
+		if got := b.Peek(0x2002) & 0x80; got != 0x80 {
+			t.Fatalf("peek %d of $2002: expected VBlank, got $%02X", i, got)
+		}
+		if got := b.Peek(0x4016) & 0x01; got != 0 {
+			t.Fatalf("peek %d of $4016: expected A released, got %d", i, got)
+		}
+	}
+	if accesses != 0 {
+		t.Errorf("expected no accesses for the hooks, got %d", accesses)
+	}
+	if got := b.CPURead(0x2002) & 0x80; got != 0x80 {
+		t.Errorf("expected VBlank after the peeks")
+	}
+	b.CPURead(0x4016)
+	if got, peek := b.Peek(0x4016)&0x01, b.CPURead(0x4016)&0x01; got != 1 || peek != got {
+		t.Errorf("expected B pressed from the peek and the read, got %d and %d", got, peek)
+	}
+}
+
+func TestPoke(t *testing.T) {
+	b := newTestBus()
+	b.Poke(0x0801, 0x12)
+	b.Poke(0xC000, 0x34) // 16KB PRG is mirrored at $C000
+	b.Poke(0x4016, 0x01) // The strobe is not written
+	if b.RAM[1] != 0x12 || b.Cartridge.PRG[0] != 0x34 || b.Peek(0x8000) != 0x34 {
+		t.Errorf("expected the pokes in RAM and PRG ROM")
+	}
+	if b.dataBus != 0 {
+		t.Errorf("expected the data bus unchanged, got $%02X", b.dataBus)
+	}
+}
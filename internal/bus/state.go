@@ -0,0 +1,44 @@
+package bus
+
+import (
+	"github.com/sergey121/nes-emulator/internal/cpu"
+	"github.com/sergey121/nes-emulator/internal/ppu"
+)
+
+// State is an in-memory snapshot of the console used for save states.
+// Controller shift registers are not included, games re-strobe them every frame.
+// CHR is shared with the cartridge, so CHR RAM contents are not restored.
+type State struct {
+	cpu     cpu.CPU
+	ppu     ppu.PPU
+	ram     [0x800]byte
+	dataBus byte
+	// PPU dots owed to the CPU on PAL, and run ahead of it
+	ppuFraction, ppuAhead int
+}
+
+// SaveState captures the current state of the CPU, PPU and RAM
+func (b *Bus) SaveState() *State {
+	return &State{
+		cpu:     *b.CPU,
+		ppu:     *b.PPU,
+		ram:     b.RAM,
+		dataBus: b.dataBus,
+
+		ppuFraction: b.ppuFraction,
+		ppuAhead:    b.ppuAhead,
+	}
+}
+
+// LoadState restores a snapshot taken by SaveState on the same bus
+func (b *Bus) LoadState(s *State) {
+	*b.CPU = s.cpu
+	// The palette and the sprite limit are display settings and the hook
+	// belongs to the debugger, keep the current ones
+	palette, unlimited, onAccess := b.PPU.Palette, b.PPU.UnlimitedSprites, b.PPU.OnAccess
+	*b.PPU = s.ppu
+	b.PPU.Palette, b.PPU.UnlimitedSprites, b.PPU.OnAccess = palette, unlimited, onAccess
+	b.RAM = s.ram
+	b.dataBus = s.dataBus
+	b.ppuFraction, b.ppuAhead = s.ppuFraction, s.ppuAhead
+}
@@ -0,0 +1,240 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Config holds the user settings of the frontend.
+// Inputs are stored by name (ebiten key names, standard gamepad button names)
+// so the file can be read and edited by hand.
+type Config struct {
+	Players [4]Player `json:"players"`
+	// Keys for the 12 buttons of the Power Pad / Family Trainer, numbered as on side B.
+	// With side A up they are mirrored, so every key keeps its place on the mat.
+	Mat     [12]string `json:"mat"`
+	Hotkeys Hotkeys    `json:"hotkeys"`
+	Video   Video      `json:"video"`
+	// Region forces the console timing: ntsc, pal or dendy.
+	// Empty uses the ROM header or file name.
+	Region string `json:"region"`
+}
+
+// Video holds the display settings
+type Video struct {
+	// Palette is a built-in preset name or the path of a .pal file
+	Palette string `json:"palette"`
+	// NTSC is the NTSC filter preset, empty when disabled
+	NTSC string `json:"ntsc"`
+	// Scaler is the pixel-art scaler, e.g. "xbrz3x", empty when disabled.
+	// It is not used together with the NTSC filter.
+	Scaler string `json:"scaler"`
+	// Scanlines is the darkness (0-1) of the CRT scanline overlay
+	Scanlines float64 `json:"scanlines"`
+	// Overscan is the number of NES pixels hidden on each side
+	Overscan Overscan `json:"overscan"`
+	// PixelAspect is "8:7" for the shape of pixels on a TV, or "1:1" for square pixels
+	PixelAspect string `json:"pixelAspect"`
+	// IntegerScaling only scales by whole numbers when the window is resized
+	IntegerScaling bool `json:"integerScaling"`
+	Fullscreen     bool `json:"fullscreen"`
+	// UnlimitedSprites draws every sprite of a line instead of the first 8,
+	// removing flicker. Games still see the hardware sprite limit.
+	UnlimitedSprites bool `json:"unlimitedSprites"`
+}
+
+// Overscan is the number of NES pixels cropped on each side of the picture
+type Overscan struct {
+	Top    int `json:"top"`
+	Bottom int `json:"bottom"`
+	Left   int `json:"left"`
+	Right  int `json:"right"`
+}
+
+// Player holds the bindings of one joypad
+type Player struct {
+	Keyboard Buttons `json:"keyboard"`
+	Gamepad  Gamepad `json:"gamepad"`
+	Turbo    Turbo   `json:"turbo"`
+	// AllowOpposite passes Left+Right and Up+Down to the game
+	AllowOpposite bool `json:"allowOpposite"`
+}
+
+// Turbo is the autofire rate in frames
+type Turbo struct {
+	On  int `json:"on"`
+	Off int `json:"off"`
+}
+
+// Buttons maps each NES button to the name of a host input.
+// Empty names are unbound.
+type Buttons struct {
+	A      string `json:"a"`
+	B      string `json:"b"`
+	Select string `json:"select"`
+	Start  string `json:"start"`
+	Up     string `json:"up"`
+	Down   string `json:"down"`
+	Left   string `json:"left"`
+	Right  string `json:"right"`
+	// Autofire versions of A and B
+	TurboA string `json:"turboA"`
+	TurboB string `json:"turboB"`
+}
+
+// ButtonNames lists the bindings of a joypad: the NES buttons in controller
+// report order followed by the autofire buttons
+var ButtonNames = [10]string{"A", "B", "Select", "Start", "Up", "Down", "Left", "Right", "Turbo A", "Turbo B"}
+
+// Fields returns pointers to the bindings in ButtonNames order,
+// so bit n of a controller state corresponds to Fields()[n].
+func (b *Buttons) Fields() [10]*string {
+	return [10]*string{&b.A, &b.B, &b.Select, &b.Start, &b.Up, &b.Down, &b.Left, &b.Right, &b.TurboA, &b.TurboB}
+}
+
+// Gamepad binds a connected gamepad to a player
+type Gamepad struct {
+	// Index of the gamepad in connection order, -1 disables the gamepad
+	Index   int     `json:"index"`
+	Buttons Buttons `json:"buttons"`
+	// AnalogStick makes the left stick act as the D-pad
+	AnalogStick bool `json:"analogStick"`
+	// Deadzone is the stick deflection (0-1) ignored around the center
+	Deadzone float64 `json:"deadzone"`
+}
+
+// Hotkeys are the keys for frontend actions
+type Hotkeys struct {
+	Reset       string `json:"reset"`
+	Pause       string `json:"pause"`
+	SaveState   string `json:"saveState"`
+	LoadState   string `json:"loadState"`
+	NextSlot    string `json:"nextSlot"`
+	FastForward string `json:"fastForward"`
+	Screenshot  string `json:"screenshot"`
+	Bindings    string `json:"bindings"`
+	NextPalette string `json:"nextPalette"`
+	NextFilter  string `json:"nextFilter"`
+	NextScaler  string `json:"nextScaler"`
+	Fullscreen  string `json:"fullscreen"`
+	// DebugView cycles the PPU debug views, DebugPalette their pattern table palette
+	DebugView    string `json:"debugView"`
+	DebugPalette string `json:"debugPalette"`
+	// Debugger opens the debugger overlay, which stops the console
+	Debugger string `json:"debugger"`
+}
+
+func defaultGamepad(index int) Gamepad {
+	return Gamepad{
+		Index: index,
+		Buttons: Buttons{
+			A:      "B",
+			B:      "A",
+			Select: "Back",
+			Start:  "Start",
+			Up:     "DPadUp",
+			Down:   "DPadDown",
+			Left:   "DPadLeft",
+			Right:  "DPadRight",
+			TurboA: "Y",
+			TurboB: "X",
+		},
+		AnalogStick: true,
+		Deadzone:    0.4,
+	}
+}
+
+func defaultPlayer(keyboard Buttons, gamepad int) Player {
+	return Player{
+		Keyboard: keyboard,
+		Gamepad:  defaultGamepad(gamepad),
+		Turbo:    Turbo{On: 2, Off: 2},
+	}
+}
+
+// Default returns the built-in bindings.
+// Turbo buttons are only bound on gamepads, the keyboard has no spare keys.
+func Default() *Config {
+	return &Config{
+		Players: [4]Player{
+			defaultPlayer(Buttons{A: "Z", B: "X", Select: "Shift", Start: "Enter", Up: "ArrowUp", Down: "ArrowDown", Left: "ArrowLeft", Right: "ArrowRight"}, 0),
+			defaultPlayer(Buttons{A: "G", B: "F", Select: "Q", Start: "E", Up: "W", Down: "S", Left: "A", Right: "D"}, 1),
+			defaultPlayer(Buttons{A: "Period", B: "Comma", Select: "U", Start: "O", Up: "I", Down: "K", Left: "J", Right: "L"}, 2),
+			defaultPlayer(Buttons{A: "Numpad3", B: "Numpad1", Select: "Numpad7", Start: "Numpad9", Up: "Numpad8", Down: "Numpad5", Left: "Numpad4", Right: "Numpad6"}, 3),
+		},
+		Mat: [12]string{
+			"R", "T", "Y", "U",
+			"F", "G", "H", "J",
+			"V", "B", "N", "M",
+		},
+		Hotkeys: Hotkeys{
+			Reset:        "F2",
+			Pause:        "F3",
+			SaveState:    "F5",
+			NextSlot:     "F6",
+			LoadState:    "F7",
+			FastForward:  "Tab",
+			Screenshot:   "F12",
+			Bindings:     "F1",
+			NextPalette:  "F8",
+			NextFilter:   "F9",
+			NextScaler:   "F10",
+			Fullscreen:   "F11",
+			DebugView:    "F4",
+			DebugPalette: "Backquote",
+			Debugger:     "Backslash",
+		},
+		Video: Video{
+			Palette: "2c02",
+			// The lines an NTSC TV does not show. PAL TVs show more of the
+			// 240 lines, but one crop for every region keeps the window the
+			// same size whatever game is loaded; set 0 to see them all.
+			Overscan:    Overscan{Top: 8, Bottom: 8},
+			PixelAspect: "1:1",
+		},
+	}
+}
+
+// DefaultPath returns the location of the config file in the user config directory
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "nes-emulator", "config.json"), nil
+}
+
+// Load reads the config file at path. Settings missing from the file keep
+// their default values, and a missing file yields the defaults.
+// Players missing from the "players" array are left unbound.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Save writes the config to path, creating the directory if needed
+func (c *Config) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadMissingFileReturnsDefaults(t *testing.T) {
+	cfg, err := Load(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.Players[0].Keyboard.A != "Z" {
+		t.Errorf("expected default binding Z for player 1 A, got %q", cfg.Players[0].Keyboard.A)
+	}
+}
+
+func TestLoadKeepsDefaultsForMissingSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"players": [{"keyboard": {"a": "K"}}], "hotkeys": {"pause": "P"}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.Players[0].Keyboard.A != "K" {
+		t.Errorf("expected A bound to K, got %q", cfg.Players[0].Keyboard.A)
+	}
+	if cfg.Players[0].Keyboard.B != "X" {
+		t.Errorf("expected B to keep default X, got %q", cfg.Players[0].Keyboard.B)
+	}
+	if cfg.Hotkeys.Pause != "P" || cfg.Hotkeys.Reset != "F2" {
+		t.Errorf("unexpected hotkeys %+v", cfg.Hotkeys)
+	}
+}
+
+func TestSaveRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "config.json")
+	cfg := Default()
+	cfg.Players[1].Gamepad.Deadzone = 0.25
+
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if *loaded != *cfg {
+		t.Errorf("loaded config differs from saved one")
+	}
+}
+
+func TestLoadKeepsDefaultOverscan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"video": {"overscan": {"left": 4}, "integerScaling": true}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := Overscan{Top: 8, Bottom: 8, Left: 4}
+	if cfg.Video.Overscan != want {
+		t.Errorf("expected overscan %+v, got %+v", want, cfg.Video.Overscan)
+	}
+	if !cfg.Video.IntegerScaling || cfg.Video.PixelAspect != "1:1" {
+		t.Errorf("unexpected video settings %+v", cfg.Video)
+	}
+}
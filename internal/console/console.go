@@ -0,0 +1,97 @@
+package console
+
+import (
+	"github.com/sergey121/nes-emulator/internal/apu"
+	"github.com/sergey121/nes-emulator/internal/bus"
+	"github.com/sergey121/nes-emulator/internal/cpu"
+	"github.com/sergey121/nes-emulator/internal/ppu"
+	"github.com/sergey121/nes-emulator/internal/rom"
+)
+
+// Console wires the CPU, PPU and cartridge together through the bus.
+// It has no display or input of its own, so frontends and headless
+// tools can share it.
+type Console struct {
+	CPU       *cpu.CPU
+	PPU       *ppu.PPU
+	Bus       *bus.Bus
+	Cartridge *rom.Cartridge
+
+	// APU periods of the current region
+	APUTiming *apu.Timing
+}
+
+// New powers on a console with the cartridge inserted
+func New(cartridge *rom.Cartridge) *Console {
+	ppuInstance := ppu.New(cartridge.CHR)
+	busInstance := bus.New(ppuInstance, cartridge)
+	cpuInstance := cpu.New()
+
+	cpuInstance.AttachBus(busInstance)
+	busInstance.AttachCPU(cpuInstance)
+
+	cpuInstance.Reset()
+
+	c := &Console{
+		CPU:       cpuInstance,
+		PPU:       ppuInstance,
+		Bus:       busInstance,
+		Cartridge: cartridge,
+	}
+	c.SetRegion(cartridge.Region)
+	return c
+}
+
+// Load reads a ROM file and powers on a console with it
+func Load(path string) (*Console, error) {
+	return LoadWith(path, nil)
+}
+
+// LoadWith is Load with a database for the regions and devices of iNES 1.0
+// ROMs, which may be nil
+func LoadWith(path string, db rom.Database) (*Console, error) {
+	cartridge, err := rom.LoadRomWith(path, db)
+	if err != nil {
+		return nil, err
+	}
+	return New(cartridge), nil
+}
+
+// Reset behaves like the console reset button
+func (c *Console) Reset() {
+	c.CPU.Reset()
+	c.PPU.Reset()
+}
+
+// StepFrame runs the console until the PPU finishes the current frame
+func (c *Console) StepFrame() {
+	frame := c.PPU.FrameCount()
+	for c.PPU.FrameCount() == frame {
+		c.CPU.Clock()
+	}
+}
+
+// Frame rates of the regions. The PAL and Dendy PPUs divide the same
+// 26.6 MHz master clock by 5, so they share the frame rate.
+var frameRates = map[rom.Region]float64{
+	rom.RegionNTSC:  5369318.0 / (341*262 - 0.5), // 60.0988 Hz, odd frames are one dot shorter
+	rom.RegionPAL:   26601712.0 / 5 / (341 * 312),
+	rom.RegionDendy: 26601712.0 / 5 / (341 * 312),
+}
+
+// SetRegion switches the CPU, PPU and APU timing, e.g. to play a
+// European game whose header does not say it is PAL
+func (c *Console) SetRegion(region rom.Region) {
+	c.Bus.SetRegion(region)
+	c.APUTiming = apu.TimingFor(c.Bus.Region())
+}
+
+// Region returns the current timing
+func (c *Console) Region() rom.Region {
+	return c.Bus.Region()
+}
+
+// FrameRate returns the number of frames per second of the current region
+func (c *Console) FrameRate() float64 {
+	return frameRates[c.Bus.Region()]
+}
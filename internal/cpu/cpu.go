@@ -6,6 +6,8 @@ import (
 
 type CPUBus interface {
 	CPURead(addr uint16) byte
+	// Peek reads like CPURead without side effects, for Trace and Disassemble
+	Peek(addr uint16) byte
 	CPUWrite(addr uint16, value byte)
 	ShouldTriggerNMI() bool
 	AcknowledgeNMI()
@@ -26,6 +28,9 @@ type CPU struct {
 
 	Bus        CPUBus
 	CyclesLeft int
+
+	// Labels names addresses in Trace, nil or "" for none
+	Labels func(addr uint16) string
 }
 
 func New() *CPU {
@@ -36,6 +41,11 @@ func New() *CPU {
 
 const ResetVector = 0xFFFC
 
+// nmiCycles is the length of the NMI sequence: 2 internal cycles, 3 pushes
+// and the vector. The sequence is a step of its own, like an instruction,
+// and the handler's first instruction runs on the next one.
+const nmiCycles = 7
+
 const (
 	FlagC = 1 << 0 // Carry Flag
 	FlagZ = 1 << 1 // Zero Flag
@@ -102,16 +112,15 @@ func (c *CPU) Pull16() uint16 {
 }
 
 func (cpu *CPU) Clock() {
-	// PPU тикает 3 раза за каждый такт CPU
-	cpu.Bus.StepPPU()
-	cpu.Bus.StepPPU()
-	cpu.Bus.StepPPU()
-
-	if cpu.CyclesLeft == 0 {
-		if cpu.Bus.ShouldTriggerNMI() {
-			cpu.TriggerNMI()
-			cpu.Bus.AcknowledgeNMI()
-		}
+	// PPU тикает 3 раза за каждый такт CPU (в среднем 3.2 на PAL)
+	cpu.Bus.ClockPPU()
+
+	if cpu.CyclesLeft == 0 && cpu.Bus.ShouldTriggerNMI() {
+		// The interrupt sequence takes the place of an instruction
+		cpu.TriggerNMI()
+		cpu.Bus.AcknowledgeNMI()
+		cpu.CyclesLeft = nmiCycles
+	} else if cpu.CyclesLeft == 0 {
 		opcode := cpu.Bus.CPURead(cpu.PC)
 		inst, ok := Instructions[opcode]
 		if !ok {
@@ -147,7 +156,7 @@ func (c *CPU) Execute() {
 }
 
 func (cpuInstance *CPU) Trace(ppuScanline, ppuCycle int) string {
-	opcode := cpuInstance.Bus.CPURead(cpuInstance.PC)
+	opcode := cpuInstance.Bus.Peek(cpuInstance.PC)
 	inst, ok := Instructions[opcode]
 
 	if !ok {
@@ -117,13 +117,14 @@ func (inst *Instruction) GetAddress(c *CPU) (uint16, bool) {
 }
 
 func ldaExecute(cpu *CPU, addr uint16, pageCrossed bool) {
+	// The extra cycle comes before the read, which is on the last cycle
+	if pageCrossed {
+		cpu.CyclesLeft += 1
+	}
 	value := cpu.Bus.CPURead(addr)
 	cpu.A = value
 	cpu.SetFlag(FlagZ, cpu.A == 0)
 	cpu.SetFlag(FlagN, (cpu.A&0x80) != 0)
-	if pageCrossed {
-		cpu.CyclesLeft += 1
-	}
 }
 
 func initLDAInstructions() {
@@ -319,14 +320,13 @@ func initLDXInstructions() {
 }
 
 func ldxExecute(cpu *CPU, addr uint16, pageCrossed bool) {
+	if pageCrossed {
+		cpu.CyclesLeft += 1
+	}
 	value := cpu.Bus.CPURead(addr)
 	cpu.X = value
 	cpu.SetFlag(FlagZ, cpu.X == 0)
 	cpu.SetFlag(FlagN, (cpu.X&0x80) != 0)
-
-	if pageCrossed {
-		cpu.CyclesLeft += 1
-	}
 }
 
 func initLDYInstructions() {
@@ -377,14 +377,13 @@ func initLDYInstructions() {
 }
 
 func ldyExecute(cpu *CPU, addr uint16, pageCrossing bool) {
+	if pageCrossing {
+		cpu.CyclesLeft += 1
+	}
 	value := cpu.Bus.CPURead(addr)
 	cpu.Y = value
 	cpu.SetFlag(FlagZ, cpu.Y == 0)
 	cpu.SetFlag(FlagN, (cpu.Y&0x80) != 0)
-
-	if pageCrossing {
-		cpu.CyclesLeft += 1
-	}
 }
 
 func initSTXInstructions() {
@@ -2150,14 +2149,14 @@ func initLAXInstructions() {
 		Cycles: 5, // +1 при page crossing
 		Mode:   IndirectY,
 		Execute: func(cpu *CPU, addr uint16, pageCrossed bool) {
+			if pageCrossed {
+				cpu.CyclesLeft += 1
+			}
 			value := cpu.Bus.CPURead(addr)
 			cpu.A = value
 			cpu.X = value
 			cpu.SetFlag(FlagZ, value == 0)
 			cpu.SetFlag(FlagN, value&0x80 != 0)
-			if pageCrossed {
-				cpu.CyclesLeft += 1
-			}
 		},
 		ModifiesPC: false,
 	}
@@ -2187,14 +2186,14 @@ func initLAXInstructions() {
 		Cycles: 4, // +1 при page crossing
 		Mode:   AbsoluteY,
 		Execute: func(cpu *CPU, addr uint16, pageCrossed bool) {
+			if pageCrossed {
+				cpu.CyclesLeft += 1
+			}
 			value := cpu.Bus.CPURead(addr)
 			cpu.A = value
 			cpu.X = value
 			cpu.SetFlag(FlagZ, value == 0)
 			cpu.SetFlag(FlagN, value&0x80 != 0)
-			if pageCrossed {
-				cpu.CyclesLeft += 1
-			}
 		},
 		ModifiesPC: false,
 	}
@@ -2729,15 +2728,68 @@ func initRRAInstructions() {
 	Instructions[0x7F] = Instruction{Name: "RRA Absolute,X Illegal", Opcode: 0x7F, Bytes: 3, Cycles: 7, Mode: AbsoluteX, Execute: rraExecute, ModifiesPC: false}
 }
 
+// Disassemble returns the bytes and the assembler syntax of the instruction
+// at addr, e.g. "20 0C 80 JSR UpdatePlayer" with labels from cpu.Labels
 func (inst *Instruction) Disassemble(cpu *CPU, addr uint16) string {
 	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf("%02X ", inst.Opcode))
 	if inst.Bytes > 1 {
-		sb.WriteString(fmt.Sprintf("%02X ", cpu.Bus.CPURead(addr+1)))
+		sb.WriteString(fmt.Sprintf("%02X ", cpu.Bus.Peek(addr+1)))
 	}
 	if inst.Bytes > 2 {
-		sb.WriteString(fmt.Sprintf("%02X ", cpu.Bus.CPURead(addr+2)))
+		sb.WriteString(fmt.Sprintf("%02X ", cpu.Bus.Peek(addr+2)))
 	}
-	sb.WriteString(inst.Name)
+	sb.WriteString(inst.Format(cpu.Bus.Peek, addr, cpu.Labels))
 	return sb.String()
 }
+
+// Format returns the instruction at addr in assembler syntax, e.g.
+// "JSR $800C". label, if not nil, names the addresses of operands:
+// "JSR UpdatePlayer". Addresses it returns "" for stay numbers.
+func (inst *Instruction) Format(read func(uint16) byte, addr uint16, label func(uint16) string) string {
+	lo := read(addr + 1)
+	word := uint16(lo) | uint16(read(addr+2))<<8
+	name := func(target uint16, digits int) string {
+		if label != nil {
+			if l := label(target); l != "" {
+				return l
+			}
+		}
+		return fmt.Sprintf("$%0*X", digits, target)
+	}
+
+	var operand string
+	switch inst.Mode {
+	case Immediate:
+		operand = fmt.Sprintf("#$%02X", lo)
+	case ZeroPage:
+		operand = name(uint16(lo), 2)
+	case ZeroPageX:
+		operand = name(uint16(lo), 2) + ",X"
+	case ZeroPageY:
+		operand = name(uint16(lo), 2) + ",Y"
+	case Absolute:
+		operand = name(word, 4)
+	case AbsoluteX:
+		operand = name(word, 4) + ",X"
+	case AbsoluteY:
+		operand = name(word, 4) + ",Y"
+	case Indirect:
+		operand = "(" + name(word, 4) + ")"
+	case IndirectX:
+		operand = "(" + name(uint16(lo), 2) + ",X)"
+	case IndirectY:
+		operand = "(" + name(uint16(lo), 2) + "),Y"
+	case Relative:
+		operand = name(addr+2+uint16(int8(lo)), 4)
+	case Accumulator:
+		operand = "A"
+	}
+
+	// Names carry the addressing mode, e.g. "LDA Immediate"
+	mnemonic, _, _ := strings.Cut(inst.Name, " ")
+	if operand == "" {
+		return mnemonic
+	}
+	return mnemonic + " " + operand
+}
@@ -0,0 +1,56 @@
+package cpu
+
+import "testing"
+
+// testBus is 64KB of RAM with an NMI line
+type testBus struct {
+	memory [0x10000]byte
+	nmi    bool
+}
+
+func (b *testBus) CPURead(addr uint16) byte         { return b.memory[addr] }
+func (b *testBus) Peek(addr uint16) byte            { return b.memory[addr] }
+func (b *testBus) CPUWrite(addr uint16, value byte) { b.memory[addr] = value }
+func (b *testBus) ShouldTriggerNMI() bool           { return b.nmi }
+func (b *testBus) AcknowledgeNMI()                  { b.nmi = false }
+func (b *testBus) ClockPPU()                        {}
+func (b *testBus) StepPPU()                         {}
+
+// The NMI takes 7 cycles of its own, the handler starts after them
+func TestNMI(t *testing.T) {
+	bus := &testBus{}
+	bus.memory[0x8000] = 0xEA                     // NOP
+	copy(bus.memory[0x9000:], []byte{0xA9, 0x01}) // LDA #$01
+	copy(bus.memory[0xFFFA:], []byte{0x00, 0x90, 0x00, 0x80})
+	cpu := New()
+	cpu.AttachBus(bus)
+	cpu.Reset()
+
+	bus.nmi = true
+	start := cpu.Cycles
+	cpu.Clock()
+	if cpu.PC != 0x9000 || cpu.A != 0 {
+		t.Fatalf("expected to enter the handler without running it, PC $%04X A $%02X", cpu.PC, cpu.A)
+	}
+	for cpu.CyclesLeft > 0 {
+		cpu.Clock()
+	}
+	if n := cpu.Cycles - start; n != nmiCycles {
+		t.Errorf("expected the NMI to take %d cycles, took %d", nmiCycles, n)
+	}
+	// The return address and P with B clear are on the stack
+	if ret := uint16(bus.memory[0x01FD])<<8 | uint16(bus.memory[0x01FC]); ret != 0x8000 {
+		t.Errorf("expected to return to $8000, got $%04X", ret)
+	}
+	if p := bus.memory[0x01FB]; p&FlagB != 0 || p&FlagU == 0 {
+		t.Errorf("unexpected pushed status $%02X", p)
+	}
+	if !cpu.GetFlag(FlagI) {
+		t.Errorf("expected interrupts disabled in the handler")
+	}
+
+	cpu.Clock()
+	if cpu.PC != 0x9002 || cpu.A != 0x01 {
+		t.Errorf("expected the handler's first instruction next, PC $%04X A $%02X", cpu.PC, cpu.A)
+	}
+}
@@ -0,0 +1,562 @@
+// Package dap serves the Debug Adapter Protocol, so editors like VS Code can
+// debug ca65 programs by source line. The adapter is cmd/dap, talking over
+// stdin and stdout; a launch configuration looks like
+//
+//	{"type": "nes", "request": "launch", "program": "game.nes", "stopOnEntry": true}
+//
+// Source lines and labels come from the ld65 debug file and FCEUX .nl files
+// next to the program, see symbols.LoadFor, or the file given as "symbols".
+// Conditions of breakpoints and the watch and hover expressions use the
+// syntax of the debugger, e.g. A==$10 && [$0300]>5, and the debug console
+// runs its commands.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/sergey121/nes-emulator/internal/console"
+	"github.com/sergey121/nes-emulator/internal/debugger"
+	"github.com/sergey121/nes-emulator/internal/symbols"
+)
+
+// threadID is the CPU, the only thread
+const threadID = 1
+
+// Variable references of the scopes. A page of RAM is pageReference + page.
+const (
+	registersReference = 1
+	flagsReference     = 2
+	memoryReference    = 3
+	pageReference      = 0x100
+	ramPages           = 8
+)
+
+var errNotLaunched = errors.New("no program launched")
+
+type capabilities struct {
+	SupportsConfigurationDoneRequest bool              `json:"supportsConfigurationDoneRequest"`
+	SupportsConditionalBreakpoints   bool              `json:"supportsConditionalBreakpoints"`
+	SupportsEvaluateForHovers        bool              `json:"supportsEvaluateForHovers"`
+	SupportsTerminateRequest         bool              `json:"supportsTerminateRequest"`
+	ExceptionBreakpointFilters       []exceptionFilter `json:"exceptionBreakpointFilters"`
+}
+
+// server is a debug session. Requests are handled between frames while the
+// console runs, so pause and new breakpoints take effect right away.
+type server struct {
+	w      io.Writer
+	seq    int
+	events []event // Sent after the response of the current request
+
+	console     *console.Console
+	d           *debugger.Debugger
+	symbols     *symbols.Table // nil without debug information
+	stopOnEntry bool
+
+	// Debugger breakpoints of each source, and the DAP breakpoint of each
+	// debugger one: a line of a macro used twice has two
+	sourceBreakpoints map[string][]int
+	dapIDs            map[int]int
+}
+
+// Serve runs a session until the client disconnects or r ends
+func Serve(r io.Reader, w io.Writer) error {
+	s := &server{
+		w:                 w,
+		sourceBreakpoints: map[string][]int{},
+		dapIDs:            map[int]int{},
+	}
+
+	requests := make(chan request)
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		errs <- readRequests(r, requests, done)
+		close(requests)
+	}()
+
+	for {
+		var req request
+		var ok bool
+		if s.d != nil && s.d.Running() {
+			select {
+			case req, ok = <-requests:
+			default:
+				if stop := s.d.RunFrame(); stop != nil {
+					s.stopped(stop)
+					if err := s.flush(); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+		} else {
+			req, ok = <-requests
+		}
+		if !ok {
+			return <-errs
+		}
+
+		end, err := s.handle(req)
+		if err != nil || end {
+			return err
+		}
+	}
+}
+
+// readRequests decodes requests until r ends or done is closed
+func readRequests(r io.Reader, requests chan<- request, done <-chan struct{}) error {
+	br := bufio.NewReader(r)
+	for {
+		body, err := readMessage(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			return err
+		}
+		select {
+		case requests <- req:
+		case <-done:
+			return nil
+		}
+	}
+}
+
+func (s *server) nextSeq() int {
+	s.seq++
+	return s.seq
+}
+
+func (s *server) event(name string, body any) {
+	s.events = append(s.events, event{Type: "event", Event: name, Body: body})
+}
+
+// flush sends the queued events
+func (s *server) flush() error {
+	for _, e := range s.events {
+		e.Seq = s.nextSeq()
+		if err := writeMessage(s.w, e); err != nil {
+			return err
+		}
+	}
+	s.events = s.events[:0]
+	return nil
+}
+
+// handle answers a request and returns whether the session ends
+func (s *server) handle(req request) (bool, error) {
+	body, err := s.dispatch(req)
+	resp := response{
+		Seq:        s.nextSeq(),
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Success:    err == nil,
+		Command:    req.Command,
+		Body:       body,
+	}
+	if err != nil {
+		resp.Message = err.Error()
+	}
+	if err := writeMessage(s.w, resp); err != nil {
+		return false, err
+	}
+	end := req.Command == "disconnect" || req.Command == "terminate"
+	return end, s.flush()
+}
+
+func (s *server) dispatch(req request) (any, error) {
+	if s.d == nil {
+		switch req.Command {
+		case "initialize", "launch", "disconnect", "terminate", "threads":
+		default:
+			return nil, errNotLaunched
+		}
+	}
+
+	switch req.Command {
+	case "initialize":
+		return capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsConditionalBreakpoints:   true,
+			SupportsEvaluateForHovers:        true,
+			SupportsTerminateRequest:         true,
+			ExceptionBreakpointFilters: []exceptionFilter{
+				{Filter: "nmi", Label: "NMI"},
+				{Filter: "irq", Label: "IRQ"},
+				{Filter: "brk", Label: "BRK"},
+			},
+		}, nil
+	case "launch":
+		var args launchArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return nil, s.launch(args)
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return map[string]any{"breakpoints": s.setBreakpoints(args)}, nil
+	case "setExceptionBreakpoints":
+		var args setExceptionBreakpointsArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		s.d.BreakOnNMI, s.d.BreakOnIRQ, s.d.BreakOnBRK = false, false, false
+		for _, f := range args.Filters {
+			switch f {
+			case "nmi":
+				s.d.BreakOnNMI = true
+			case "irq":
+				s.d.BreakOnIRQ = true
+			case "brk":
+				s.d.BreakOnBRK = true
+			}
+		}
+		return nil, nil
+	case "configurationDone":
+		if s.stopOnEntry {
+			s.stopped(&debugger.Stop{Reason: "entry"})
+		} else {
+			s.d.Continue()
+		}
+		return nil, nil
+	case "threads":
+		return map[string]any{"threads": []thread{{ID: threadID, Name: "CPU"}}}, nil
+	case "stackTrace":
+		var args stackTraceArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.stackTrace(args), nil
+	case "scopes":
+		return map[string]any{"scopes": []scope{
+			{Name: "Registers", VariablesReference: registersReference},
+			{Name: "Flags", VariablesReference: flagsReference},
+			{Name: "RAM", VariablesReference: memoryReference},
+		}}, nil
+	case "variables":
+		var args variablesArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		vars, err := s.variables(args.VariablesReference)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"variables": vars}, nil
+	case "evaluate":
+		var args evaluateArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		result, err := s.evaluate(args)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"result": result, "variablesReference": 0}, nil
+
+	case "continue":
+		s.d.Continue()
+		return map[string]any{"allThreadsContinued": true}, nil
+	case "next":
+		if stop := s.d.StepOver(); stop != nil {
+			s.stopped(stop)
+		}
+		return nil, nil
+	case "stepIn":
+		s.stopped(s.d.Step())
+		return nil, nil
+	case "stepOut":
+		s.d.StepOut()
+		return nil, nil
+	case "pause":
+		if s.d.Running() {
+			// The stop is reported by the run loop
+			s.d.Interrupt()
+		}
+		return nil, nil
+	case "disconnect":
+		if s.d != nil {
+			s.d.Detach()
+		}
+		return nil, nil
+	case "terminate":
+		s.event("terminated", nil)
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported request %q", req.Command)
+}
+
+// launch loads the program, stopped until configurationDone
+func (s *server) launch(args launchArguments) error {
+	if s.d != nil {
+		return errors.New("a program is running already")
+	}
+	if args.Program == "" {
+		return errors.New("missing program")
+	}
+	c, err := console.Load(args.Program)
+	if err != nil {
+		return err
+	}
+
+	if args.Symbols != "" {
+		s.symbols = symbols.New()
+		if filepath.Ext(args.Symbols) == ".nl" {
+			err = s.symbols.LoadNL(args.Symbols)
+		} else {
+			err = s.symbols.LoadDbg(args.Symbols)
+		}
+	} else {
+		s.symbols, err = symbols.LoadFor(args.Program)
+	}
+	if err != nil {
+		return err
+	}
+	if s.symbols == nil {
+		s.output("No debug information, breakpoints by line are not available\n")
+	}
+
+	s.console = c
+	s.d = debugger.New(c)
+	if s.symbols != nil {
+		s.d.SetSymbols(s.symbols)
+	}
+	s.stopOnEntry = args.StopOnEntry
+	s.event("initialized", nil)
+	return nil
+}
+
+func (s *server) output(text string) {
+	s.event("output", map[string]any{"category": "console", "output": text})
+}
+
+// setBreakpoints replaces the breakpoints of a source file
+func (s *server) setBreakpoints(args setBreakpointsArguments) []breakpoint {
+	path := args.Source.Path
+	for _, id := range s.sourceBreakpoints[path] {
+		s.d.DeleteBreakpoint(id)
+		delete(s.dapIDs, id)
+	}
+	delete(s.sourceBreakpoints, path)
+
+	result := make([]breakpoint, len(args.Breakpoints))
+	for i, sb := range args.Breakpoints {
+		bp := &result[i]
+		bp.Line = sb.Line
+		if s.symbols == nil {
+			bp.Message = "No debug information"
+			continue
+		}
+		line, addrs, ok := s.symbols.Find(path, sb.Line)
+		if !ok {
+			bp.Message = "No code at or after this line"
+			continue
+		}
+		var cond *debugger.Expr
+		if sb.Condition != "" {
+			var err error
+			if cond, err = s.d.ParseExpr(sb.Condition); err != nil {
+				bp.Message = err.Error()
+				continue
+			}
+		}
+
+		for _, addr := range addrs {
+			id := s.d.AddBreakpoint(debugger.Breakpoint{Kind: debugger.Exec, Start: addr, End: addr, Condition: cond}).ID
+			s.sourceBreakpoints[path] = append(s.sourceBreakpoints[path], id)
+			if bp.ID == 0 {
+				bp.ID = id
+			}
+			s.dapIDs[id] = bp.ID
+		}
+		bp.Verified = true
+		bp.Line = line.Line
+	}
+	return result
+}
+
+// stopReasons are the DAP reasons of the debugger stops. The others, the
+// scanline and frame targets of the debug console, are shown as a pause.
+var stopReasons = map[string]string{
+	"NMI":         "exception",
+	"IRQ":         "exception",
+	"BRK":         "exception",
+	"entry":       "entry",
+	"step":        "step",
+	"step over":   "step",
+	"step out":    "step",
+	"breakpoint":  "breakpoint",
+	"watchpoint":  "data breakpoint",
+	"interrupted": "pause",
+}
+
+func (s *server) stopped(stop *debugger.Stop) {
+	reason, ok := stopReasons[stop.Reason]
+	if !ok {
+		reason = "pause"
+	}
+	body := map[string]any{
+		"reason":            reason,
+		"description":       stop.String(),
+		"threadId":          threadID,
+		"allThreadsStopped": true,
+	}
+	if stop.Breakpoint != nil {
+		if id, ok := s.dapIDs[stop.Breakpoint.ID]; ok {
+			body["hitBreakpointIds"] = []int{id}
+		}
+	}
+	s.event("stopped", body)
+}
+
+// stackTrace returns PC and the calls found on the stack
+func (s *server) stackTrace(args stackTraceArguments) map[string]any {
+	addrs := append([]uint16{s.console.CPU.PC}, s.d.CallStack()...)
+	frames := []stackFrame{}
+	for i, addr := range addrs {
+		if i < args.StartFrame || args.Levels > 0 && len(frames) == args.Levels {
+			continue
+		}
+		name := s.d.Routine(addr)
+		if name == "" {
+			name = fmt.Sprintf("$%04X", addr)
+		}
+		frame := stackFrame{
+			ID:                          i + 1,
+			Name:                        name,
+			InstructionPointerReference: fmt.Sprintf("0x%04X", addr),
+		}
+		if s.symbols != nil {
+			if line, ok := s.symbols.LineAt(addr); ok {
+				frame.Source = &source{Name: filepath.Base(line.File), Path: line.File}
+				frame.Line = line.Line
+				frame.Column = 1
+			}
+		}
+		frames = append(frames, frame)
+	}
+	return map[string]any{"stackFrames": frames, "totalFrames": len(addrs)}
+}
+
+func hexVariable(name string, value int, digits int) variable {
+	return variable{Name: name, Value: fmt.Sprintf("$%0*X", digits, value)}
+}
+
+// pageNames name the first pages of RAM, the others are plain RAM
+var pageNames = []string{"Zero page", "Stack"}
+
+func (s *server) variables(ref int) ([]variable, error) {
+	c := s.console.CPU
+	switch {
+	case ref == registersReference:
+		return []variable{
+			hexVariable("A", int(c.A), 2),
+			hexVariable("X", int(c.X), 2),
+			hexVariable("Y", int(c.Y), 2),
+			hexVariable("SP", int(c.SP), 2),
+			hexVariable("PC", int(c.PC), 4),
+			hexVariable("P", int(c.P), 2),
+		}, nil
+	case ref == flagsReference:
+		var vars []variable
+		for i, name := range []string{"N", "V", "", "B", "D", "I", "Z", "C"} {
+			if name != "" {
+				vars = append(vars, variable{Name: name, Value: fmt.Sprint(c.P >> (7 - i) & 1)})
+			}
+		}
+		return vars, nil
+	case ref == memoryReference:
+		vars := make([]variable, ramPages)
+		for page := range vars {
+			name := "RAM"
+			if page < len(pageNames) {
+				name = pageNames[page]
+			}
+			vars[page] = variable{
+				Name:               fmt.Sprintf("$%04X-$%04X", page<<8, page<<8|0xFF),
+				Value:              name,
+				VariablesReference: pageReference + page,
+			}
+		}
+		return vars, nil
+	case ref >= pageReference && ref < pageReference+ramPages:
+		base := uint16(ref-pageReference) << 8
+		vars := make([]variable, 16)
+		for row := range vars {
+			addr := base + uint16(row*16)
+			bytes := make([]string, 16)
+			for i := range bytes {
+				bytes[i] = fmt.Sprintf("%02X", s.d.Peek(addr+uint16(i)))
+			}
+			vars[row] = variable{Name: fmt.Sprintf("$%04X", addr), Value: strings.Join(bytes, " ")}
+		}
+		return vars, nil
+	}
+	return nil, fmt.Errorf("unknown variables reference %d", ref)
+}
+
+// evaluate runs a debugger command typed in the debug console, and
+// evaluates the expressions of watches and hovers
+func (s *server) evaluate(args evaluateArguments) (string, error) {
+	if args.Context == "repl" {
+		var out strings.Builder
+		pc, cycles := s.console.CPU.PC, s.console.CPU.Cycles
+		err := s.d.Exec(args.Expression, &out)
+		if err == debugger.ErrQuit {
+			return "", errors.New("stop the session to quit")
+		}
+		// Steps and resets move the CPU, the editor shows the new position
+		moved := s.console.CPU.PC != pc || s.console.CPU.Cycles != cycles
+		if moved && !s.d.Running() && s.d.LastStop() != nil {
+			s.stopped(s.d.LastStop())
+		}
+		return strings.TrimSuffix(out.String(), "\n"), err
+	}
+	e, err := s.d.ParseExpr(args.Expression)
+	if err != nil {
+		return "", err
+	}
+	v := s.d.Eval(e)
+	if s.symbols != nil {
+		// A variable shows its value rather than its address
+		if sym, ok := s.symbols.Lookup(strings.TrimSpace(args.Expression)); ok && sym.PRG < 0 {
+			return s.variableValue(sym), nil
+		}
+	}
+	return fmt.Sprintf("$%X (%d)", v, v), nil
+}
+
+// maxHoverBytes limits the bytes shown of an array
+const maxHoverBytes = 16
+
+// variableValue returns the value of a variable in RAM, the bytes of an array
+func (s *server) variableValue(sym symbols.Symbol) string {
+	if sym.Size == 1 {
+		v := s.d.Peek(sym.Addr)
+		return fmt.Sprintf("$%02X (%d) at $%04X", v, v, sym.Addr)
+	}
+	bytes := make([]string, min(sym.Size, maxHoverBytes))
+	for i := range bytes {
+		bytes[i] = fmt.Sprintf("%02X", s.d.Peek(sym.Addr+uint16(i)))
+	}
+	text := strings.Join(bytes, " ")
+	if sym.Size > maxHoverBytes {
+		text += " ..."
+	}
+	return fmt.Sprintf("%s at $%04X", text, sym.Addr)
+}
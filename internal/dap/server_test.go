@@ -0,0 +1,274 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testSource is main.s of the test program, assembled at $8000
+var testSource = []struct {
+	line  int
+	bytes []byte
+}{
+	{3, []byte{0xA9, 0x10}},       // reset: lda #$10
+	{4, []byte{0x8D, 0x00, 0x03}}, //        sta $0300
+	{5, []byte{0x20, 0x0C, 0x80}}, //        jsr sub
+	{6, []byte{0xE8}},             // loop:  inx
+	{7, []byte{0x4C, 0x08, 0x80}}, //        jmp loop
+	{9, []byte{0xA0, 0x05}},       // sub:   ldy #$05
+	{10, []byte{0x60}},            //        rts
+}
+
+// writeTestProgram writes game.nes and the game.dbg ld65 would write for it
+func writeTestProgram(t *testing.T) (dir string) {
+	dir = t.TempDir()
+	prg := make([]byte, 0x8000)
+	var dbg strings.Builder
+	dbg.WriteString("version\tmajor=2,minor=0\n")
+	dbg.WriteString("file\tid=0,name=\"main.s\",size=100,mtime=0x66000000,mod=0\n")
+	dbg.WriteString("seg\tid=0,name=\"CODE\",start=0x008000,size=0x0010,addrsize=absolute,type=ro,oname=\"game.nes\",ooffs=16\n")
+	offset := 0
+	for i, l := range testSource {
+		copy(prg[offset:], l.bytes)
+		fmt.Fprintf(&dbg, "line\tid=%d,file=0,line=%d,span=%d\n", i, l.line, i)
+		fmt.Fprintf(&dbg, "span\tid=%d,seg=0,start=%d,size=%d\n", i, offset, len(l.bytes))
+		offset += len(l.bytes)
+	}
+	for i, sym := range []struct {
+		name string
+		addr int
+		seg  string
+	}{{"reset", 0x8000, ",seg=0"}, {"loop", 0x8008, ",seg=0"}, {"sub", 0x800C, ",seg=0"}, {"score", 0x0300, ""}} {
+		fmt.Fprintf(&dbg, "sym\tid=%d,name=\"%s\",addrsize=absolute,scope=0,def=0,val=0x%X%s,type=lab\n", i, sym.name, sym.addr, sym.seg)
+	}
+	copy(prg[0x7FFA:], []byte{0x08, 0x80, 0x00, 0x80, 0x08, 0x80})
+
+	header := []byte{'N', 'E', 'S', 0x1A, 2, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	rom := append(append(header, prg...), make([]byte, 0x2000)...)
+	if err := os.WriteFile(filepath.Join(dir, "game.nes"), rom, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "game.dbg"), []byte(dbg.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// client is a scripted editor talking to Serve over pipes, as over stdio
+type client struct {
+	t      *testing.T
+	w      io.Writer
+	r      *bufio.Reader
+	seq    int
+	events []map[string]any // Received and not expected yet
+}
+
+type message map[string]any
+
+func (c *client) read() message {
+	c.t.Helper()
+	body, err := readMessage(c.r)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	var m message
+	if err := json.Unmarshal(body, &m); err != nil {
+		c.t.Fatal(err)
+	}
+	return m
+}
+
+// request sends a request and returns the body of its successful response
+func (c *client) request(command string, args any) message {
+	c.t.Helper()
+	c.seq++
+	if err := writeMessage(c.w, map[string]any{"seq": c.seq, "type": "request", "command": command, "arguments": args}); err != nil {
+		c.t.Fatal(err)
+	}
+	for {
+		m := c.read()
+		if m["type"] == "event" {
+			c.events = append(c.events, m)
+			continue
+		}
+		if m["request_seq"] != float64(c.seq) || m["command"] != command {
+			c.t.Fatalf("unexpected response %v to %s", m, command)
+		}
+		if m["success"] != true {
+			c.t.Fatalf("%s failed: %v", command, m["message"])
+		}
+		body, _ := m["body"].(map[string]any)
+		return body
+	}
+}
+
+// event waits for an event and returns its body
+func (c *client) event(name string) message {
+	c.t.Helper()
+	for {
+		if len(c.events) == 0 {
+			c.events = append(c.events, c.read())
+		}
+		m := c.events[0]
+		c.events = c.events[1:]
+		if m["event"] == name {
+			body, _ := m["body"].(map[string]any)
+			return body
+		}
+		if m["event"] != "output" {
+			c.t.Fatalf("expected a %s event, got %v", name, m)
+		}
+	}
+}
+
+// stopped waits for a stop and returns its reason and the top frame
+func (c *client) stopped() (string, message) {
+	c.t.Helper()
+	reason := c.event("stopped")["reason"].(string)
+	frames := c.request("stackTrace", map[string]any{"threadId": 1})["stackFrames"].([]any)
+	return reason, frames[0].(map[string]any)
+}
+
+func expectLine(t *testing.T, frame message, line int) {
+	t.Helper()
+	if frame["line"] != float64(line) {
+		t.Errorf("expected line %d, got frame %v", line, frame)
+	}
+}
+
+func TestSession(t *testing.T) {
+	dir := writeTestProgram(t)
+	toServer, in := io.Pipe()
+	out, fromServer := io.Pipe()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- Serve(toServer, fromServer)
+		fromServer.Close()
+	}()
+	c := &client{t: t, w: in, r: bufio.NewReader(out)}
+
+	caps := c.request("initialize", map[string]any{"adapterID": "nes"})
+	if caps["supportsConfigurationDoneRequest"] != true {
+		t.Errorf("unexpected capabilities %v", caps)
+	}
+	c.request("launch", map[string]any{"program": filepath.Join(dir, "game.nes"), "stopOnEntry": true})
+	c.event("initialized")
+
+	// Line 8 has no code, the breakpoint moves to 9
+	bps := c.request("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": filepath.Join(dir, "main.s")},
+		"breakpoints": []any{map[string]any{"line": 8}, map[string]any{"line": 6, "condition": "X==2"}, map[string]any{"line": 50}},
+	})["breakpoints"].([]any)
+	for i, want := range []struct {
+		verified bool
+		line     int
+	}{{true, 9}, {true, 6}, {false, 50}} {
+		bp := bps[i].(map[string]any)
+		if bp["verified"] != want.verified || bp["line"] != float64(want.line) {
+			t.Errorf("breakpoint %d: expected %v, got %v", i, want, bp)
+		}
+	}
+	c.request("setExceptionBreakpoints", map[string]any{"filters": []string{}})
+	c.request("configurationDone", nil)
+
+	reason, frame := c.stopped()
+	if reason != "entry" {
+		t.Errorf("expected to stop on entry, got %s", reason)
+	}
+	expectLine(t, frame, 3)
+
+	c.request("continue", map[string]any{"threadId": 1})
+	reason, frame = c.stopped()
+	if reason != "breakpoint" {
+		t.Errorf("expected a breakpoint, got %s", reason)
+	}
+	expectLine(t, frame, 9)
+	frames := c.request("stackTrace", map[string]any{"threadId": 1})["stackFrames"].([]any)
+	if len(frames) != 2 {
+		t.Fatalf("expected the caller on the stack, got %v", frames)
+	}
+	expectLine(t, frames[1].(map[string]any), 5)
+	if a, b := frames[0].(map[string]any)["name"], frames[1].(map[string]any)["name"]; a != "sub" || b != "reset+5" {
+		t.Errorf("expected frames sub and reset+5, got %v and %v", a, b)
+	}
+
+	scopes := c.request("scopes", map[string]any{"frameId": 1})["scopes"].([]any)
+	ref := scopes[0].(map[string]any)["variablesReference"]
+	regs := c.request("variables", map[string]any{"variablesReference": ref})["variables"].([]any)
+	if a := regs[0].(map[string]any); a["name"] != "A" || a["value"] != "$10" {
+		t.Errorf("expected A=$10, got %v", a)
+	}
+	rows := c.request("variables", map[string]any{"variablesReference": pageReference + 3})["variables"].([]any)
+	if row := rows[0].(map[string]any); !strings.HasPrefix(row["value"].(string), "10 00") {
+		t.Errorf("expected $10 at $0300, got %v", row)
+	}
+
+	c.request("stepOut", map[string]any{"threadId": 1})
+	reason, frame = c.stopped()
+	if reason != "step" {
+		t.Errorf("expected a step, got %s", reason)
+	}
+	expectLine(t, frame, 6)
+
+	// The condition skips the first passes of the loop
+	c.request("continue", map[string]any{"threadId": 1})
+	_, frame = c.stopped()
+	expectLine(t, frame, 6)
+	if x := c.request("evaluate", map[string]any{"expression": "X", "context": "hover"})["result"]; x != "$2 (2)" {
+		t.Errorf("expected X=2, got %v", x)
+	}
+	if v := c.request("evaluate", map[string]any{"expression": "score", "context": "hover"})["result"]; v != "$10 (16) at $0300" {
+		t.Errorf("expected the value of score, got %v", v)
+	}
+
+	c.request("next", map[string]any{"threadId": 1})
+	_, frame = c.stopped()
+	expectLine(t, frame, 7)
+	// Commands of the debug console move the editor too
+	if out := c.request("evaluate", map[string]any{"expression": "step", "context": "repl"})["result"]; !strings.Contains(out.(string), "8008  INX") {
+		t.Errorf("unexpected output of step: %v", out)
+	}
+	_, frame = c.stopped()
+	expectLine(t, frame, 6)
+
+	c.request("setBreakpoints", map[string]any{"source": map[string]any{"path": filepath.Join(dir, "main.s")}, "breakpoints": []any{}})
+	c.request("continue", map[string]any{"threadId": 1})
+	c.request("pause", map[string]any{"threadId": 1})
+	if reason, _ := c.stopped(); reason != "pause" {
+		t.Errorf("expected a pause, got %s", reason)
+	}
+
+	c.request("disconnect", nil)
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequestsBeforeLaunch(t *testing.T) {
+	var out strings.Builder
+	in := &strings.Builder{}
+	writeMessage(in, map[string]any{"seq": 1, "type": "request", "command": "stackTrace"})
+	writeMessage(in, map[string]any{"seq": 2, "type": "request", "command": "launch", "arguments": map[string]any{"program": "missing.nes"}})
+	if err := Serve(strings.NewReader(in.String()), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(strings.NewReader(out.String()))
+	for _, want := range []string{errNotLaunched.Error(), "missing.nes"} {
+		body, err := readMessage(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp response
+		json.Unmarshal(body, &resp)
+		if resp.Success || !strings.Contains(resp.Message, want) {
+			t.Errorf("expected an error with %q, got %+v", want, resp)
+		}
+	}
+}
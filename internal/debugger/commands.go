@@ -0,0 +1,362 @@
+package debugger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrQuit is returned by Exec for the quit command
+var ErrQuit = errors.New("quit")
+
+const help = `Commands:
+  break|b ADDR[-END] [if COND]       stop before running an address
+  watch|w [read|write|change] [ppu] ADDR[-END] [if COND]
+                                     stop on an access, write by default
+  delete|d ID|all, enable ID, disable ID, list|l
+  catch nmi|irq|brk [off]            stop on interrupts or BRK
+  continue|c                         run until the next stop
+  step|s [N], next|n, out|o          step, step over JSR, run until RTS/RTI
+  scanline N, frame [N]              run until a scanline or the next or given frame
+  regs|r, mem|m ADDR [LEN], ppumem ADDR [LEN], backtrace|bt
+  print|p EXPR, dis|u [ADDR] [N], reset, quit|q
+Expressions: A==$10 && [$0300]>5, see the documentation of ParseExpr.
+With symbols loaded labels work as addresses: b UpdatePlayer, w buffer.
+An empty line repeats the last command.`
+
+// Exec runs one command and writes its output to out.
+// Commands that run the console only start it, see RunFrame.
+func (d *Debugger) Exec(line string, out io.Writer) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	cmd, args := strings.ToLower(fields[0]), fields[1:]
+	rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), fields[0]))
+
+	switch cmd {
+	case "help", "h", "?":
+		fmt.Fprintln(out, help)
+	case "quit", "q":
+		return ErrQuit
+
+	case "break", "b":
+		bp, err := d.parseBreakpoint(Exec, CPUSpace, rest)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, d.AddBreakpoint(bp))
+	case "watch", "w":
+		kind, space := Write, CPUSpace
+	options:
+		for len(args) > 0 {
+			switch strings.ToLower(args[0]) {
+			case "read", "r":
+				kind = Read
+			case "write", "w":
+				kind = Write
+			case "change":
+				kind = Change
+			case "ppu":
+				space = PPUSpace
+			default:
+				break options
+			}
+			rest = strings.TrimSpace(strings.TrimPrefix(rest, args[0]))
+			args = args[1:]
+		}
+		bp, err := d.parseBreakpoint(kind, space, rest)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, d.AddBreakpoint(bp))
+	case "delete", "d":
+		if len(args) == 1 && args[0] == "all" {
+			d.ClearBreakpoints()
+			return nil
+		}
+		id, err := d.breakpointID(args)
+		if err != nil {
+			return err
+		}
+		d.DeleteBreakpoint(id)
+	case "enable", "disable":
+		id, err := d.breakpointID(args)
+		if err != nil {
+			return err
+		}
+		d.Breakpoint(id).Enabled = cmd == "enable"
+	case "list", "l":
+		if len(d.breakpoints) == 0 {
+			fmt.Fprintln(out, "No breakpoints")
+		}
+		for _, bp := range d.breakpoints {
+			fmt.Fprintln(out, bp)
+		}
+	case "catch":
+		if len(args) == 0 {
+			return errors.New("usage: catch nmi|irq|brk [off]")
+		}
+		on := len(args) < 2 || args[1] != "off"
+		switch strings.ToLower(args[0]) {
+		case "nmi":
+			d.BreakOnNMI = on
+		case "irq":
+			d.BreakOnIRQ = on
+		case "brk":
+			d.BreakOnBRK = on
+		default:
+			return fmt.Errorf("unknown event %q", args[0])
+		}
+
+	case "continue", "c":
+		d.Continue()
+	case "step", "s":
+		n := 1
+		if len(args) > 0 {
+			var err error
+			if n, err = parseNumber(args[0]); err != nil {
+				return err
+			}
+		}
+		var stop *Stop
+		for i := 0; i < n; i++ {
+			if stop = d.Step(); stop.Reason != reasonStep {
+				break
+			}
+		}
+		d.PrintStop(out, stop)
+	case "next", "n":
+		if stop := d.StepOver(); stop != nil {
+			d.PrintStop(out, stop)
+		}
+	case "out", "o", "finish":
+		d.StepOut()
+	case "scanline":
+		n, err := d.number(args)
+		if err != nil {
+			return err
+		}
+		d.RunToScanline(n)
+	case "frame":
+		n := d.ppu.FrameCount() + 1
+		if len(args) > 0 {
+			var err error
+			if n, err = d.number(args); err != nil {
+				return err
+			}
+		}
+		d.RunToFrame(n)
+	case "reset":
+		d.console.Reset()
+		fmt.Fprintln(out, d.Location())
+
+	case "regs", "r":
+		fmt.Fprintln(out, d.Registers())
+	case "backtrace", "bt":
+		fmt.Fprintf(out, "#0  %s\n", d.Location())
+		for i, call := range d.CallStack() {
+			fmt.Fprintf(out, "#%d  %s\n", i+1, d.Disassembly(call, 1)[0])
+		}
+	case "print", "p":
+		e, err := d.ParseExpr(rest)
+		if err != nil {
+			return err
+		}
+		v := d.Eval(e)
+		fmt.Fprintf(out, "%d $%X\n", v, v)
+	case "mem", "m", "ppumem":
+		space := CPUSpace
+		if cmd == "ppumem" {
+			space = PPUSpace
+		}
+		return d.dump(out, space, args)
+	case "dis", "u":
+		addr, n := int(d.cpu.PC), 10
+		var err error
+		if len(args) > 0 {
+			if addr, err = d.number(args[:1]); err != nil {
+				return err
+			}
+		}
+		if len(args) > 1 {
+			if n, err = parseNumber(args[1]); err != nil {
+				return err
+			}
+		}
+		for _, line := range d.Disassembly(uint16(addr), n) {
+			fmt.Fprintln(out, line)
+		}
+	default:
+		return fmt.Errorf("unknown command %q, try help", fields[0])
+	}
+	return nil
+}
+
+// parseBreakpoint reads "ADDR[-END] [if COND]"
+func (d *Debugger) parseBreakpoint(kind Kind, space Space, text string) (Breakpoint, error) {
+	bp := Breakpoint{Kind: kind, Space: space}
+	where, cond, hasCond := strings.Cut(text, " if ")
+	where = strings.TrimSpace(where)
+	if where == "" {
+		return bp, errors.New("missing address")
+	}
+
+	start, end, isRange := strings.Cut(where, "-")
+	a, err := d.address(strings.TrimSpace(start))
+	if err != nil {
+		return bp, err
+	}
+	b := a
+	if isRange {
+		if b, err = d.address(strings.TrimSpace(end)); err != nil {
+			return bp, err
+		}
+	}
+	bp.Start, bp.End = uint16(a.Addr), uint16(b.Addr)
+	if a.Name != "" {
+		bp.Label = a.Name
+		// A watchpoint on an array watches all of it
+		if !isRange && kind != Exec && a.Size > 1 {
+			bp.End = uint16(a.Addr + a.Size - 1)
+		}
+	}
+
+	if hasCond {
+		if bp.Condition, err = d.ParseExpr(cond); err != nil {
+			return bp, err
+		}
+	}
+	return bp, nil
+}
+
+// location is an address given as a number or a label
+type location struct {
+	Name string // "" for numbers
+	Addr int
+	Size int
+}
+
+// address reads a number or a label
+func (d *Debugger) address(text string) (location, error) {
+	n, err := parseNumber(text)
+	if err == nil {
+		return location{Addr: n, Size: 1}, nil
+	}
+	if d.Symbols != nil {
+		if s, ok := d.Symbols.Lookup(text); ok {
+			return location{Name: s.Name, Addr: int(s.Addr), Size: s.Size}, nil
+		}
+	}
+	return location{}, err
+}
+
+func (d *Debugger) breakpointID(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, errors.New("expected a breakpoint ID")
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+	if err != nil || d.Breakpoint(id) == nil {
+		return 0, fmt.Errorf("no breakpoint %s", args[0])
+	}
+	return id, nil
+}
+
+// number evaluates the first argument as an expression
+func (d *Debugger) number(args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, errors.New("missing argument")
+	}
+	e, err := d.ParseExpr(args[0])
+	if err != nil {
+		return 0, err
+	}
+	return d.Eval(e), nil
+}
+
+// dump prints memory as hex, 16 bytes per line
+func (d *Debugger) dump(out io.Writer, space Space, args []string) error {
+	addr, err := d.number(args)
+	if err != nil {
+		return err
+	}
+	n := 64
+	if len(args) > 1 {
+		if n, err = parseNumber(args[1]); err != nil {
+			return err
+		}
+	}
+	for line := 0; line < n; line += 16 {
+		fmt.Fprintf(out, "%04X ", uint16(addr+line))
+		for i := line; i < min(line+16, n); i++ {
+			fmt.Fprintf(out, " %02X", d.peekSpace(space, uint16(addr+i)))
+		}
+		fmt.Fprintln(out)
+	}
+	return nil
+}
+
+// Registers returns the CPU registers and the PPU position
+func (d *Debugger) Registers() string {
+	c := d.cpu
+	flags := []byte("nv-bdizc")
+	for i := range flags {
+		if c.P&(0x80>>i) != 0 && flags[i] != '-' {
+			flags[i] -= 'a' - 'A'
+		}
+	}
+	return fmt.Sprintf("A:%02X X:%02X Y:%02X SP:%02X P:%02X %s  PPU %3d,%3d frame %d",
+		c.A, c.X, c.Y, c.SP, c.P, flags, d.ppu.Scanline(), d.ppu.Cycle(), d.ppu.FrameCount())
+}
+
+// Location returns the instruction at PC
+func (d *Debugger) Location() string {
+	return d.Disassembly(d.cpu.PC, 1)[0]
+}
+
+// PrintStop reports a stop with the instruction and registers it stopped at
+func (d *Debugger) PrintStop(out io.Writer, stop *Stop) {
+	if stop.Reason != reasonStep {
+		fmt.Fprintln(out, "Stopped:", stop)
+	}
+	fmt.Fprintln(out, d.Location())
+	fmt.Fprintln(out, d.Registers())
+}
+
+// REPL reads commands from in until it ends or quit, and runs the console
+// in the calling goroutine while a command keeps it running.
+// Interrupt stops a run, e.g. on Ctrl-C.
+func (d *Debugger) REPL(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	last := ""
+	fmt.Fprintln(out, d.Location())
+	for {
+		fmt.Fprint(out, "(nes) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			line = last
+		}
+		last = line
+
+		err := d.Exec(line, out)
+		if err == ErrQuit {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintln(out, "Error:", err)
+			continue
+		}
+		for d.Running() {
+			if stop := d.RunFrame(); stop != nil {
+				d.PrintStop(out, stop)
+			}
+		}
+	}
+}
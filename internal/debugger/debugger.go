@@ -0,0 +1,466 @@
+// Package debugger stops the console on breakpoints and watchpoints and
+// steps it instruction by instruction. It drives the CPU itself: while a
+// debugger is attached the console runs through RunFrame instead of
+// Console.StepFrame.
+package debugger
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/sergey121/nes-emulator/internal/bus"
+	"github.com/sergey121/nes-emulator/internal/console"
+	"github.com/sergey121/nes-emulator/internal/cpu"
+	"github.com/sergey121/nes-emulator/internal/ppu"
+	"github.com/sergey121/nes-emulator/internal/symbols"
+)
+
+// Space is the address space of a breakpoint
+type Space int
+
+const (
+	CPUSpace Space = iota
+	// PPUSpace is the PPU memory as the CPU accesses it through PPUDATA
+	PPUSpace
+)
+
+// Kind is what a breakpoint waits for
+type Kind int
+
+const (
+	Exec   Kind = iota // An instruction is about to run at the address
+	Read               // The address is read
+	Write              // The address is written
+	Change             // A write changes the value at the address
+)
+
+var kindNames = [...]string{Exec: "exec", Read: "read", Write: "write", Change: "change"}
+
+func (k Kind) String() string { return kindNames[k] }
+
+// Breakpoint stops the console when its address range is executed or
+// accessed and its condition, if any, is true
+type Breakpoint struct {
+	ID         int
+	Kind       Kind
+	Space      Space
+	Start, End uint16 // Inclusive range
+	Label      string // Symbol the range was given as, "" for numbers
+	Condition  *Expr  // nil to always stop
+	Enabled    bool
+	Hits       int
+}
+
+func (bp *Breakpoint) String() string {
+	s := fmt.Sprintf("#%d %s", bp.ID, bp.Kind)
+	if bp.Space == PPUSpace {
+		s += " ppu"
+	}
+	s += fmt.Sprintf(" $%04X", bp.Start)
+	if bp.End != bp.Start {
+		s += fmt.Sprintf("-$%04X", bp.End)
+	}
+	if bp.Label != "" {
+		s += " (" + bp.Label + ")"
+	}
+	if bp.Condition != nil {
+		s += " if " + bp.Condition.String()
+	}
+	if !bp.Enabled {
+		s += " (disabled)"
+	}
+	return s + fmt.Sprintf(", %d hits", bp.Hits)
+}
+
+func (bp *Breakpoint) contains(addr uint16) bool {
+	return addr >= bp.Start && addr <= bp.End
+}
+
+// reasonStep is the reason of a step that ran without hitting anything
+const reasonStep = "step"
+
+// Stop tells why the console stopped
+type Stop struct {
+	Reason     string
+	Breakpoint *Breakpoint // nil unless a breakpoint or watchpoint hit
+	// Access that hit a watchpoint
+	Addr  uint16
+	Value byte
+}
+
+func (s *Stop) String() string {
+	switch {
+	case s.Breakpoint == nil:
+		return s.Reason
+	case s.Breakpoint.Kind == Exec:
+		return fmt.Sprintf("breakpoint %s", s.Breakpoint)
+	default:
+		return fmt.Sprintf("watchpoint %s: $%04X = $%02X", s.Breakpoint, s.Addr, s.Value)
+	}
+}
+
+// Opcodes the stepping commands look for
+const (
+	opBRK = 0x00
+	opJSR = 0x20
+	opRTI = 0x40
+	opRTS = 0x60
+)
+
+type Debugger struct {
+	console *console.Console
+	cpu     *cpu.CPU
+	bus     *bus.Bus
+	ppu     *ppu.PPU
+
+	breakpoints []*Breakpoint
+	nextID      int
+
+	// Break when the CPU takes an NMI or an IRQ, or is about to run BRK.
+	// Nothing raises IRQs yet: the APU and IRQ mappers are not emulated.
+	BreakOnNMI, BreakOnIRQ, BreakOnBRK bool
+
+	// Symbols name addresses, nil without them. Set with SetSymbols.
+	Symbols *symbols.Table
+
+	running bool
+	// Run the next instruction without checking breakpoints, to leave the one it stopped on
+	resume bool
+	// Targets of the running command, -1 or false when unset
+	stepOverPC         int
+	stepOverSP         byte
+	stepOut            bool
+	stepOutSP          byte
+	runScanline        int
+	runFrame           int
+	pending            *Stop // Raised by a hook during the instruction
+	interrupt          int   // Interrupt taken by the last step: 0, nmiTaken or irqTaken
+	interruptRequested atomic.Bool
+	last               *Stop
+}
+
+const (
+	nmiTaken = iota + 1
+	irqTaken
+)
+
+// New attaches a debugger to the console. The console is stopped.
+func New(c *console.Console) *Debugger {
+	d := &Debugger{
+		console:     c,
+		cpu:         c.CPU,
+		bus:         c.Bus,
+		ppu:         c.PPU,
+		nextID:      1,
+		stepOverPC:  -1,
+		runScanline: -1,
+		runFrame:    -1,
+	}
+	c.Bus.OnAccess = func(addr uint16, value byte, write bool) {
+		d.access(CPUSpace, addr, value, write)
+	}
+	c.PPU.OnAccess = func(addr uint16, value byte, write bool) {
+		d.access(PPUSpace, addr, value, write)
+	}
+	c.Bus.OnInterrupt = func(nmi bool) {
+		if nmi {
+			d.interrupt = nmiTaken
+		} else {
+			d.interrupt = irqTaken
+		}
+	}
+	// Console.StepFrame can leave the CPU in the middle of an instruction
+	for d.cpu.CyclesLeft > 0 {
+		d.cpu.Clock()
+	}
+	return d
+}
+
+// Detach removes the hooks. The console runs on its own again.
+func (d *Debugger) Detach() {
+	d.bus.OnAccess = nil
+	d.bus.OnInterrupt = nil
+	d.ppu.OnAccess = nil
+}
+
+// Untraced runs fn with the access hooks off, so the memory accesses of a
+// front end, like GDB reading PPUSTATUS, do not hit watchpoints
+func (d *Debugger) Untraced(fn func()) {
+	busHook, ppuHook := d.bus.OnAccess, d.ppu.OnAccess
+	d.bus.OnAccess, d.ppu.OnAccess = nil, nil
+	defer func() { d.bus.OnAccess, d.ppu.OnAccess = busHook, ppuHook }()
+	fn()
+}
+
+// Console returns the console being debugged
+func (d *Debugger) Console() *console.Console { return d.console }
+
+// Running reports whether the console runs until the next stop
+func (d *Debugger) Running() bool { return d.running }
+
+// LastStop returns why the console last stopped, nil before the first stop
+func (d *Debugger) LastStop() *Stop { return d.last }
+
+// Breakpoints returns the breakpoints and watchpoints in the order they were added
+func (d *Debugger) Breakpoints() []*Breakpoint { return d.breakpoints }
+
+// AddBreakpoint adds a breakpoint and returns it with its ID set
+func (d *Debugger) AddBreakpoint(bp Breakpoint) *Breakpoint {
+	bp.ID = d.nextID
+	bp.Enabled = true
+	if bp.End < bp.Start {
+		bp.End = bp.Start
+	}
+	d.nextID++
+	d.breakpoints = append(d.breakpoints, &bp)
+	return &bp
+}
+
+// Breakpoint returns the breakpoint with the given ID, nil if there is none
+func (d *Debugger) Breakpoint(id int) *Breakpoint {
+	for _, bp := range d.breakpoints {
+		if bp.ID == id {
+			return bp
+		}
+	}
+	return nil
+}
+
+// DeleteBreakpoint removes a breakpoint and reports whether it existed
+func (d *Debugger) DeleteBreakpoint(id int) bool {
+	for i, bp := range d.breakpoints {
+		if bp.ID == id {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ClearBreakpoints removes every breakpoint
+func (d *Debugger) ClearBreakpoints() {
+	d.breakpoints = nil
+}
+
+// Eval evaluates an expression against the current state
+func (d *Debugger) Eval(e *Expr) int {
+	return e.eval(&env{d: d})
+}
+
+// Continue runs until the next stop
+func (d *Debugger) Continue() {
+	d.start()
+}
+
+// Step runs one instruction, or the entry of an interrupt
+func (d *Debugger) Step() *Stop {
+	d.resume = true
+	stop := d.next()
+	if stop == nil {
+		stop = &Stop{Reason: reasonStep}
+	}
+	return d.stopped(stop)
+}
+
+// StepOver runs a JSR and the subroutine it calls, other instructions are stepped
+func (d *Debugger) StepOver() *Stop {
+	if d.peek(d.cpu.PC) != opJSR {
+		return d.Step()
+	}
+	d.stepOverPC = int(d.cpu.PC) + 3
+	d.stepOverSP = d.cpu.SP
+	d.start()
+	return nil
+}
+
+// StepOut runs until the current subroutine or interrupt handler returns
+func (d *Debugger) StepOut() {
+	d.stepOut = true
+	d.stepOutSP = d.cpu.SP
+	d.start()
+}
+
+// RunToScanline runs until the PPU starts the given scanline
+func (d *Debugger) RunToScanline(scanline int) {
+	d.runScanline = scanline
+	d.start()
+}
+
+// RunToFrame runs until the PPU starts the given frame
+func (d *Debugger) RunToFrame(frame int) {
+	d.runFrame = frame
+	d.start()
+}
+
+// Interrupt stops the console after the current instruction.
+// It may be called from another goroutine.
+func (d *Debugger) Interrupt() {
+	d.interruptRequested.Store(true)
+}
+
+func (d *Debugger) start() {
+	d.running = true
+	d.resume = true
+	d.interruptRequested.Store(false)
+}
+
+// RunFrame runs until the PPU finishes the current frame or the console
+// stops, and returns the stop. It does nothing when the console is stopped.
+func (d *Debugger) RunFrame() *Stop {
+	if !d.running {
+		return nil
+	}
+	frame := d.ppu.FrameCount()
+	for d.ppu.FrameCount() == frame {
+		if stop := d.next(); stop != nil {
+			return d.stopped(stop)
+		}
+	}
+	return nil
+}
+
+// stopped ends the running command
+func (d *Debugger) stopped(stop *Stop) *Stop {
+	d.running = false
+	d.stepOverPC = -1
+	d.stepOut = false
+	d.runScanline = -1
+	d.runFrame = -1
+	d.last = stop
+	return stop
+}
+
+// next runs one instruction and returns the stop it caused, if any
+func (d *Debugger) next() *Stop {
+	if d.interruptRequested.Swap(false) {
+		return &Stop{Reason: "interrupted"}
+	}
+	if !d.resume {
+		if stop := d.checkBefore(); stop != nil {
+			return stop
+		}
+	}
+	d.resume = false
+
+	opcode := d.peek(d.cpu.PC)
+	scanline := d.ppu.Scanline()
+	d.interrupt = 0
+	d.cpu.Clock()
+	for d.cpu.CyclesLeft > 0 {
+		d.cpu.Clock()
+	}
+
+	if stop := d.pending; stop != nil {
+		d.pending = nil
+		return stop
+	}
+	switch {
+	case d.interrupt == nmiTaken && d.BreakOnNMI:
+		return &Stop{Reason: "NMI"}
+	case d.interrupt == irqTaken && d.BreakOnIRQ:
+		return &Stop{Reason: "IRQ"}
+	case d.interrupt != 0:
+		// An interrupt entry is not an instruction of the code being stepped
+		return nil
+	}
+
+	if d.stepOut && (opcode == opRTS || opcode == opRTI) && d.cpu.SP > d.stepOutSP {
+		return &Stop{Reason: "step out"}
+	}
+	if d.runScanline >= 0 && scanline != d.runScanline && d.ppu.Scanline() == d.runScanline {
+		return &Stop{Reason: fmt.Sprintf("scanline %d", d.runScanline)}
+	}
+	if d.runFrame >= 0 && d.ppu.FrameCount() >= d.runFrame {
+		return &Stop{Reason: fmt.Sprintf("frame %d", d.ppu.FrameCount())}
+	}
+	return nil
+}
+
+// checkBefore looks for the stops due before the instruction at PC runs
+func (d *Debugger) checkBefore() *Stop {
+	pc := d.cpu.PC
+	if d.stepOverPC == int(pc) && d.cpu.SP >= d.stepOverSP {
+		return &Stop{Reason: "step over"}
+	}
+	for _, bp := range d.breakpoints {
+		if bp.Kind == Exec && bp.Enabled && bp.contains(pc) && d.condition(bp, pc, d.peek(pc)) {
+			bp.Hits++
+			return &Stop{Reason: "breakpoint", Breakpoint: bp}
+		}
+	}
+	if d.BreakOnBRK && d.peek(pc) == opBRK {
+		return &Stop{Reason: "BRK"}
+	}
+	return nil
+}
+
+func (d *Debugger) condition(bp *Breakpoint, addr uint16, value byte) bool {
+	return bp.Condition == nil || bp.Condition.eval(&env{d: d, addr: int(addr), value: int(value)}) != 0
+}
+
+// access checks the watchpoints on a memory access of the CPU
+func (d *Debugger) access(space Space, addr uint16, value byte, write bool) {
+	if d.pending != nil {
+		return
+	}
+	addr = canonical(space, addr)
+	for _, bp := range d.breakpoints {
+		if bp.Kind == Exec || bp.Space != space || !bp.Enabled || !bp.contains(addr) {
+			continue
+		}
+		switch bp.Kind {
+		case Read:
+			if write {
+				continue
+			}
+		case Write:
+			if !write {
+				continue
+			}
+		case Change:
+			// The hooks run before writes, so memory still holds the old value
+			if !write || d.peekSpace(space, addr) == value {
+				continue
+			}
+		}
+		if d.condition(bp, addr, value) {
+			bp.Hits++
+			d.pending = &Stop{Reason: "watchpoint", Breakpoint: bp, Addr: addr, Value: value}
+			return
+		}
+	}
+}
+
+// canonical folds the mirrors of RAM and the PPU registers, and of the
+// nametables and palette in PPU space, to their first address
+func canonical(space Space, addr uint16) uint16 {
+	if space == PPUSpace {
+		switch addr &= 0x3FFF; {
+		case addr >= 0x3000 && addr < 0x3F00:
+			return addr - 0x1000
+		case addr >= 0x3F00:
+			return 0x3F00 | addr&0x1F
+		}
+		return addr
+	}
+	switch {
+	case addr < 0x2000:
+		return addr & 0x07FF
+	case addr < 0x4000:
+		return 0x2000 | addr&0x07
+	}
+	return addr
+}
+
+// peek reads CPU memory for the debugger, without side effects
+func (d *Debugger) peek(addr uint16) byte { return d.bus.Peek(addr) }
+
+// Peek reads CPU memory without side effects, like expressions do
+func (d *Debugger) Peek(addr uint16) byte { return d.peek(addr) }
+
+func (d *Debugger) peekSpace(space Space, addr uint16) byte {
+	if space == PPUSpace {
+		return d.ppu.Peek(addr)
+	}
+	return d.peek(addr)
+}
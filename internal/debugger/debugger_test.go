@@ -0,0 +1,239 @@
+package debugger
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sergey121/nes-emulator/internal/console"
+	"github.com/sergey121/nes-emulator/internal/rom"
+	"github.com/sergey121/nes-emulator/internal/symbols"
+)
+
+// newTestDebugger loads a small program at $8000:
+//
+//	8000  LDA #$10
+//	8002  STA $0300
+//	8005  JSR $8010
+//	8008  INX
+//	8009  JMP $8008
+//	8010  LDY #$05
+//	8012  STY $0301
+//	8015  RTS
+//	8020  RTI        NMI handler
+func newTestDebugger(t *testing.T) *Debugger {
+	t.Helper()
+	prg := make([]byte, 0x8000)
+	copy(prg, []byte{
+		0xA9, 0x10,
+		0x8D, 0x00, 0x03,
+		0x20, 0x10, 0x80,
+		0xE8,
+		0x4C, 0x08, 0x80,
+	})
+	copy(prg[0x10:], []byte{0xA0, 0x05, 0x8C, 0x01, 0x03, 0x60})
+	prg[0x20] = 0x40
+	copy(prg[0x7FFA:], []byte{0x20, 0x80, 0x00, 0x80, 0x20, 0x80})
+
+	c := console.New(&rom.Cartridge{PRG: prg, CHR: make([]byte, 0x2000)})
+	return New(c)
+}
+
+// run runs the console until it stops, at most a few seconds of frames
+func run(t *testing.T, d *Debugger) *Stop {
+	t.Helper()
+	for i := 0; i < 300 && d.Running(); i++ {
+		if stop := d.RunFrame(); stop != nil {
+			return stop
+		}
+	}
+	t.Fatalf("the console did not stop")
+	return nil
+}
+
+func TestBreakpoint(t *testing.T) {
+	d := newTestDebugger(t)
+	bp := d.AddBreakpoint(Breakpoint{Kind: Exec, Start: 0x8005})
+
+	d.Continue()
+	stop := run(t, d)
+	if stop.Breakpoint != bp || d.cpu.PC != 0x8005 || bp.Hits != 1 {
+		t.Errorf("expected to stop on %v at $8005, got %v at $%04X", bp, stop, d.cpu.PC)
+	}
+
+	// Continuing leaves the breakpoint instead of hitting it again
+	cond, err := ParseExpr("X==3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.AddBreakpoint(Breakpoint{Kind: Exec, Start: 0x8008, Condition: cond})
+	d.Continue()
+	run(t, d)
+	if d.cpu.PC != 0x8008 || d.cpu.X != 3 {
+		t.Errorf("expected to stop at $8008 with X=3, got $%04X with X=%d", d.cpu.PC, d.cpu.X)
+	}
+}
+
+func TestWatchpoints(t *testing.T) {
+	d := newTestDebugger(t)
+	bp := d.AddBreakpoint(Breakpoint{Kind: Write, Start: 0x0300, End: 0x0301})
+
+	d.Continue()
+	stop := run(t, d)
+	// The console stops after the instruction that wrote
+	if stop.Breakpoint != bp || stop.Addr != 0x0300 || stop.Value != 0x10 || d.cpu.PC != 0x8005 {
+		t.Errorf("unexpected stop %v at $%04X", stop, d.cpu.PC)
+	}
+
+	// A change watchpoint ignores writes of the value already there
+	d = newTestDebugger(t)
+	d.bus.RAM[0x0300] = 0x10
+	d.bus.RAM[0x0301] = 0x00
+	d.AddBreakpoint(Breakpoint{Kind: Change, Start: 0x0300, End: 0x0301})
+	d.Continue()
+	stop = run(t, d)
+	if stop.Addr != 0x0301 || stop.Value != 0x05 {
+		t.Errorf("expected the change of $0301, got %v", stop)
+	}
+
+	// Mirrors of RAM hit the watchpoint of the first copy
+	d = newTestDebugger(t)
+	d.AddBreakpoint(Breakpoint{Kind: Read, Start: 0x0042})
+	d.bus.CPURead(0x0842)
+	if d.pending == nil {
+		t.Errorf("expected a read of $0842 to hit a watchpoint on $0042")
+	}
+}
+
+func TestStepping(t *testing.T) {
+	d := newTestDebugger(t)
+	d.Step()
+	d.Step()
+	if d.cpu.PC != 0x8005 {
+		t.Fatalf("expected PC $8005 after two steps, got $%04X", d.cpu.PC)
+	}
+
+	// Step over the JSR
+	if stop := d.StepOver(); stop != nil {
+		t.Fatalf("expected StepOver to run, got %v", stop)
+	}
+	run(t, d)
+	if d.cpu.PC != 0x8008 || d.cpu.Y != 5 {
+		t.Errorf("expected to return to $8008 with Y=5, got $%04X with Y=%d", d.cpu.PC, d.cpu.Y)
+	}
+
+	// Step into a subroutine, then out of it
+	d = newTestDebugger(t)
+	for d.cpu.PC != 0x8010 {
+		d.Step()
+	}
+	if calls := d.CallStack(); len(calls) != 1 || calls[0] != 0x8005 {
+		t.Errorf("expected a call from $8005, got %X", calls)
+	}
+	d.StepOut()
+	if stop := run(t, d); stop.Reason != "step out" || d.cpu.PC != 0x8008 {
+		t.Errorf("expected to step out to $8008, got %v at $%04X", stop, d.cpu.PC)
+	}
+}
+
+func TestRunToScanlineAndFrame(t *testing.T) {
+	d := newTestDebugger(t)
+	d.RunToScanline(100)
+	run(t, d)
+	if d.ppu.Scanline() != 100 {
+		t.Errorf("expected scanline 100, got %d", d.ppu.Scanline())
+	}
+
+	frame := d.ppu.FrameCount() + 2
+	d.RunToFrame(frame)
+	run(t, d)
+	if d.ppu.FrameCount() != frame {
+		t.Errorf("expected frame %d, got %d", frame, d.ppu.FrameCount())
+	}
+}
+
+func TestBreakOnNMI(t *testing.T) {
+	d := newTestDebugger(t)
+	d.BreakOnNMI = true
+	d.bus.CPUWrite(0x2000, 0x80)
+
+	d.Continue()
+	stop := run(t, d)
+	// Stopped at the start of the handler, before it runs
+	if stop.Reason != "NMI" || d.cpu.PC != 0x8020 {
+		t.Errorf("expected to stop on NMI at $8020, got %v at $%04X", stop, d.cpu.PC)
+	}
+	if line := d.ppu.Scanline(); line != 241 {
+		t.Errorf("expected the NMI on line 241, got %d", line)
+	}
+}
+
+func TestREPL(t *testing.T) {
+	d := newTestDebugger(t)
+	in := strings.NewReader("b $8010\nc\np Y+1\nn\n\nw ppu $2000 if VALUE==1\nl\nq\n")
+	var out strings.Builder
+	if err := d.REPL(in, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"Stopped: breakpoint #1 exec $8010, 1 hits",
+		"8010  LDY #$05",
+		"1 $1",
+		"8012  STY $0301",
+		"8015  RTS",
+		"#2 write ppu $2000 if VALUE==1, 0 hits",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in the output:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	d := newTestDebugger(t)
+	table := symbols.New()
+	if err := table.ReadNL(strings.NewReader("$8000#Reset#\n$8010#Sub#\n"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.ReadNL(strings.NewReader("$0300/2#vars#\n"), -1); err != nil {
+		t.Fatal(err)
+	}
+	d.SetSymbols(table)
+
+	if line := d.Disassembly(0x8005, 1)[0]; !strings.Contains(line, "JSR Sub") || !strings.HasSuffix(line, "; Reset+5") {
+		t.Errorf("expected the call of Sub in Reset, got %q", line)
+	}
+	if line := d.Disassembly(0x8012, 1)[0]; !strings.Contains(line, "STY vars+1") {
+		t.Errorf("expected vars+1, got %q", line)
+	}
+
+	var out strings.Builder
+	for _, cmd := range []string{"b Sub", "w vars", "p Sub+2"} {
+		if err := d.Exec(cmd, &out); err != nil {
+			t.Fatalf("%s: %v", cmd, err)
+		}
+	}
+	if w := d.Breakpoints()[1]; w.Start != 0x0300 || w.End != 0x0301 || w.Label != "vars" {
+		t.Errorf("expected a watchpoint on all of vars, got %v", w)
+	}
+	if !strings.Contains(out.String(), "32786 $8012") {
+		t.Errorf("expected Sub+2 to be $8012, got %q", out.String())
+	}
+	if err := d.Exec("b Nowhere", &out); err == nil {
+		t.Errorf("expected an error for an unknown label")
+	}
+
+	// The watchpoint hits first, on STA
+	d.Continue()
+	run(t, d)
+	d.Continue()
+	stop := run(t, d)
+	if stop.Breakpoint == nil || stop.Breakpoint.Label != "Sub" || d.cpu.PC != 0x8010 {
+		t.Errorf("expected to stop at Sub, got %v at $%04X", stop, d.cpu.PC)
+	}
+	out.Reset()
+	d.Exec("bt", &out)
+	if !strings.Contains(out.String(), "#1  8005  JSR Sub") || !strings.Contains(out.String(), "Reset+5") {
+		t.Errorf("unexpected backtrace %q", out.String())
+	}
+}
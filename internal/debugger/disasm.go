@@ -0,0 +1,34 @@
+package debugger
+
+import (
+	"fmt"
+
+	"github.com/sergey121/nes-emulator/internal/cpu"
+)
+
+// Disassemble returns the instruction at addr in assembler syntax and its
+// length. Memory is read with read, which should have no side effects.
+// label names the addresses of operands, it may be nil.
+func Disassemble(read func(uint16) byte, addr uint16, label func(uint16) string) (string, int) {
+	opcode := read(addr)
+	inst, ok := cpu.Instructions[opcode]
+	if !ok {
+		return fmt.Sprintf(".byte $%02X", opcode), 1
+	}
+	return inst.Format(read, addr, label), inst.Bytes
+}
+
+// Disassembly returns n instructions from addr, one "ADDR  TEXT" line each.
+// With symbols the label and source line of an instruction follow it.
+func (d *Debugger) Disassembly(addr uint16, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		text, size := Disassemble(d.peek, addr, d.label)
+		lines[i] = fmt.Sprintf("%04X  %s", addr, text)
+		if where := d.describe(addr); where != "" {
+			lines[i] = fmt.Sprintf("%-24s ; %s", lines[i], where)
+		}
+		addr += uint16(size)
+	}
+	return lines
+}
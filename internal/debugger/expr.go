@@ -0,0 +1,310 @@
+package debugger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expressions of breakpoint conditions and the print command, e.g.
+//
+//	A==$10 && [$0300]>5
+//
+// Operands:
+//
+//	$10 0x10 %1010 16   numbers: hex, binary, decimal
+//	A X Y SP PC P       CPU registers
+//	C Z I D V N         flags of P, 0 or 1
+//	SCANLINE DOT FRAME  PPU position
+//	ADDR VALUE          address and value of the access that hit a watchpoint
+//	[e]                 byte of CPU memory at e
+//	UpdatePlayer        address of a label, with symbols loaded
+//
+// Operators, from the lowest precedence: || && (== != < <= > >=) (+ - | ^) (* & << >>)
+// and the unary ! - ~. Names of registers are not case sensitive, labels
+// are, and a register wins over a label with its name.
+
+// Expr is a compiled expression
+type Expr struct {
+	text string
+	eval func(*env) int
+}
+
+// env is what an expression is evaluated against
+type env struct {
+	d           *Debugger
+	addr, value int // Access that hit a watchpoint
+}
+
+func (e *Expr) String() string { return e.text }
+
+// ParseExpr compiles an expression without labels, see Debugger.ParseExpr
+func ParseExpr(text string) (*Expr, error) {
+	return parseExpr(text, nil)
+}
+
+// ParseExpr compiles an expression that may use the labels of the symbols
+func (d *Debugger) ParseExpr(text string) (*Expr, error) {
+	return parseExpr(text, d.symbol)
+}
+
+func parseExpr(text string, symbol func(string) (int, bool)) (*Expr, error) {
+	p := &parser{text: text, symbol: symbol}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	eval, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in %q", p.tokens[p.pos], text)
+	}
+	return &Expr{text: strings.TrimSpace(text), eval: eval}, nil
+}
+
+type parser struct {
+	text   string
+	tokens []string
+	pos    int
+	symbol func(name string) (int, bool) // Address of a label, nil without symbols
+}
+
+// operators longest first, so "<=" is not read as "<"
+var operators = []string{"||", "&&", "==", "!=", "<=", ">=", "<<", ">>", "<", ">", "+", "-", "|", "^", "*", "&", "!", "~", "[", "]", "(", ")"}
+
+func (p *parser) tokenize() error {
+	s := p.text
+	for len(s) > 0 {
+		r := rune(s[0])
+		switch {
+		case unicode.IsSpace(r):
+			s = s[1:]
+			continue
+		case r == '$' || r == '%' || unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			n := 1
+			for n < len(s) && (unicode.IsLetter(rune(s[n])) || unicode.IsDigit(rune(s[n])) || s[n] == '_') {
+				n++
+			}
+			p.tokens = append(p.tokens, s[:n])
+			s = s[n:]
+			continue
+		}
+		found := false
+		for _, op := range operators {
+			if strings.HasPrefix(s, op) {
+				p.tokens = append(p.tokens, op)
+				s = s[len(op):]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unexpected %q in %q", s[0], p.text)
+		}
+	}
+	return nil
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// Binary operators by precedence level, lowest first
+var levels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-", "|", "^"},
+	{"*", "&", "<<", ">>"},
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func binary(op string, a, b int) int {
+	switch op {
+	case "==":
+		return boolInt(a == b)
+	case "!=":
+		return boolInt(a != b)
+	case "<":
+		return boolInt(a < b)
+	case "<=":
+		return boolInt(a <= b)
+	case ">":
+		return boolInt(a > b)
+	case ">=":
+		return boolInt(a >= b)
+	case "+":
+		return a + b
+	case "-":
+		return a - b
+	case "|":
+		return a | b
+	case "^":
+		return a ^ b
+	case "*":
+		return a * b
+	case "&":
+		return a & b
+	case "<<":
+		return a << (b & 31)
+	default: // ">>"
+		return a >> (b & 31)
+	}
+}
+
+func (p *parser) parseBinary(level int) (func(*env) int, error) {
+	if level == len(levels) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		match := false
+		for _, o := range levels[level] {
+			match = match || op == o
+		}
+		if !match {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		switch op {
+		// Short-circuit, so [..] of the right side is only read when needed
+		case "&&":
+			left = func(e *env) int { return boolInt(l(e) != 0 && right(e) != 0) }
+		case "||":
+			left = func(e *env) int { return boolInt(l(e) != 0 || right(e) != 0) }
+		default:
+			left = func(e *env) int { return binary(op, l(e), right(e)) }
+		}
+	}
+}
+
+func (p *parser) parseUnary() (func(*env) int, error) {
+	switch op := p.peek(); op {
+	case "!", "-", "~":
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "!":
+			return func(e *env) int { return boolInt(operand(e) == 0) }, nil
+		case "-":
+			return func(e *env) int { return -operand(e) }, nil
+		default:
+			return func(e *env) int { return ^operand(e) }, nil
+		}
+	}
+	return p.parsePrimary()
+}
+
+// closing parses a sub-expression followed by the closing bracket
+func (p *parser) closing(bracket string) (func(*env) int, error) {
+	inner, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.next() != bracket {
+		return nil, fmt.Errorf("missing %q in %q", bracket, p.text)
+	}
+	return inner, nil
+}
+
+func (p *parser) parsePrimary() (func(*env) int, error) {
+	t := p.next()
+	switch t {
+	case "":
+		return nil, fmt.Errorf("unexpected end of %q", p.text)
+	case "(":
+		return p.closing(")")
+	case "[":
+		addr, err := p.closing("]")
+		if err != nil {
+			return nil, err
+		}
+		return func(e *env) int { return int(e.d.peek(uint16(addr(e)))) }, nil
+	}
+
+	if n, err := parseNumber(t); err == nil {
+		return func(*env) int { return n }, nil
+	}
+	if v, ok := variables[strings.ToUpper(t)]; ok {
+		return v, nil
+	}
+	if p.symbol != nil {
+		if addr, ok := p.symbol(t); ok {
+			return func(*env) int { return addr }, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown name %q in %q", t, p.text)
+}
+
+func flag(mask byte) func(*env) int {
+	return func(e *env) int { return boolInt(e.d.cpu.P&mask != 0) }
+}
+
+var variables = map[string]func(*env) int{
+	"A":        func(e *env) int { return int(e.d.cpu.A) },
+	"X":        func(e *env) int { return int(e.d.cpu.X) },
+	"Y":        func(e *env) int { return int(e.d.cpu.Y) },
+	"SP":       func(e *env) int { return int(e.d.cpu.SP) },
+	"PC":       func(e *env) int { return int(e.d.cpu.PC) },
+	"P":        func(e *env) int { return int(e.d.cpu.P) },
+	"C":        flag(0x01),
+	"Z":        flag(0x02),
+	"I":        flag(0x04),
+	"D":        flag(0x08),
+	"V":        flag(0x40),
+	"N":        flag(0x80),
+	"SCANLINE": func(e *env) int { return e.d.ppu.Scanline() },
+	"DOT":      func(e *env) int { return e.d.ppu.Cycle() },
+	"FRAME":    func(e *env) int { return e.d.ppu.FrameCount() },
+	"ADDR":     func(e *env) int { return e.addr },
+	"VALUE":    func(e *env) int { return e.value },
+}
+
+// parseNumber reads $hex, 0xhex, %binary or decimal
+func parseNumber(s string) (int, error) {
+	var n int64
+	var err error
+	switch {
+	case strings.HasPrefix(s, "$"):
+		n, err = strconv.ParseInt(s[1:], 16, 64)
+	case strings.HasPrefix(s, "0x"), strings.HasPrefix(s, "0X"):
+		n, err = strconv.ParseInt(s[2:], 16, 64)
+	case strings.HasPrefix(s, "%"):
+		n, err = strconv.ParseInt(s[1:], 2, 64)
+	default:
+		n, err = strconv.ParseInt(s, 10, 64)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("bad number %q", s)
+	}
+	return int(n), nil
+}
@@ -0,0 +1,45 @@
+package debugger
+
+import "testing"
+
+func TestExpressions(t *testing.T) {
+	d := newTestDebugger(t)
+	d.cpu.A = 0x10
+	d.cpu.X = 2
+	d.cpu.P = 0x81 // N and C
+	d.bus.RAM[0x0300] = 6
+	d.bus.RAM[0x0302] = 7
+
+	tests := []struct {
+		expr string
+		want int
+	}{
+		{"A==$10 && [$0300]>5", 1},
+		{"a == 16 && [$300] > 6", 0},
+		{"[$0300+X]", 7},
+		{"1+2*3", 7},
+		{"(1+2)*3", 9},
+		{"%1010 | 0x10", 0x1A},
+		{"!Z && N && C", 1},
+		{"-1 < 0 || [$0000]", 1},
+		{"~0 & $FF", 0xFF},
+		{"1 << 4 >> 2", 4},
+		{"PC", 0x8000},
+	}
+	for _, tt := range tests {
+		e, err := ParseExpr(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got := d.Eval(e); got != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.expr, tt.want, got)
+		}
+	}
+
+	for _, bad := range []string{"", "A ==", "[1", "B", "1 2", "$G"} {
+		if _, err := ParseExpr(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
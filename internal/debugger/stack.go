@@ -0,0 +1,24 @@
+package debugger
+
+// maxFrames limits the call stack, the stack page holds at most 128 calls
+const maxFrames = 64
+
+// CallStack returns the addresses of the JSR instructions the code at PC
+// was called from, the innermost first. The 6502 keeps no frame pointers,
+// so the stack is scanned for return addresses: a pushed address A is taken
+// as one when a JSR sits at A-2. Interrupts and data pushed with PHA can
+// hide calls or, rarely, look like them.
+func (d *Debugger) CallStack() []uint16 {
+	var calls []uint16
+	for sp := int(d.cpu.SP) + 1; sp < 0xFF && len(calls) < maxFrames; {
+		ret := uint16(d.peek(0x0100+uint16(sp))) | uint16(d.peek(0x0100+uint16(sp+1)))<<8
+		// A JSR is 3 bytes, one in the last 2 bytes would wrap around
+		if call := ret - 2; call <= 0xFFFD && d.peek(call) == opJSR {
+			calls = append(calls, call)
+			sp += 2
+			continue
+		}
+		sp++
+	}
+	return calls
+}
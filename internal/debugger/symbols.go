@@ -0,0 +1,85 @@
+package debugger
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/sergey121/nes-emulator/internal/symbols"
+)
+
+// LoadSymbols loads the symbols that come with the ROM at romPath, see
+// symbols.LoadFor. It is not an error if there are none.
+func (d *Debugger) LoadSymbols(romPath string) error {
+	t, err := symbols.LoadFor(romPath)
+	if err != nil {
+		return err
+	}
+	if t != nil {
+		d.SetSymbols(t)
+	}
+	return nil
+}
+
+// SetSymbols makes the debugger show labels and source lines from t and
+// accept labels in addresses and expressions. nil removes them.
+func (d *Debugger) SetSymbols(t *symbols.Table) {
+	d.Symbols = t
+	if t == nil {
+		d.cpu.Labels = nil
+		return
+	}
+	// Labels of banks that are not mapped must not name addresses
+	if t.PRGOffset == nil {
+		t.PRGOffset = d.bus.Cartridge.PRGOffset
+	}
+	d.cpu.Labels = t.Label
+}
+
+// label names addr, "" without symbols
+func (d *Debugger) label(addr uint16) string {
+	if d.Symbols == nil {
+		return ""
+	}
+	return d.Symbols.Label(addr)
+}
+
+// Routine returns the label of the code at addr with an offset, like
+// "UpdatePlayer+3", or "" if no label comes before it
+func (d *Debugger) Routine(addr uint16) string {
+	if d.Symbols == nil {
+		return ""
+	}
+	s, ok := d.Symbols.Nearest(addr)
+	if !ok {
+		return ""
+	}
+	if s.Addr == addr {
+		return s.Name
+	}
+	return fmt.Sprintf("%s+%d", s.Name, addr-s.Addr)
+}
+
+// describe returns the routine and the source line of the code at addr,
+// like "UpdatePlayer+3 player.s:42", "" without symbols
+func (d *Debugger) describe(addr uint16) string {
+	var parts []string
+	if r := d.Routine(addr); r != "" {
+		parts = append(parts, r)
+	}
+	if d.Symbols != nil {
+		if l, ok := d.Symbols.LineAt(addr); ok {
+			parts = append(parts, fmt.Sprintf("%s:%d", filepath.Base(l.File), l.Line))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// symbol returns the address of a label for expressions
+func (d *Debugger) symbol(name string) (int, bool) {
+	if d.Symbols == nil {
+		return 0, false
+	}
+	s, ok := d.Symbols.Lookup(name)
+	return int(s.Addr), ok
+}
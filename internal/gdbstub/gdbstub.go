@@ -0,0 +1,617 @@
+// Package gdbstub lets GDB and other tools speaking the GDB remote serial
+// protocol drive the console over TCP:
+//
+//	go run ./cmd/headless -rom game.nes -gdb localhost:2345
+//	(gdb) target remote localhost:2345
+//
+// GDB has no 6502 target, so the registers are described by target.xml:
+// A, X, Y, SP, PC and P, with PC 16 bits and the others 8. Memory reads
+// and writes have no side effects unless SideEffects is set. Breakpoints and
+// watchpoints are the ones of the debugger, so software and hardware
+// breakpoints are the same and never patch the ROM.
+package gdbstub
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/sergey121/nes-emulator/internal/debugger"
+)
+
+// maxPacket is the PacketSize the stub reports, in bytes of packet data
+const maxPacket = 0x1000
+
+const targetXML = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.gnu.gdb.mos6502.core">
+    <reg name="a" bitsize="8" type="uint8" regnum="0"/>
+    <reg name="x" bitsize="8" type="uint8"/>
+    <reg name="y" bitsize="8" type="uint8"/>
+    <reg name="sp" bitsize="8" type="uint8"/>
+    <reg name="pc" bitsize="16" type="code_ptr"/>
+    <reg name="p" bitsize="8" type="uint8"/>
+  </feature>
+</target>
+`
+
+// Sizes of the registers in bytes, in the order of target.xml
+var registerSizes = []int{1, 1, 1, 1, 2, 1}
+
+// Signals of the stop replies
+const (
+	sigint  = 2
+	sigtrap = 5
+)
+
+// point is a breakpoint as GDB set it with a Z packet
+type point struct {
+	kind   byte // '0'-'4'
+	addr   uint16
+	length int
+}
+
+// event is what the connection sends: a packet, or Ctrl-C while running
+type event struct {
+	packet    string
+	valid     bool // Checksum matched
+	interrupt bool
+	nack      bool
+}
+
+// Server serves one GDB connection at a time
+type Server struct {
+	d *debugger.Debugger
+
+	// SideEffects makes memory accesses go through Bus.CPURead and CPUWrite,
+	// so reading PPUSTATUS clears VBlank and writes reach the registers as
+	// the CPU's would. Otherwise they use Bus.Peek and Poke. Writes to ROM
+	// are patched either way, and no access hits a watchpoint.
+	// "monitor sideeffects on|off" sets it from GDB.
+	SideEffects bool
+
+	conn   io.Writer
+	events chan event
+	closed bool
+	noAck  bool
+	last   string // Last packet sent, for retransmits
+	// The client offered the swbreak and hwbreak stop reasons in qSupported
+	swbreak, hwbreak bool
+
+	points   map[point][]int // Debugger breakpoint IDs of each Z packet
+	kinds    map[int]byte    // Z packet kind of each debugger breakpoint ID
+	lastStop string
+}
+
+// New serves the console of d. The debugger keeps its own breakpoints,
+// those of GDB are removed when it detaches.
+func New(d *debugger.Debugger) *Server {
+	return &Server{
+		d:      d,
+		points: map[point][]int{},
+		kinds:  map[int]byte{},
+	}
+}
+
+// ListenAndServe accepts connections on addr and serves them one by one
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		err = s.Serve(conn)
+		conn.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Serve runs a session on conn until GDB detaches, kills or disconnects.
+// The console is stopped when it returns.
+func (s *Server) Serve(conn io.ReadWriter) error {
+	s.conn = conn
+	s.events = make(chan event)
+	s.closed = false
+	s.noAck = false
+	s.swbreak, s.hwbreak = false, false
+	s.lastStop = fmt.Sprintf("T%02xthread:01;", sigtrap)
+	done := make(chan struct{})
+	defer close(done)
+	go readEvents(conn, s.events, done)
+	defer s.clearPoints()
+
+	for !s.closed {
+		e, ok := <-s.events
+		if !ok {
+			return nil
+		}
+		if e.nack {
+			if err := s.write(s.last); err != nil {
+				return err
+			}
+			continue
+		}
+		if e.interrupt {
+			continue // Stopped already
+		}
+		if !s.noAck {
+			ack := "+"
+			if !e.valid {
+				ack = "-"
+			}
+			if _, err := io.WriteString(conn, ack); err != nil {
+				return err
+			}
+		}
+		if !e.valid {
+			continue
+		}
+
+		reply, end := s.handle(e.packet)
+		if err := s.send(reply); err != nil {
+			return err
+		}
+		if end {
+			return nil
+		}
+	}
+	return nil
+}
+
+// readEvents splits the stream into packets and interrupts until the
+// connection ends or done is closed
+func readEvents(conn io.Reader, events chan<- event, done <-chan struct{}) {
+	defer close(events)
+	send := func(e event) bool {
+		select {
+		case events <- e:
+			return true
+		case <-done:
+			return false
+		}
+	}
+	r := bufio.NewReader(conn)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		ok := true
+		switch b {
+		case 0x03:
+			ok = send(event{interrupt: true})
+		case '-':
+			ok = send(event{nack: true})
+		case '$':
+			data, err := r.ReadString('#')
+			if err != nil {
+				return
+			}
+			data = data[:len(data)-1]
+			sum := make([]byte, 2)
+			if _, err := io.ReadFull(r, sum); err != nil {
+				return
+			}
+			want, err := strconv.ParseUint(string(sum), 16, 8)
+			ok = send(event{packet: data, valid: err == nil && byte(want) == checksum(data)})
+		}
+		// '+' acks and line noise are ignored
+		if !ok {
+			return
+		}
+	}
+}
+
+func checksum(data string) byte {
+	var sum byte
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+// send writes a packet, escaping the characters the protocol reserves
+func (s *Server) send(data string) error {
+	var b strings.Builder
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '$', '#', '}', '*':
+			b.WriteByte('}')
+			b.WriteByte(c ^ 0x20)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	escaped := b.String()
+	s.last = fmt.Sprintf("$%s#%02x", escaped, checksum(escaped))
+	return s.write(s.last)
+}
+
+func (s *Server) write(packet string) error {
+	_, err := io.WriteString(s.conn, packet)
+	return err
+}
+
+// handle runs a packet and returns the reply, and whether the session ends
+func (s *Server) handle(packet string) (string, bool) {
+	if packet == "" {
+		return "", false
+	}
+	cmd, args := packet[0], packet[1:]
+	switch cmd {
+	case '?':
+		return s.lastStop, false
+	case 'g':
+		return hex.EncodeToString(s.registers()), false
+	case 'G':
+		data, err := hex.DecodeString(args)
+		if err != nil || len(data) != 7 {
+			return "E01", false
+		}
+		s.setRegisters(data)
+		return "OK", false
+	case 'p':
+		n, err := strconv.ParseUint(args, 16, 8)
+		if err != nil || int(n) >= len(registerSizes) {
+			return "E01", false
+		}
+		offset := registerOffset(int(n))
+		return hex.EncodeToString(s.registers()[offset : offset+registerSizes[n]]), false
+	case 'P':
+		reg, value, _ := strings.Cut(args, "=")
+		n, err := strconv.ParseUint(reg, 16, 8)
+		data, err2 := hex.DecodeString(value)
+		if err != nil || err2 != nil || int(n) >= len(registerSizes) || len(data) != registerSizes[n] {
+			return "E01", false
+		}
+		regs := s.registers()
+		copy(regs[registerOffset(int(n)):], data)
+		s.setRegisters(regs)
+		return "OK", false
+	case 'm':
+		addr, length, err := parseAddrLength(args)
+		if err != nil || length > maxPacket/2 {
+			return "E01", false
+		}
+		return hex.EncodeToString(s.readMemory(addr, length)), false
+	case 'M':
+		where, value, _ := strings.Cut(args, ":")
+		addr, length, err := parseAddrLength(where)
+		data, err2 := hex.DecodeString(value)
+		if err != nil || err2 != nil || len(data) != length {
+			return "E01", false
+		}
+		s.writeMemory(addr, data)
+		return "OK", false
+	case 'c', 's':
+		if args != "" {
+			pc, err := strconv.ParseUint(args, 16, 16)
+			if err != nil {
+				return "E01", false
+			}
+			s.d.Console().CPU.PC = uint16(pc)
+		}
+		return s.resume(cmd), false
+	case 'Z', 'z':
+		return s.setPoint(cmd == 'Z', args), false
+	case 'H', 'T':
+		// The console is the only thread
+		return "OK", false
+	case 'D':
+		return "OK", true
+	case 'k':
+		return "", true
+	case 'q', 'Q', 'v':
+		return s.query(packet), false
+	}
+	return "", false
+}
+
+// query handles the general q, Q and v packets
+func (s *Server) query(packet string) string {
+	name, args, _ := strings.Cut(packet, ":")
+	switch {
+	case name == "qSupported":
+		for _, feature := range strings.Split(args, ";") {
+			switch feature {
+			case "swbreak+":
+				s.swbreak = true
+			case "hwbreak+":
+				s.hwbreak = true
+			}
+		}
+		return fmt.Sprintf("PacketSize=%x;qXfer:features:read+;QStartNoAckMode+;vContSupported+;swbreak+;hwbreak+", maxPacket)
+	case name == "QStartNoAckMode":
+		s.noAck = true
+		return "OK"
+	case name == "qAttached":
+		return "1"
+	case name == "qC":
+		return "QC01"
+	case name == "qfThreadInfo":
+		return "m01"
+	case name == "qsThreadInfo":
+		return "l"
+	case name == "qOffsets":
+		return "Text=0;Data=0;Bss=0"
+	case name == "qSymbol":
+		return "OK"
+	case name == "qXfer" && strings.HasPrefix(args, "features:read:target.xml:"):
+		offset, length, err := parseAddrLength(strings.TrimPrefix(args, "features:read:target.xml:"))
+		if err != nil {
+			return "E01"
+		}
+		return xferChunk(targetXML, int(offset), length)
+	case strings.HasPrefix(packet, "qRcmd,"):
+		return s.monitor(strings.TrimPrefix(packet, "qRcmd,"))
+	case packet == "vCont?":
+		return "vCont;c;C;s;S"
+	case strings.HasPrefix(packet, "vCont;"):
+		// One thread, so the first action is the one for it
+		action := strings.TrimPrefix(packet, "vCont;") + " "
+		switch action[0] {
+		case 'c', 'C':
+			return s.resume('c')
+		case 's', 'S':
+			return s.resume('s')
+		}
+		return "E01"
+	}
+	return ""
+}
+
+// xferChunk answers a qXfer read of data
+func xferChunk(data string, offset, length int) string {
+	if offset >= len(data) {
+		return "l"
+	}
+	chunk := data[offset:]
+	if len(chunk) > length {
+		return "m" + chunk[:length]
+	}
+	return "l" + chunk
+}
+
+// monitor runs a "monitor" command: sideeffects on|off, or a command of the
+// debugger REPL. Its output goes to the GDB console.
+func (s *Server) monitor(hexCommand string) string {
+	raw, err := hex.DecodeString(hexCommand)
+	if err != nil {
+		return "E01"
+	}
+	command := strings.TrimSpace(string(raw))
+
+	var out bytes.Buffer
+	switch command {
+	case "sideeffects on", "sideeffects off":
+		s.SideEffects = command == "sideeffects on"
+		fmt.Fprintf(&out, "Memory accesses with side effects: %v\n", s.SideEffects)
+	default:
+		if err := s.d.Exec(command, &out); err != nil {
+			fmt.Fprintln(&out, "Error:", err)
+		}
+		// Commands like "scanline 241" run the console
+		if s.d.Running() {
+			if stop := s.run(); stop != nil {
+				s.d.PrintStop(&out, stop)
+			}
+		}
+	}
+
+	if out.Len() > 0 {
+		if err := s.send("O" + hex.EncodeToString(out.Bytes())); err != nil {
+			return "E01"
+		}
+	}
+	return "OK"
+}
+
+// resume continues or steps and returns the stop reply
+func (s *Server) resume(cmd byte) string {
+	var stop *debugger.Stop
+	if cmd == 's' {
+		stop = s.d.Step()
+	} else {
+		s.d.Continue()
+		stop = s.run()
+	}
+	s.lastStop = s.stopReply(stop)
+	return s.lastStop
+}
+
+// run runs the console until it stops, GDB sends Ctrl-C or disconnects
+func (s *Server) run() *debugger.Stop {
+	for {
+		select {
+		case e, ok := <-s.events:
+			if !ok {
+				s.closed = true
+				s.d.Interrupt()
+			} else if e.interrupt {
+				s.d.Interrupt()
+			}
+			// GDB sends nothing else while the target runs
+		default:
+		}
+		if stop := s.d.RunFrame(); stop != nil {
+			return stop
+		}
+	}
+}
+
+// stopReply reports a stop as a T packet with the signal GDB expects
+func (s *Server) stopReply(stop *debugger.Stop) string {
+	signal := sigtrap
+	if stop != nil && stop.Reason == "interrupted" {
+		signal = sigint
+	}
+	reply := fmt.Sprintf("T%02x", signal)
+	if stop != nil && stop.Breakpoint != nil {
+		switch s.kinds[stop.Breakpoint.ID] {
+		case '2':
+			reply += fmt.Sprintf("watch:%x;", stop.Addr)
+		case '3':
+			reply += fmt.Sprintf("rwatch:%x;", stop.Addr)
+		case '4':
+			reply += fmt.Sprintf("awatch:%x;", stop.Addr)
+		case '0':
+			// Clients that do not know these reasons get a plain T05
+			if s.swbreak {
+				reply += "swbreak:;"
+			}
+		case '1':
+			if s.hwbreak {
+				reply += "hwbreak:;"
+			}
+		}
+	}
+	return reply + "thread:01;"
+}
+
+// setPoint handles Z and z: 0 and 1 are breakpoints, 2-4 write, read and
+// access watchpoints
+func (s *Server) setPoint(insert bool, args string) string {
+	fields := strings.Split(args, ",")
+	if len(fields) < 3 || len(fields[0]) != 1 {
+		return "E01"
+	}
+	kind := fields[0][0]
+	addr, length, err := parseAddrLength(fields[1] + "," + fields[2])
+	if err != nil {
+		return "E01"
+	}
+	var kinds []debugger.Kind
+	switch kind {
+	case '0', '1':
+		kinds = []debugger.Kind{debugger.Exec}
+		length = 1 // The length is the size of the instruction, the breakpoint is on its first byte
+	case '2':
+		kinds = []debugger.Kind{debugger.Write}
+	case '3':
+		kinds = []debugger.Kind{debugger.Read}
+	case '4':
+		kinds = []debugger.Kind{debugger.Read, debugger.Write}
+	default:
+		return "" // Unsupported
+	}
+	if length < 1 {
+		length = 1
+	}
+	p := point{kind: kind, addr: addr, length: length}
+
+	if !insert {
+		for _, id := range s.points[p] {
+			s.d.DeleteBreakpoint(id)
+			delete(s.kinds, id)
+		}
+		delete(s.points, p)
+		return "OK"
+	}
+	if _, ok := s.points[p]; ok {
+		return "OK"
+	}
+	for _, k := range kinds {
+		bp := s.d.AddBreakpoint(debugger.Breakpoint{
+			Kind:  k,
+			Start: addr,
+			End:   addr + uint16(length-1),
+		})
+		s.points[p] = append(s.points[p], bp.ID)
+		s.kinds[bp.ID] = kind
+	}
+	return "OK"
+}
+
+// clearPoints removes the breakpoints GDB set
+func (s *Server) clearPoints() {
+	for _, ids := range s.points {
+		for _, id := range ids {
+			s.d.DeleteBreakpoint(id)
+		}
+	}
+	s.points = map[point][]int{}
+	s.kinds = map[int]byte{}
+}
+
+// registers returns the registers as GDB lays them out, little endian
+func (s *Server) registers() []byte {
+	c := s.d.Console().CPU
+	return []byte{c.A, c.X, c.Y, c.SP, byte(c.PC), byte(c.PC >> 8), c.P}
+}
+
+func (s *Server) setRegisters(data []byte) {
+	c := s.d.Console().CPU
+	c.A, c.X, c.Y, c.SP = data[0], data[1], data[2], data[3]
+	c.PC = uint16(data[4]) | uint16(data[5])<<8
+	c.P = data[6]
+}
+
+func registerOffset(n int) int {
+	offset := 0
+	for _, size := range registerSizes[:n] {
+		offset += size
+	}
+	return offset
+}
+
+// readMemory reads for an m packet. Its accesses never hit watchpoints.
+func (s *Server) readMemory(addr uint16, length int) []byte {
+	data := make([]byte, length)
+	bus := s.d.Console().Bus
+	s.d.Untraced(func() {
+		for i := range data {
+			if s.SideEffects {
+				data[i] = bus.CPURead(addr + uint16(i))
+			} else {
+				data[i] = bus.Peek(addr + uint16(i))
+			}
+		}
+	})
+	return data
+}
+
+// writeMemory writes for an M packet. ROM is always patched with Poke,
+// the cartridge does not take CPU writes.
+func (s *Server) writeMemory(addr uint16, data []byte) {
+	bus := s.d.Console().Bus
+	s.d.Untraced(func() {
+		for i, b := range data {
+			a := addr + uint16(i)
+			if s.SideEffects && a < 0x8000 {
+				bus.CPUWrite(a, b)
+			} else {
+				bus.Poke(a, b)
+			}
+		}
+	})
+}
+
+// parseAddrLength reads "addr,length" in hex
+func parseAddrLength(s string) (uint16, int, error) {
+	a, l, ok := strings.Cut(s, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("expected addr,length: %q", s)
+	}
+	addr, err := strconv.ParseUint(a, 16, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	length, err := strconv.ParseUint(l, 16, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint16(addr), int(length), nil
+}
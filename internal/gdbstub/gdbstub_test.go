@@ -0,0 +1,180 @@
+package gdbstub
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/sergey121/nes-emulator/internal/console"
+	"github.com/sergey121/nes-emulator/internal/debugger"
+	"github.com/sergey121/nes-emulator/internal/rom"
+)
+
+// client speaks the protocol as GDB does, acks included
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *client) send(data string) {
+	c.t.Helper()
+	fmt.Fprintf(c.conn, "$%s#%02x", data, checksum(data))
+	if b, err := c.r.ReadByte(); err != nil || b != '+' {
+		c.t.Fatalf("%s: expected an ack, got %q %v", data, b, err)
+	}
+}
+
+// receive reads a packet and acks it
+func (c *client) receive() string {
+	c.t.Helper()
+	if _, err := c.r.ReadString('$'); err != nil {
+		c.t.Fatal(err)
+	}
+	data, err := c.r.ReadString('#')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	sum := make([]byte, 2)
+	if _, err := io.ReadFull(c.r, sum); err != nil {
+		c.t.Fatal(err)
+	}
+	data = data[:len(data)-1]
+	if fmt.Sprintf("%02x", checksum(data)) != string(sum) {
+		c.t.Fatalf("bad checksum of %q", data)
+	}
+	io.WriteString(c.conn, "+")
+	return data
+}
+
+func (c *client) expect(packet, want string) {
+	c.t.Helper()
+	c.send(packet)
+	if got := c.receive(); got != want {
+		c.t.Errorf("%s: expected %q, got %q", packet, want, got)
+	}
+}
+
+// newTestServer runs a stub on a program at $8000:
+//
+//	8000  LDA #$10
+//	8002  STA $0300
+//	8005  INX
+//	8006  JMP $8005
+func newTestServer(t *testing.T) (*client, *debugger.Debugger, chan error) {
+	prg := make([]byte, 0x8000)
+	copy(prg, []byte{0xA9, 0x10, 0x8D, 0x00, 0x03, 0xE8, 0x4C, 0x05, 0x80})
+	copy(prg[0x7FFA:], []byte{0x00, 0x80, 0x00, 0x80, 0x00, 0x80})
+	d := debugger.New(console.New(&rom.Cartridge{PRG: prg, CHR: make([]byte, 0x2000)}))
+
+	server, conn := net.Pipe()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- New(d).Serve(server)
+		server.Close()
+	}()
+	t.Cleanup(func() { conn.Close() })
+	return &client{t: t, conn: conn, r: bufio.NewReader(conn)}, d, errs
+}
+
+func TestSession(t *testing.T) {
+	c, d, errs := newTestServer(t)
+
+	c.send("qSupported:multiprocess+;swbreak+")
+	if got := c.receive(); !strings.Contains(got, "qXfer:features:read+") || !strings.Contains(got, "swbreak+;hwbreak+") {
+		t.Errorf("unexpected qSupported reply %q", got)
+	}
+	c.send("qXfer:features:read:target.xml:0,20")
+	if got := c.receive(); got != "m"+targetXML[:0x20] {
+		t.Errorf("unexpected target.xml chunk %q", got)
+	}
+	c.expect("?", "T05thread:01;")
+	c.expect("g", "000000fd0080"+fmt.Sprintf("%02x", d.Console().CPU.P))
+	c.expect("p4", "0080")
+
+	c.expect("Z0,8005,1", "OK")
+	c.expect("c", "T05swbreak:;thread:01;")
+	c.expect("p0", "10")
+	c.expect("m0300,2", "1000")
+	c.expect("s", "T05thread:01;")
+	c.expect("p1", "01")
+
+	c.expect("M0300,2:abcd", "OK")
+	c.expect("m300,2", "abcd")
+	// Writes to ROM patch it, as for GDB's own breakpoints
+	c.expect("M8009,1:ea", "OK")
+	c.expect("m8009,1", "ea")
+	c.expect("M8009,1:4c", "OK")
+	c.expect("P0=42", "OK")
+	if d.Console().CPU.A != 0x42 {
+		t.Errorf("expected A=$42, got $%02X", d.Console().CPU.A)
+	}
+
+	c.expect("Z2,0300,1", "OK")
+	c.expect("c8000", "T05watch:300;thread:01;")
+	c.expect("z2,0300,1", "OK")
+	c.expect("z0,8005,1", "OK")
+	if n := len(d.Breakpoints()); n != 0 {
+		t.Errorf("expected no breakpoints left, got %d", n)
+	}
+
+	// Commands of the debugger REPL
+	c.send("qRcmd," + hex.EncodeToString([]byte("scanline 10")))
+	out, _ := hex.DecodeString(strings.TrimPrefix(c.receive(), "O"))
+	if !strings.Contains(string(out), "Stopped: scanline 10") {
+		t.Errorf("unexpected monitor output %q", out)
+	}
+	if got := c.receive(); got != "OK" {
+		t.Errorf("expected OK after the monitor output, got %q", got)
+	}
+
+	c.expect("D", "OK")
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// With side effects GDB writes ROM and accesses memory without stopping on
+// its own accesses
+func TestSideEffects(t *testing.T) {
+	c, _, _ := newTestServer(t)
+	c.send("qRcmd," + hex.EncodeToString([]byte("sideeffects on")))
+	c.receive()
+	if got := c.receive(); got != "OK" {
+		t.Fatalf("expected OK after the monitor output, got %q", got)
+	}
+
+	c.expect("M8000,1:a9", "OK")
+	c.expect("m8000,1", "a9")
+	c.expect("Z2,0301,1", "OK")
+	c.expect("Z3,0302,1", "OK")
+	c.expect("M0301,1:55", "OK")
+	c.expect("m0302,1", "00")
+	c.expect("Z0,8005,1", "OK")
+	// No qSupported offered swbreak, so the stop has no reason
+	c.expect("c", "T05thread:01;")
+}
+
+func TestInterrupt(t *testing.T) {
+	c, _, _ := newTestServer(t)
+	c.send("c")
+	// Ctrl-C while the console runs
+	c.conn.Write([]byte{0x03})
+	if got := c.receive(); got != "T02thread:01;" {
+		t.Errorf("expected SIGINT, got %q", got)
+	}
+	c.expect("vCont?", "vCont;c;C;s;S")
+}
+
+func TestBadChecksum(t *testing.T) {
+	c, _, _ := newTestServer(t)
+	io.WriteString(c.conn, "$g#00")
+	if b, _ := c.r.ReadByte(); b != '-' {
+		t.Errorf("expected a nack, got %q", b)
+	}
+	c.expect("qAttached", "1")
+}
@@ -15,10 +15,18 @@ type Controller struct {
 	buttons byte // Current state of buttons (set by emulator host)
 	strobe  byte // Strobe mode (0 or 1)
 	state   byte // Internal shift register for serial reading
+
+	// Host side processing applied by Update, see turbo.go
+	turboOn, turboOff int
+	turboFrame        int
+	directions        DirectionFilter
 }
 
 func NewController() *Controller {
-	return &Controller{}
+	return &Controller{
+		turboOn:  DefaultTurboOn,
+		turboOff: DefaultTurboOff,
+	}
 }
 
 // SetButtons updates the current state of the buttons from the input source (keyboard/gamepad)
@@ -26,6 +34,11 @@ func (c *Controller) SetButtons(buttons byte) {
 	c.buttons = buttons
 }
 
+// Buttons returns the state the game will latch on the next strobe
+func (c *Controller) Buttons() byte {
+	return c.buttons
+}
+
 // Write handles writing to the controller port (usually $4016)
 // Writing 1 sets strobe mode (continuously reloading state).
 // Writing 0 clears strobe mode.
@@ -55,3 +68,9 @@ func (c *Controller) Read() byte {
 
 	return value
 }
+
+// Peek returns what Read would, without shifting the report
+func (c *Controller) Peek() byte {
+	dup := *c
+	return dup.Read()
+}
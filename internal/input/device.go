@@ -0,0 +1,120 @@
+package input
+
+import (
+	"fmt"
+	"strings"
+)
+
+// InputDevice is anything plugged into one of the controller ports.
+// Write receives every CPU write to $4016 (OUT0-OUT2 in bits 0-2, bit 0 is the
+// strobe shared by both ports). Read returns the next report bits on D0-D4 of
+// $4016 (port 1) or $4017 (port 2). Peek returns the same bits as Read
+// without side effects, for debuggers.
+type InputDevice interface {
+	Write(data byte)
+	Read() byte
+	Peek() byte
+}
+
+// ExpansionDevice is plugged into the Famicom expansion port. Unlike the
+// controller ports it is wired to both $4016 and $4017, so reads are told
+// which register is being read (0 for $4016, 1 for $4017).
+type ExpansionDevice interface {
+	Write(data byte)
+	ReadPort(port int) byte
+	PeekPort(port int) byte
+}
+
+// DeviceType identifies a device that can be selected for a port
+type DeviceType int
+
+const (
+	DeviceNone DeviceType = iota
+	DeviceJoypad
+	DeviceFourScore   // NES Four Score / Satellite, one half per port
+	DeviceHori        // Hori 4 Players Adapter in 4-player mode (expansion port)
+	DeviceFamicomPads // Famicom expansion controllers 3 and 4 (expansion port)
+	DeviceZapper
+	DeviceVaus          // Arkanoid controller, NES version (controller port)
+	DeviceVausFamicom   // Arkanoid controller, Famicom version (expansion port)
+	DevicePowerPad      // Power Pad (controller port)
+	DeviceFamilyTrainer // Family Trainer mat (expansion port)
+	DeviceKeyboard      // Family BASIC keyboard (expansion port)
+)
+
+var deviceNames = map[DeviceType]string{
+	DeviceNone:          "none",
+	DeviceJoypad:        "joypad",
+	DeviceFourScore:     "fourscore",
+	DeviceHori:          "hori",
+	DeviceFamicomPads:   "famicom-pads",
+	DeviceZapper:        "zapper",
+	DeviceVaus:          "vaus",
+	DeviceVausFamicom:   "vaus-famicom",
+	DevicePowerPad:      "powerpad",
+	DeviceFamilyTrainer: "family-trainer",
+	DeviceKeyboard:      "keyboard",
+}
+
+func (d DeviceType) String() string {
+	if name, ok := deviceNames[d]; ok {
+		return name
+	}
+	return fmt.Sprintf("DeviceType(%d)", int(d))
+}
+
+// ParseDeviceType returns the device type for a name as printed by String
+func ParseDeviceType(name string) (DeviceType, error) {
+	for d, n := range deviceNames {
+		if strings.EqualFold(n, name) {
+			return d, nil
+		}
+	}
+	return DeviceNone, fmt.Errorf("unknown input device: %q", name)
+}
+
+// IsExpansion reports whether the device plugs into the Famicom expansion port
+// rather than one of the controller ports.
+func (d DeviceType) IsExpansion() bool {
+	switch d {
+	case DeviceHori, DeviceFamicomPads, DeviceVausFamicom, DeviceFamilyTrainer, DeviceKeyboard:
+		return true
+	}
+	return false
+}
+
+// DefaultDevices maps the NES 2.0 "default expansion device" header field
+// to the devices that should be attached to port 1, port 2 and the expansion port.
+// ok is false when the field does not name a supported setup.
+// https://www.nesdev.org/wiki/NES_2.0#Default_Expansion_Device
+func DefaultDevices(id byte) (port1, port2, expansion DeviceType, ok bool) {
+	switch id {
+	case 0x01: // Standard NES/Famicom controllers
+		return DeviceJoypad, DeviceJoypad, DeviceNone, true
+	case 0x02: // NES Four Score/Satellite with two additional standard controllers
+		return DeviceFourScore, DeviceFourScore, DeviceNone, true
+	case 0x03: // Famicom Four Players Adapter, "simple" protocol
+		return DeviceJoypad, DeviceJoypad, DeviceFamicomPads, true
+	case 0x08: // Zapper ($4017)
+		return DeviceJoypad, DeviceZapper, DeviceNone, true
+	case 0x09: // Two Zappers
+		return DeviceZapper, DeviceZapper, DeviceNone, true
+	case 0x0B, 0x0C: // Power Pad side A/B
+		return DeviceJoypad, DevicePowerPad, DeviceNone, true
+	case 0x0D, 0x0E: // Family Trainer side A/B
+		return DeviceJoypad, DeviceJoypad, DeviceFamilyTrainer, true
+	case 0x0F: // Arkanoid Vaus controller (NES)
+		return DeviceJoypad, DeviceVaus, DeviceNone, true
+	case 0x10, 0x11: // Arkanoid Vaus controller (Famicom), with or without a second one
+		return DeviceJoypad, DeviceJoypad, DeviceVausFamicom, true
+	case 0x23: // Family BASIC Keyboard plus Famicom Data Recorder
+		return DeviceJoypad, DeviceJoypad, DeviceKeyboard, true
+	}
+	return DeviceJoypad, DeviceJoypad, DeviceNone, false
+}
+
+// DefaultMatSideA reports whether the NES 2.0 default expansion device is a
+// Power Pad or Family Trainer used on side A, see MirrorPowerPad
+func DefaultMatSideA(id byte) bool {
+	return id == 0x0B || id == 0x0D
+}
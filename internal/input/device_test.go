@@ -0,0 +1,99 @@
+package input
+
+import "testing"
+
+func readBits(n int, read func() byte) []byte {
+	bits := make([]byte, n)
+	for i := range bits {
+		bits[i] = read()
+	}
+	return bits
+}
+
+func TestFourScoreReport(t *testing.T) {
+	p1, p2, p3, p4 := NewController(), NewController(), NewController(), NewController()
+	p1.SetButtons(ButtonA)
+	p3.SetButtons(ButtonStart)
+	p2.SetButtons(ButtonB)
+	p4.SetButtons(ButtonRight)
+
+	port1 := NewFourScore(1, p1, p3)
+	port2 := NewFourScore(2, p2, p4)
+	for _, d := range []InputDevice{port1, port2} {
+		d.Write(1)
+		d.Write(0)
+	}
+
+	expected1 := []byte{
+		1, 0, 0, 0, 0, 0, 0, 0, // Controller 1: A
+		0, 0, 0, 1, 0, 0, 0, 0, // Controller 3: Start
+		0, 0, 0, 1, 0, 0, 0, 0, // Signature $10
+		1, // 1s after the report
+	}
+	expected2 := []byte{
+		0, 1, 0, 0, 0, 0, 0, 0, // Controller 2: B
+		0, 0, 0, 0, 0, 0, 0, 1, // Controller 4: Right
+		0, 0, 1, 0, 0, 0, 0, 0, // Signature $20
+		1,
+	}
+
+	got1 := readBits(len(expected1), port1.Read)
+	got2 := readBits(len(expected2), port2.Read)
+	for i := range expected1 {
+		if got1[i] != expected1[i] {
+			t.Errorf("$4016 bit %d: expected %d, got %d", i, expected1[i], got1[i])
+		}
+		if got2[i] != expected2[i] {
+			t.Errorf("$4017 bit %d: expected %d, got %d", i, expected2[i], got2[i])
+		}
+	}
+}
+
+func TestHoriAdapterModes(t *testing.T) {
+	p1, p2, p3, p4 := NewController(), NewController(), NewController(), NewController()
+	p3.SetButtons(ButtonA)
+	p4.SetButtons(ButtonB)
+
+	// Simple mode: controllers 3 and 4 on D1, no signature
+	hori := NewHoriAdapter(p1, p2, p3, p4, false)
+	hori.Write(1)
+	hori.Write(0)
+	if got := hori.ReadPort(0); got != 0x02 {
+		t.Errorf("simple mode $4016: expected $02, got %02X", got)
+	}
+	if got := hori.ReadPort(1); got != 0x00 {
+		t.Errorf("simple mode $4017 bit 0: expected $00, got %02X", got)
+	}
+	if got := hori.ReadPort(1); got != 0x02 {
+		t.Errorf("simple mode $4017 bit 1: expected $02, got %02X", got)
+	}
+
+	// 4-player mode: signature $20 on $4016 after 16 bits of controllers
+	hori.FourPlayerMode = true
+	hori.Write(1)
+	hori.Write(0)
+	bits := readBits(24, func() byte { return hori.ReadPort(0) >> 1 })
+	signature := bits[16:]
+	expected := []byte{0, 0, 1, 0, 0, 0, 0, 0}
+	for i := range expected {
+		if signature[i] != expected[i] {
+			t.Errorf("4-player signature bit %d: expected %d, got %d", i, expected[i], signature[i])
+		}
+	}
+	if bits[8] != 1 {
+		t.Errorf("4-player mode: expected controller 3 A in bit 8")
+	}
+}
+
+// The header defaults put every device into a port it fits
+func TestDefaultDevicesPorts(t *testing.T) {
+	for id := 0; id < 0x40; id++ {
+		port1, port2, expansion, _ := DefaultDevices(byte(id))
+		if port1.IsExpansion() || port2.IsExpansion() {
+			t.Errorf("device $%02X: expansion device %v/%v in a controller port", id, port1, port2)
+		}
+		if expansion != DeviceNone && !expansion.IsExpansion() {
+			t.Errorf("device $%02X: %v in the expansion port", id, expansion)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package input
+
+// FourScore is one half of the NES Four Score / Satellite adapter.
+// The adapter occupies both controller ports: the half on port 1 reports
+// controllers 1 and 3, the half on port 2 reports controllers 2 and 4.
+// https://www.nesdev.org/wiki/Four_player_adapters
+//
+// Each report is 24 bits long: 8 bits of the first controller, 8 bits of the
+// second one and an 8 bit signature that lets games detect the adapter.
+type FourScore struct {
+	first     *Controller
+	second    *Controller
+	signature byte
+
+	strobe byte
+	state  uint32 // Internal shift register for serial reading
+	reads  int    // Number of bits shifted out since the last strobe
+}
+
+// Signatures are $10 on $4016 and $20 on $4017 when read MSB first,
+// so they are stored bit-reversed in the LSB first shift register.
+const (
+	fourScoreSignature1 = 0x08
+	fourScoreSignature2 = 0x04
+)
+
+// NewFourScore creates the half of the adapter plugged into port (1 or 2)
+func NewFourScore(port int, first, second *Controller) *FourScore {
+	signature := byte(fourScoreSignature1)
+	if port == 2 {
+		signature = fourScoreSignature2
+	}
+	return &FourScore{
+		first:     first,
+		second:    second,
+		signature: signature,
+	}
+}
+
+func (f *FourScore) reload() {
+	f.state = uint32(f.first.buttons) | uint32(f.second.buttons)<<8 | uint32(f.signature)<<16
+	f.reads = 0
+}
+
+func (f *FourScore) Write(data byte) {
+	f.strobe = data & 1
+	if f.strobe == 1 {
+		f.reload()
+	}
+}
+
+func (f *FourScore) Read() byte {
+	if f.strobe == 1 {
+		f.reload()
+		return byte(f.state & 1)
+	}
+
+	if f.reads >= 24 {
+		// Like the standard controller, the adapter returns 1s after the report
+		return 1
+	}
+
+	value := byte(f.state & 1)
+	f.state >>= 1
+	f.reads++
+	return value
+}
+
+// Peek returns what Read would, without shifting the report
+func (f *FourScore) Peek() byte {
+	dup := *f
+	return dup.Read()
+}
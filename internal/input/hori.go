@@ -0,0 +1,82 @@
+package input
+
+// HoriAdapter is a Famicom four player adapter plugged into the expansion port.
+// Its controllers are reported on D1 of $4016 and $4017.
+// https://www.nesdev.org/wiki/Four_player_adapters
+//
+// In 2-player ("simple") mode it behaves like plain expansion controllers:
+// controller 3 is read on $4016 D1 and controller 4 on $4017 D1.
+// In 4-player mode it sends a 24 bit report per register like the Four Score:
+// controllers 1 and 3 on $4016, controllers 2 and 4 on $4017, followed by the
+// signature ($20 on $4016 and $10 on $4017, swapped compared to the Four Score).
+type HoriAdapter struct {
+	controllers    [4]*Controller
+	FourPlayerMode bool
+
+	strobe byte
+	state  [2]uint32 // Shift registers for $4016 and $4017
+	reads  [2]int
+}
+
+// Signatures stored bit-reversed for LSB first shifting
+const (
+	horiSignature1 = 0x04 // $20
+	horiSignature2 = 0x08 // $10
+)
+
+// NewHoriAdapter creates an adapter with four controllers attached.
+// fourPlayer selects the position of the 2P/4P switch.
+func NewHoriAdapter(c1, c2, c3, c4 *Controller, fourPlayer bool) *HoriAdapter {
+	return &HoriAdapter{
+		controllers:    [4]*Controller{c1, c2, c3, c4},
+		FourPlayerMode: fourPlayer,
+	}
+}
+
+func (h *HoriAdapter) reload() {
+	if h.FourPlayerMode {
+		h.state[0] = uint32(h.controllers[0].buttons) | uint32(h.controllers[2].buttons)<<8 | horiSignature1<<16
+		h.state[1] = uint32(h.controllers[1].buttons) | uint32(h.controllers[3].buttons)<<8 | horiSignature2<<16
+	} else {
+		h.state[0] = uint32(h.controllers[2].buttons)
+		h.state[1] = uint32(h.controllers[3].buttons)
+	}
+	h.reads[0] = 0
+	h.reads[1] = 0
+}
+
+func (h *HoriAdapter) reportLength() int {
+	if h.FourPlayerMode {
+		return 24
+	}
+	return 8
+}
+
+func (h *HoriAdapter) Write(data byte) {
+	h.strobe = data & 1
+	if h.strobe == 1 {
+		h.reload()
+	}
+}
+
+func (h *HoriAdapter) ReadPort(port int) byte {
+	if h.strobe == 1 {
+		h.reload()
+		return byte(h.state[port]&1) << 1
+	}
+
+	if h.reads[port] >= h.reportLength() {
+		return 1 << 1
+	}
+
+	value := byte(h.state[port] & 1)
+	h.state[port] >>= 1
+	h.reads[port]++
+	return value << 1
+}
+
+// PeekPort returns what ReadPort would, without shifting the report
+func (h *HoriAdapter) PeekPort(port int) byte {
+	dup := *h
+	return dup.ReadPort(port)
+}
@@ -0,0 +1,154 @@
+package input
+
+// FamilyKey identifies a key of the Family BASIC keyboard.
+// Keys are numbered in matrix order: row*8 + column*4 + n, where n = 0 is
+// the key reported on D4 and n = 3 the key reported on D1.
+type FamilyKey int
+
+const (
+	// Row 0
+	FamilyKeyRightBracket FamilyKey = iota
+	FamilyKeyLeftBracket
+	FamilyKeyReturn
+	FamilyKeyF8
+	FamilyKeyStop
+	FamilyKeyYen
+	FamilyKeyRightShift
+	FamilyKeyKana
+	// Row 1
+	FamilyKeySemicolon
+	FamilyKeyColon
+	FamilyKeyAt
+	FamilyKeyF7
+	FamilyKeyCaret
+	FamilyKeyMinus
+	FamilyKeySlash
+	FamilyKeyUnderscore
+	// Row 2
+	FamilyKeyK
+	FamilyKeyL
+	FamilyKeyO
+	FamilyKeyF6
+	FamilyKey0
+	FamilyKeyP
+	FamilyKeyComma
+	FamilyKeyPeriod
+	// Row 3
+	FamilyKeyJ
+	FamilyKeyU
+	FamilyKeyI
+	FamilyKeyF5
+	FamilyKey8
+	FamilyKey9
+	FamilyKeyN
+	FamilyKeyM
+	// Row 4
+	FamilyKeyH
+	FamilyKeyG
+	FamilyKeyY
+	FamilyKeyF4
+	FamilyKey6
+	FamilyKey7
+	FamilyKeyV
+	FamilyKeyB
+	// Row 5
+	FamilyKeyD
+	FamilyKeyR
+	FamilyKeyT
+	FamilyKeyF3
+	FamilyKey4
+	FamilyKey5
+	FamilyKeyC
+	FamilyKeyF
+	// Row 6
+	FamilyKeyA
+	FamilyKeyS
+	FamilyKeyW
+	FamilyKeyF2
+	FamilyKey3
+	FamilyKeyE
+	FamilyKeyZ
+	FamilyKeyX
+	// Row 7
+	FamilyKeyCtrl
+	FamilyKeyQ
+	FamilyKeyEsc
+	FamilyKeyF1
+	FamilyKey2
+	FamilyKey1
+	FamilyKeyGraph
+	FamilyKeyLeftShift
+	// Row 8
+	FamilyKeyLeft
+	FamilyKeyRight
+	FamilyKeyUp
+	FamilyKeyClrHome
+	FamilyKeyIns
+	FamilyKeyDel
+	FamilyKeySpace
+	FamilyKeyDown
+
+	familyKeyCount
+)
+
+const familyKeyboardRows = 9
+
+// FamilyKeyboard is the Family BASIC keyboard on the Famicom expansion port.
+// https://www.nesdev.org/wiki/Family_BASIC_Keyboard
+//
+// Writes to $4016: bit 0 resets the scan to row 0, bit 1 selects the column
+// (a 1 to 0 transition advances to the next row) and bit 2 enables the matrix.
+// Reads from $4017 return the 4 keys of the selected row and column on D4-D1,
+// 0 meaning pressed.
+type FamilyKeyboard struct {
+	keys [familyKeyCount]bool
+
+	row     int
+	column  int
+	enabled bool
+}
+
+func NewFamilyKeyboard() *FamilyKeyboard {
+	return &FamilyKeyboard{}
+}
+
+// SetKey updates the state of a single key
+func (k *FamilyKeyboard) SetKey(key FamilyKey, pressed bool) {
+	if key >= 0 && key < familyKeyCount {
+		k.keys[key] = pressed
+	}
+}
+
+func (k *FamilyKeyboard) Write(data byte) {
+	column := int(data>>1) & 1
+	if k.column == 1 && column == 0 {
+		k.row++
+	}
+	k.column = column
+	if data&0x01 != 0 {
+		k.row = 0
+	}
+	k.enabled = data&0x04 != 0
+}
+
+func (k *FamilyKeyboard) ReadPort(port int) byte {
+	if port == 0 || !k.enabled {
+		return 0
+	}
+
+	value := byte(0x1E)
+	if k.row >= familyKeyboardRows {
+		return value
+	}
+
+	first := FamilyKey(k.row*8 + k.column*4)
+	for n := 0; n < 4; n++ {
+		if k.keys[first+FamilyKey(n)] {
+			value &^= 1 << (4 - n)
+		}
+	}
+	return value
+}
+
+// PeekPort is ReadPort, which has no side effects: the row only moves on writes
+func (k *FamilyKeyboard) PeekPort(port int) byte { return k.ReadPort(port) }
@@ -0,0 +1,113 @@
+package input
+
+import "testing"
+
+func TestVausPositionReport(t *testing.T) {
+	vaus := NewVaus()
+	vaus.SetPosition(0)
+	vaus.SetButton(true)
+
+	vaus.Write(1)
+	vaus.Write(0)
+
+	// Position is sent MSB first and inverted on D3
+	var position byte
+	for i := 0; i < 8; i++ {
+		value := vaus.Read()
+		if value&0x10 == 0 {
+			t.Errorf("read %d: expected button bit on D4", i)
+		}
+		position = position<<1 | (value>>3)&1
+	}
+	if ^position != VausMinPosition {
+		t.Errorf("expected position %02X, got %02X", VausMinPosition, ^position)
+	}
+
+	// Famicom version: button on $4016 D1, position on $4017 D1
+	vaus.SetPosition(255)
+	vaus.Write(1)
+	vaus.Write(0)
+	if vaus.ReadPort(0) != 0x02 {
+		t.Errorf("expected button on $4016 D1")
+	}
+	position = 0
+	for i := 0; i < 8; i++ {
+		position = position<<1 | (vaus.ReadPort(1)>>1)&1
+	}
+	if ^position != VausMaxPosition {
+		t.Errorf("expected position %02X, got %02X", VausMaxPosition, ^position)
+	}
+}
+
+func TestPowerPadReport(t *testing.T) {
+	pad := NewPowerPad()
+	pad.SetButtons(PowerPadButton(1) | PowerPadButton(3) | PowerPadButton(7))
+	pad.Write(1)
+	pad.Write(0)
+
+	// D3: 2, 1, 5, 9, 6, 10, 11, 7; D4: 4, 3, 12, 8, then 1s
+	expectedD3 := []byte{0, 1, 0, 0, 0, 0, 0, 1}
+	expectedD4 := []byte{0, 1, 0, 0, 1, 1, 1, 1}
+	for i := range expectedD3 {
+		value := pad.Read()
+		if d3 := (value >> 3) & 1; d3 != expectedD3[i] {
+			t.Errorf("read %d: expected D3=%d, got %d", i, expectedD3[i], d3)
+		}
+		if d4 := (value >> 4) & 1; d4 != expectedD4[i] {
+			t.Errorf("read %d: expected D4=%d, got %d", i, expectedD4[i], d4)
+		}
+	}
+
+	if MirrorPowerPad(PowerPadButton(1)|PowerPadButton(6)) != PowerPadButton(4)|PowerPadButton(7) {
+		t.Errorf("unexpected side A mirroring")
+	}
+	for id, sideA := range map[byte]bool{0x0B: true, 0x0C: false, 0x0D: true, 0x0E: false, 0x01: false} {
+		if DefaultMatSideA(id) != sideA {
+			t.Errorf("expansion device $%02X: expected side A %v", id, sideA)
+		}
+	}
+}
+
+func TestFamilyTrainerMatrix(t *testing.T) {
+	mat := NewFamilyTrainer()
+	mat.SetButtons(PowerPadButton(1) | PowerPadButton(12))
+
+	mat.Write(0x03) // OUT2 low: buttons 1-4
+	if got := mat.ReadPort(1); got != 0x0E {
+		t.Errorf("row 1-4: expected $0E, got %02X", got)
+	}
+	mat.Write(0x05) // OUT1 low: buttons 5-8
+	if got := mat.ReadPort(1); got != 0x1E {
+		t.Errorf("row 5-8: expected $1E, got %02X", got)
+	}
+	mat.Write(0x06) // OUT0 low: buttons 9-12
+	if got := mat.ReadPort(1); got != 0x1C {
+		t.Errorf("row 9-12: expected $1C, got %02X", got)
+	}
+}
+
+func TestFamilyKeyboardScan(t *testing.T) {
+	kb := NewFamilyKeyboard()
+	kb.SetKey(FamilyKeyReturn, true) // Row 0, column 0, D2
+	kb.SetKey(FamilyKeyX, true)      // Row 6, column 1, D1
+
+	// Disabled keyboard does not drive the bus
+	if got := kb.ReadPort(1); got != 0 {
+		t.Errorf("disabled: expected $00, got %02X", got)
+	}
+
+	kb.Write(0x05) // Reset to row 0, enable
+	kb.Write(0x04) // Column 0
+	if got := kb.ReadPort(1); got != 0x1A {
+		t.Errorf("row 0 column 0: expected $1A, got %02X", got)
+	}
+
+	for row := 0; row < 6; row++ {
+		kb.Write(0x06) // Column 1
+		kb.Write(0x04) // Column 0, next row
+	}
+	kb.Write(0x06)
+	if got := kb.ReadPort(1); got != 0x1C {
+		t.Errorf("row 6 column 1: expected $1C, got %02X", got)
+	}
+}
@@ -0,0 +1,143 @@
+package input
+
+// PowerPad is the Bandai/Nintendo exercise mat with 12 buttons.
+// Buttons are numbered 1-12 as printed on side B of the mat:
+//
+//	1  2  3  4
+//	5  6  7  8
+//	9 10 11 12
+//
+// Side A is the same mat turned over, so its buttons are mirrored horizontally.
+// SetButtons takes a bit mask where bit n-1 is button n.
+// https://www.nesdev.org/wiki/Power_Pad
+type PowerPad struct {
+	buttons uint16
+
+	strobe byte
+	low    byte // D3 shift register: buttons 2, 1, 5, 9, 6, 10, 11, 7
+	high   byte // D4 shift register: buttons 4, 3, 12, 8
+}
+
+// Order in which buttons are shifted out on D3 and D4
+var (
+	powerPadLowOrder  = [8]int{2, 1, 5, 9, 6, 10, 11, 7}
+	powerPadHighOrder = [4]int{4, 3, 12, 8}
+)
+
+func NewPowerPad() *PowerPad {
+	return &PowerPad{}
+}
+
+// SetButtons updates the pressed buttons (bit n-1 is button n)
+func (p *PowerPad) SetButtons(buttons uint16) {
+	p.buttons = buttons
+}
+
+// PowerPadButton returns the SetButtons mask for button n (1-12)
+func PowerPadButton(n int) uint16 {
+	return 1 << (n - 1)
+}
+
+// MirrorPowerPad converts button masks between side A and side B numbering
+func MirrorPowerPad(buttons uint16) uint16 {
+	var mirrored uint16
+	for n := 1; n <= 12; n++ {
+		if buttons&PowerPadButton(n) != 0 {
+			row, col := (n-1)/4, (n-1)%4
+			mirrored |= PowerPadButton(row*4 + (3 - col) + 1)
+		}
+	}
+	return mirrored
+}
+
+func (p *PowerPad) reload() {
+	p.low, p.high = 0, 0
+	for i, n := range powerPadLowOrder {
+		if p.buttons&PowerPadButton(n) != 0 {
+			p.low |= 1 << i
+		}
+	}
+	for i, n := range powerPadHighOrder {
+		if p.buttons&PowerPadButton(n) != 0 {
+			p.high |= 1 << i
+		}
+	}
+	// After the 4 buttons D4 reports 1s
+	p.high |= 0xF0
+}
+
+func (p *PowerPad) Write(data byte) {
+	p.strobe = data & 1
+	if p.strobe == 1 {
+		p.reload()
+	}
+}
+
+func (p *PowerPad) Read() byte {
+	if p.strobe == 1 {
+		p.reload()
+	}
+	value := (p.low&1)<<3 | (p.high&1)<<4
+	if p.strobe == 0 {
+		p.low = p.low>>1 | 0x80
+		p.high = p.high>>1 | 0x80
+	}
+	return value
+}
+
+// Peek returns what Read would, without shifting the report
+func (p *PowerPad) Peek() byte {
+	dup := *p
+	return dup.Read()
+}
+
+// FamilyTrainer is the Famicom version of the Power Pad on the expansion port.
+// Instead of a serial report, the buttons are read as a matrix: the row is
+// selected by writing 0 to one of OUT2 (buttons 1-4), OUT1 (5-8) or OUT0 (9-12)
+// and the 4 buttons of the row are read on $4017 D4-D1 (0 = pressed).
+// https://www.nesdev.org/wiki/Family_Trainer_Mat
+type FamilyTrainer struct {
+	buttons uint16
+	out     byte
+}
+
+func NewFamilyTrainer() *FamilyTrainer {
+	return &FamilyTrainer{out: 0x07}
+}
+
+// SetButtons updates the pressed buttons (bit n-1 is button n)
+func (f *FamilyTrainer) SetButtons(buttons uint16) {
+	f.buttons = buttons
+}
+
+func (f *FamilyTrainer) Write(data byte) {
+	f.out = data & 0x07
+}
+
+func (f *FamilyTrainer) ReadPort(port int) byte {
+	if port == 0 {
+		return 0
+	}
+
+	var pressed uint16
+	if f.out&0x04 == 0 {
+		pressed |= f.buttons & 0x000F // Buttons 1-4
+	}
+	if f.out&0x02 == 0 {
+		pressed |= (f.buttons >> 4) & 0x000F // Buttons 5-8
+	}
+	if f.out&0x01 == 0 {
+		pressed |= (f.buttons >> 8) & 0x000F // Buttons 9-12
+	}
+	// Button 1 of the row is on D4, button 4 on D1
+	var value byte
+	for i := 0; i < 4; i++ {
+		if pressed&(1<<i) == 0 {
+			value |= 1 << (4 - i)
+		}
+	}
+	return value
+}
+
+// PeekPort is ReadPort, which has no side effects: the row only changes on writes
+func (f *FamilyTrainer) PeekPort(port int) byte { return f.ReadPort(port) }
@@ -0,0 +1,70 @@
+package input
+
+// Default autofire rate: 2 frames pressed, 2 released (15 presses per second at 60 Hz)
+const (
+	DefaultTurboOn  = 2
+	DefaultTurboOff = 2
+)
+
+// DirectionFilter selects what happens when opposite directions are held together
+type DirectionFilter int
+
+const (
+	// BlockOpposite releases both Left+Right (or Up+Down) when held together.
+	// A real D-pad can not press them, and some games crash on it.
+	BlockOpposite DirectionFilter = iota
+	// AllowOpposite passes opposite directions to the game unchanged
+	AllowOpposite
+)
+
+// SetTurboRate sets the autofire rate in frames pressed and frames released
+func (c *Controller) SetTurboRate(on, off int) {
+	if on < 1 {
+		on = 1
+	}
+	if off < 1 {
+		off = 1
+	}
+	c.turboOn, c.turboOff = on, off
+	c.turboFrame = 0
+}
+
+// SetDirectionFilter selects how opposite directions are handled by Update
+func (c *Controller) SetDirectionFilter(f DirectionFilter) {
+	c.directions = f
+}
+
+// Update sets the buttons from the host input once per frame.
+// held are the buttons pressed normally, turbo the buttons whose autofire
+// input is held. The result goes through SetButtons, so Buttons returns
+// exactly what the game sees and input movies can replay it without turbo.
+func (c *Controller) Update(held, turbo byte) {
+	buttons := held
+
+	if turbo == 0 {
+		// Restart the cycle so the next autofire press is seen immediately
+		c.turboFrame = 0
+	} else {
+		if c.turboFrame < c.turboOn {
+			buttons |= turbo
+		}
+		c.turboFrame = (c.turboFrame + 1) % (c.turboOn + c.turboOff)
+	}
+
+	if c.directions == BlockOpposite {
+		buttons = filterOpposite(buttons)
+	}
+
+	c.SetButtons(buttons)
+}
+
+// filterOpposite releases both buttons of an opposite direction pair
+func filterOpposite(buttons byte) byte {
+	if buttons&(ButtonLeft|ButtonRight) == ButtonLeft|ButtonRight {
+		buttons &^= ButtonLeft | ButtonRight
+	}
+	if buttons&(ButtonUp|ButtonDown) == ButtonUp|ButtonDown {
+		buttons &^= ButtonUp | ButtonDown
+	}
+	return buttons
+}
@@ -0,0 +1,43 @@
+package input
+
+import "testing"
+
+func TestTurbo(t *testing.T) {
+	c := NewController()
+	c.SetTurboRate(2, 1)
+
+	expected := []byte{1, 1, 0, 1, 1, 0, 1}
+	for frame, want := range expected {
+		c.Update(0, ButtonA)
+		if got := c.Buttons() & ButtonA; got != want {
+			t.Errorf("frame %d: expected A=%d, got %d", frame, want, got)
+		}
+	}
+
+	// Releasing turbo restarts the cycle, held buttons win over turbo
+	c.Update(0, 0)
+	c.Update(ButtonB, ButtonA|ButtonB)
+	if got := c.Buttons(); got != ButtonA|ButtonB {
+		t.Errorf("expected A+B after restart, got %08b", got)
+	}
+	c.Update(ButtonB, ButtonA|ButtonB)
+	c.Update(ButtonB, ButtonA|ButtonB)
+	if got := c.Buttons(); got != ButtonB {
+		t.Errorf("expected only B in the off phase, got %08b", got)
+	}
+}
+
+func TestOppositeDirections(t *testing.T) {
+	c := NewController()
+
+	c.Update(ButtonLeft|ButtonRight|ButtonUp|ButtonA, 0)
+	if got := c.Buttons(); got != ButtonUp|ButtonA {
+		t.Errorf("blocked: expected Up+A, got %08b", got)
+	}
+
+	c.SetDirectionFilter(AllowOpposite)
+	c.Update(ButtonLeft|ButtonRight|ButtonUp|ButtonDown, 0)
+	if got := c.Buttons(); got != ButtonLeft|ButtonRight|ButtonUp|ButtonDown {
+		t.Errorf("allowed: expected all directions, got %08b", got)
+	}
+}
@@ -0,0 +1,91 @@
+package input
+
+// Vaus is the Arkanoid paddle controller.
+// https://www.nesdev.org/wiki/Arkanoid_controller
+//
+// The knob position is sent as an 8 bit serial report, MSB first and inverted.
+// The NES version plugs into a controller port and reports the position on D3
+// and the button on D4. The Famicom version plugs into the expansion port and
+// reports the button on $4016 D1 and the position on $4017 D1.
+// Vaus implements both InputDevice and ExpansionDevice, so the same value can
+// be attached either way.
+type Vaus struct {
+	position byte // Potentiometer value
+	button   bool
+
+	strobe byte
+	state  byte // Shift register, the next bit to send is bit 7
+}
+
+// Range of potentiometer values produced by the original controller
+const (
+	VausMinPosition = 0x62
+	VausMaxPosition = 0xF2
+)
+
+func NewVaus() *Vaus {
+	return &Vaus{position: (VausMinPosition + VausMaxPosition) / 2}
+}
+
+// SetPosition moves the knob so that the paddle follows screen column x (0-255)
+func (v *Vaus) SetPosition(x int) {
+	if x < 0 {
+		x = 0
+	}
+	if x > 255 {
+		x = 255
+	}
+	v.position = byte(VausMinPosition + x*(VausMaxPosition-VausMinPosition)/255)
+}
+
+// SetButton updates the state of the fire button
+func (v *Vaus) SetButton(pressed bool) {
+	v.button = pressed
+}
+
+func (v *Vaus) Write(data byte) {
+	// The position is latched on the falling edge of the strobe
+	if v.strobe == 1 && data&1 == 0 {
+		v.state = ^v.position
+	}
+	v.strobe = data & 1
+}
+
+// shift returns the next bit of the position report
+func (v *Vaus) shift() byte {
+	value := v.state >> 7
+	v.state <<= 1
+	return value
+}
+
+// Read is used by the NES version on a controller port
+func (v *Vaus) Read() byte {
+	value := v.shift() << 3
+	if v.button {
+		value |= 0x10
+	}
+	return value
+}
+
+// Peek returns what Read would, without shifting the report
+func (v *Vaus) Peek() byte {
+	dup := *v
+	return dup.Read()
+}
+
+// ReadPort is used by the Famicom version on the expansion port
+func (v *Vaus) ReadPort(port int) byte {
+	if port == 0 {
+		if v.button {
+			return 0x02
+		}
+		return 0
+	}
+	return v.shift() << 1
+}
+
+// PeekPort returns what ReadPort would, without shifting the report
+func (v *Vaus) PeekPort(port int) byte {
+	dup := *v
+	return dup.ReadPort(port)
+}
@@ -0,0 +1,114 @@
+package input
+
+import "image/color"
+
+// LightSource gives the Zapper access to the picture as the PPU draws it.
+// PixelColor returns the colour most recently rendered at (x, y), so pixels
+// below the current scanline still hold the previous frame.
+type LightSource interface {
+	Scanline() int
+	Cycle() int
+	PixelColor(x, y int) color.RGBA
+}
+
+// Zapper is the NES light gun.
+// https://www.nesdev.org/wiki/Zapper
+//
+// D3 is the light sensor (0 = light detected) and D4 the trigger (1 = pulled).
+// The photodiode only reacts to bright pixels for a short time after the
+// electron beam has passed them, so light is sensed when a bright pixel near
+// the aimed position was drawn during the last few scanlines.
+type Zapper struct {
+	screen LightSource
+
+	x, y     int  // Aimed position in screen pixels
+	onScreen bool // false when the gun points away from the screen
+	trigger  bool
+
+	// Radius is the half size in pixels of the square area the sensor sees
+	Radius int
+	// Threshold is the minimum brightness (0-255) that triggers the sensor
+	Threshold int
+}
+
+// Number of scanlines the photodiode keeps reporting light after a pixel was drawn
+const zapperSenseLines = 20
+
+func NewZapper(screen LightSource) *Zapper {
+	return &Zapper{
+		screen:    screen,
+		Radius:    2,
+		Threshold: 85,
+	}
+}
+
+// Aim points the gun at screen position (x, y).
+// Positions outside the 256x240 picture point the gun away from the screen.
+func (z *Zapper) Aim(x, y int) {
+	z.x, z.y = x, y
+	z.onScreen = x >= 0 && x < 256 && y >= 0 && y < 240
+}
+
+// AimOffscreen points the gun away from the screen (used to reload in some games)
+func (z *Zapper) AimOffscreen() {
+	z.onScreen = false
+}
+
+// SetTrigger updates the state of the trigger
+func (z *Zapper) SetTrigger(pulled bool) {
+	z.trigger = pulled
+}
+
+// Write does nothing, the Zapper ignores the strobe
+func (z *Zapper) Write(data byte) {}
+
+func (z *Zapper) Read() byte {
+	var value byte
+	if !z.lightDetected() {
+		value |= 0x08
+	}
+	if z.trigger {
+		value |= 0x10
+	}
+	return value
+}
+
+// Peek is Read, which has no side effects: the sensors are only looked at
+func (z *Zapper) Peek() byte { return z.Read() }
+
+func (z *Zapper) lightDetected() bool {
+	if !z.onScreen || z.screen == nil {
+		return false
+	}
+
+	scanline := z.screen.Scanline()
+	cycle := z.screen.Cycle()
+
+	for y := z.y - z.Radius; y <= z.y+z.Radius; y++ {
+		if y < 0 || y >= 240 {
+			continue
+		}
+		// The beam has not reached this line yet or passed it too long ago
+		if scanline < y || scanline-y > zapperSenseLines {
+			continue
+		}
+		for x := z.x - z.Radius; x <= z.x+z.Radius; x++ {
+			if x < 0 || x >= 256 {
+				continue
+			}
+			// Pixel x is output on cycle x+1
+			if scanline == y && cycle <= x+1 {
+				continue
+			}
+			if brightness(z.screen.PixelColor(x, y)) >= z.Threshold {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// brightness returns the perceived luminance of c in the 0-255 range
+func brightness(c color.RGBA) int {
+	return (299*int(c.R) + 587*int(c.G) + 114*int(c.B)) / 1000
+}
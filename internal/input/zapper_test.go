@@ -0,0 +1,57 @@
+package input
+
+import (
+	"image/color"
+	"testing"
+)
+
+// fakeScreen is a white square at (100-109, 50-59) on a black screen
+type fakeScreen struct {
+	scanline, cycle int
+}
+
+func (s *fakeScreen) Scanline() int { return s.scanline }
+func (s *fakeScreen) Cycle() int    { return s.cycle }
+
+func (s *fakeScreen) PixelColor(x, y int) color.RGBA {
+	if x >= 100 && x < 110 && y >= 50 && y < 60 {
+		return color.RGBA{255, 255, 255, 255}
+	}
+	return color.RGBA{0, 0, 0, 255}
+}
+
+func TestZapperLightTiming(t *testing.T) {
+	screen := &fakeScreen{}
+	zapper := NewZapper(screen)
+	zapper.Aim(105, 55)
+
+	tests := []struct {
+		scanline, cycle int
+		light           bool
+	}{
+		{40, 0, false},   // Beam has not reached the target yet
+		{53, 104, false}, // Radius starts at line 53, x=103..107 not drawn yet
+		{53, 200, true},  // Target row drawn
+		{70, 10, true},   // Still within the sensor decay
+		{80, 10, false},  // Decayed
+		{261, 10, false}, // Vblank
+	}
+	for _, tt := range tests {
+		screen.scanline, screen.cycle = tt.scanline, tt.cycle
+		light := zapper.Read()&0x08 == 0
+		if light != tt.light {
+			t.Errorf("scanline %d cycle %d: expected light %v, got %v", tt.scanline, tt.cycle, tt.light, light)
+		}
+	}
+
+	screen.scanline, screen.cycle = 60, 0
+	zapper.AimOffscreen()
+	if zapper.Read()&0x08 == 0 {
+		t.Errorf("expected no light when aimed off screen")
+	}
+
+	zapper.SetTrigger(true)
+	if zapper.Read()&0x10 == 0 {
+		t.Errorf("expected trigger bit to be set")
+	}
+}
@@ -0,0 +1,193 @@
+package ppu
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// Debug views of the PPU memory, drawn with the PPU palette.
+// They only read VRAM, CHR, OAM and palette RAM and do not disturb the PPU.
+
+const (
+	// PatternTableSize is the width and height of a pattern table image: 16x16 tiles
+	PatternTableSize = 128
+	// PaletteCellSize is the size of one entry in the palette image
+	PaletteCellSize = 16
+)
+
+// scrollColor outlines the visible part of the nametables
+var scrollColor = color.RGBA{0xFF, 0x00, 0xFF, 0xFF}
+
+// debugColor returns the colour of a palette RAM entry
+func (ppu *PPU) debugColor(entry uint16) color.RGBA {
+	return ppu.palette()[ppu.Peek(0x3F00+entry)&0x3F]
+}
+
+// drawTile draws the 8x8 tile at CHR address addr at (x, y) with palette 0-7.
+// Transparent pixels use the backdrop colour.
+func (ppu *PPU) drawTile(img *image.RGBA, x, y int, addr uint16, palette byte, flipH, flipV bool) {
+	for row := 0; row < 8; row++ {
+		low := ppu.Peek(addr + uint16(row))
+		high := ppu.Peek(addr + uint16(row) + 8)
+		dy := row
+		if flipV {
+			dy = 7 - row
+		}
+		for col := 0; col < 8; col++ {
+			pixel := (low>>(7-col))&1 | ((high>>(7-col))&1)<<1
+			dx := col
+			if flipH {
+				dx = 7 - col
+			}
+			entry := uint16(0)
+			if pixel != 0 {
+				entry = uint16(palette)<<2 | uint16(pixel)
+			}
+			img.SetRGBA(x+dx, y+dy, ppu.debugColor(entry))
+		}
+	}
+}
+
+// PatternTable draws the 256 tiles of pattern table 0 ($0000) or 1 ($1000)
+// with palette 0-7 (0-3 background, 4-7 sprites)
+func (ppu *PPU) PatternTable(table int, palette byte) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, PatternTableSize, PatternTableSize))
+	base := uint16(table&1) << 12
+	for tile := 0; tile < 256; tile++ {
+		ppu.drawTile(img, tile%16*8, tile/16*8, base|uint16(tile)<<4, palette&7, false, false)
+	}
+	return img
+}
+
+// Nametables draws the four nametables as the PPU sees them, mirroring
+// included, 2x2 screens in a 512x480 image. The part the next frame starts
+// scrolled to is outlined.
+func (ppu *PPU) Nametables() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 2*ScreenWidth, 2*ScreenHeight))
+	patterns := uint16(0)
+	if ppu.PPUCTRL&0x10 != 0 {
+		patterns = 0x1000
+	}
+
+	for n := uint16(0); n < 4; n++ {
+		base := 0x2000 + n*0x400
+		originX, originY := int(n&1)*ScreenWidth, int(n>>1)*ScreenHeight
+		for row := uint16(0); row < 30; row++ {
+			for col := uint16(0); col < 32; col++ {
+				tile := ppu.Peek(base + row*32 + col)
+				// Each attribute byte holds the palettes of 4x4 tiles, 2 bits per 2x2
+				attribute := ppu.Peek(base + 0x3C0 + row/4*8 + col/4)
+				shift := (row & 2 << 1) | (col & 2)
+				palette := (attribute >> shift) & 0x03
+				x, y := originX+int(col)*8, originY+int(row)*8
+				ppu.drawTile(img, x, y, patterns|uint16(tile)<<4, palette, false, false)
+			}
+		}
+	}
+
+	ppu.drawScrollRect(img)
+	return img
+}
+
+// ScrollOrigin returns the position in the 512x480 nametable space of the
+// top-left pixel of the picture, from the temporary VRAM address t and fine X
+func (ppu *PPU) ScrollOrigin() (x, y int) {
+	x = int(ppu.t&0x1F)*8 + int(ppu.x) + int(ppu.t>>10&1)*ScreenWidth
+	y = int(ppu.t>>5&0x1F)*8 + int(ppu.t>>12&7) + int(ppu.t>>11&1)*ScreenHeight
+	return x, y
+}
+
+// drawScrollRect outlines the screen at the scroll origin, wrapping around the nametables
+func (ppu *PPU) drawScrollRect(img *image.RGBA) {
+	x0, y0 := ppu.ScrollOrigin()
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	set := func(x, y int) {
+		img.SetRGBA((x%w+w)%w, (y%h+h)%h, scrollColor)
+	}
+	for i := 0; i < ScreenWidth; i++ {
+		set(x0+i, y0)
+		set(x0+i, y0+ScreenHeight-1)
+	}
+	for i := 0; i < ScreenHeight; i++ {
+		set(x0, y0+i)
+		set(x0+ScreenWidth-1, y0+i)
+	}
+}
+
+// Sprite is an OAM entry
+type Sprite struct {
+	Y, Tile, Attributes, X byte
+}
+
+// Sprites returns the 64 entries of OAM
+func (ppu *PPU) Sprites() [64]Sprite {
+	var sprites [64]Sprite
+	for i := range sprites {
+		e := ppu.OAM[i*4 : i*4+4]
+		sprites[i] = Sprite{Y: e[0], Tile: e[1], Attributes: e[2], X: e[3]}
+	}
+	return sprites
+}
+
+func (s Sprite) String() string {
+	priority := "front"
+	if s.Attributes&0x20 != 0 {
+		priority = "back"
+	}
+	flip := ""
+	if s.Attributes&0x40 != 0 {
+		flip += "H"
+	}
+	if s.Attributes&0x80 != 0 {
+		flip += "V"
+	}
+	text := fmt.Sprintf("X:%3d Y:%3d T:%02X P:%d", s.X, s.Y, s.Tile, s.Attributes&3+4)
+	if flip == "" {
+		return text + " " + priority
+	}
+	return fmt.Sprintf("%s %-5s %s", text, priority, flip)
+}
+
+// SpriteTiles draws the 64 sprites in an 8x8 grid of 8x16 cells, in OAM
+// order, with their palette and flips. 8x8 sprites use the top of the cell.
+func (ppu *PPU) SpriteTiles() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 8*8, 8*16))
+	for i, s := range ppu.Sprites() {
+		x, y := i%8*8, i/8*16
+		palette := s.Attributes&3 + 4
+		flipH, flipV := s.Attributes&0x40 != 0, s.Attributes&0x80 != 0
+
+		if ppu.spriteHeight() == 8 {
+			table := uint16(ppu.PPUCTRL&0x08) << 9
+			ppu.drawTile(img, x, y, table|uint16(s.Tile)<<4, palette, flipH, flipV)
+			continue
+		}
+		table := uint16(s.Tile&1) << 12
+		top, bottom := table|uint16(s.Tile&0xFE)<<4, table|uint16(s.Tile|1)<<4
+		// Vertical flip swaps the two tiles too
+		if flipV {
+			top, bottom = bottom, top
+		}
+		ppu.drawTile(img, x, y, top, palette, flipH, flipV)
+		ppu.drawTile(img, x, y+8, bottom, palette, flipH, flipV)
+	}
+	return img
+}
+
+// PaletteRAM draws the 32 palette RAM entries, background palettes in the
+// top row and sprite palettes in the bottom one. Entry $10 and the other
+// sprite backdrops show the background entries they mirror.
+func (ppu *PPU) PaletteRAM() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 16*PaletteCellSize, 2*PaletteCellSize))
+	for entry := 0; entry < 32; entry++ {
+		c := ppu.debugColor(uint16(entry))
+		x0, y0 := entry%16*PaletteCellSize, entry/16*PaletteCellSize
+		for y := y0; y < y0+PaletteCellSize; y++ {
+			for x := x0; x < x0+PaletteCellSize; x++ {
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+	return img
+}
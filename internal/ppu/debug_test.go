@@ -0,0 +1,80 @@
+package ppu
+
+import "testing"
+
+func newDebugPPU() *PPU {
+	chr := make([]byte, 0x2000)
+	// Tile 1 of both tables: a solid block of colour 3
+	for i := 0; i < 16; i++ {
+		chr[0x10+i] = 0xFF
+		chr[0x1010+i] = 0xFF
+	}
+	ppu := New(chr)
+	for i := range ppu.PaletteTable {
+		ppu.PaletteTable[i] = byte(i)
+	}
+	return ppu
+}
+
+func TestPatternTable(t *testing.T) {
+	ppu := newDebugPPU()
+	img := ppu.PatternTable(1, 5)
+
+	if got, want := img.RGBAAt(8, 0), DefaultPalette[0x17]; got != want {
+		t.Errorf("tile 1: expected %v, got %v", want, got)
+	}
+	if got, want := img.RGBAAt(0, 0), DefaultPalette[0x00]; got != want {
+		t.Errorf("tile 0: expected the backdrop %v, got %v", want, got)
+	}
+}
+
+func TestNametables(t *testing.T) {
+	ppu := newDebugPPU()
+	// Tile 1 at row 2, column 3 of $2400, with palette 2 from the attribute byte
+	ppu.Write(0x2400+2*32+3, 1)
+	ppu.Write(0x27C0, 0x80) // Bottom-right 2x2 tiles of the first attribute block
+	// Scroll to (16, 8) of the second nametable
+	ppu.WriteRegister(0x2000, 0x01)
+	ppu.WriteRegister(0x2005, 16)
+	ppu.WriteRegister(0x2005, 8)
+
+	img := ppu.Nametables()
+	if got, want := img.RGBAAt(256+3*8, 2*8), DefaultPalette[0x0B]; got != want {
+		t.Errorf("tile: expected %v, got %v", want, got)
+	}
+	if x, y := ppu.ScrollOrigin(); x != 256+16 || y != 8 {
+		t.Errorf("expected scroll origin (272, 8), got (%d, %d)", x, y)
+	}
+	// The outline wraps around the right edge into the left nametables
+	for _, p := range [][2]int{{272, 8}, {511, 8}, {0, 8}, {15, 8}, {15, 247}} {
+		if got := img.RGBAAt(p[0], p[1]); got != scrollColor {
+			t.Errorf("expected the scroll outline at %v, got %v", p, got)
+		}
+	}
+}
+
+func TestSpriteTiles(t *testing.T) {
+	ppu := newDebugPPU()
+	// Sprite 9: tile 1 with palette 6, in the second row of the grid
+	copy(ppu.OAM[9*4:], []byte{0x20, 0x01, 0x02, 0x30})
+
+	img := ppu.SpriteTiles()
+	if got, want := img.RGBAAt(8, 16), DefaultPalette[0x1B]; got != want {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := ppu.Sprites()[9].String(); got != "X: 48 Y: 32 T:01 P:6 front" {
+		t.Errorf("unexpected sprite text %q", got)
+	}
+}
+
+func TestPaletteRAM(t *testing.T) {
+	ppu := newDebugPPU()
+	img := ppu.PaletteRAM()
+	// Entry $15 is in the bottom row, $10 mirrors $00
+	if got, want := img.RGBAAt(5*PaletteCellSize, PaletteCellSize), DefaultPalette[0x15]; got != want {
+		t.Errorf("entry $15: expected %v, got %v", want, got)
+	}
+	if got, want := img.RGBAAt(0, PaletteCellSize), DefaultPalette[0x00]; got != want {
+		t.Errorf("entry $10: expected %v, got %v", want, got)
+	}
+}
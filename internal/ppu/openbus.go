@@ -0,0 +1,43 @@
+package ppu
+
+// The CPU talks to the PPU registers over an 8-bit data bus whose
+// capacitance holds the last value put on it. Reads of write-only registers
+// and the bits a register does not drive return this I/O latch. Each bit
+// that is not refreshed fades to 0 after about 600 ms.
+// https://www.nesdev.org/wiki/Open_bus_behavior#PPU_open_bus
+
+// driveBus puts the bits of value selected by mask on the I/O latch
+func (ppu *PPU) driveBus(value, mask byte) {
+	ppu.ioLatch = ppu.ioLatch&^mask | value&mask
+	for bit := 0; bit < 8; bit++ {
+		if mask&(1<<bit) != 0 {
+			ppu.ioRefreshed[bit] = ppu.frame
+		}
+	}
+}
+
+// openBus returns the I/O latch after the decay of the bits not refreshed lately
+func (ppu *PPU) openBus() byte {
+	ppu.ioLatch = ppu.decayedLatch()
+	return ppu.ioLatch
+}
+
+// decayedLatch returns what openBus does without keeping the decay
+func (ppu *PPU) decayedLatch() byte {
+	decay := ppu.Timing().OpenBusDecay
+	latch := ppu.ioLatch
+	for bit := 0; bit < 8; bit++ {
+		if ppu.frame-ppu.ioRefreshed[bit] >= decay {
+			latch &^= 1 << bit
+		}
+	}
+	return latch
+}
+
+// readBus completes a register read: the bits in mask come from value,
+// the rest from the I/O latch, and the whole byte is what the CPU sees
+func (ppu *PPU) readBus(value, mask byte) byte {
+	data := value&mask | ppu.openBus()&^mask
+	ppu.driveBus(value, mask)
+	return data
+}
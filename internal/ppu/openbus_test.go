@@ -0,0 +1,54 @@
+package ppu
+
+import "testing"
+
+func TestOpenBus(t *testing.T) {
+	ppu := New(make([]byte, 0x2000))
+
+	ppu.WriteRegister(0x2003, 0x5A)
+	for _, addr := range []uint16{0x2000, 0x2001, 0x2003, 0x2005, 0x2006} {
+		if got := ppu.ReadRegister(addr); got != 0x5A {
+			t.Errorf("$%04X: expected the last write $5A, got $%02X", addr, got)
+		}
+	}
+
+	// The low 5 bits of PPUSTATUS are open bus
+	ppu.WriteRegister(0x2003, 0xFF)
+	ppu.PPUStatus = 0x80
+	if got := ppu.ReadRegister(0x2002); got != 0x9F {
+		t.Errorf("PPUSTATUS: expected $9F, got $%02X", got)
+	}
+	// The flags read are driven onto the bus
+	if got := ppu.ReadRegister(0x2000); got != 0x9F {
+		t.Errorf("after PPUSTATUS: expected $9F, got $%02X", got)
+	}
+
+	// Palette reads take the top 2 bits from the bus
+	ppu.PaletteTable[0] = 0x2A
+	ppu.WriteRegister(0x2006, 0x3F)
+	ppu.WriteRegister(0x2006, 0x00)
+	ppu.WriteRegister(0x2001, 0xC0)
+	if got := ppu.ReadRegister(0x2007); got != 0xEA {
+		t.Errorf("palette: expected $EA, got $%02X", got)
+	}
+}
+
+func TestOpenBusDecay(t *testing.T) {
+	ppu := New(make([]byte, 0x2000))
+	decay := NTSCTiming.OpenBusDecay
+
+	ppu.WriteRegister(0x2000, 0xFF)
+	ppu.frame += decay / 2
+	// Refreshes bits 5-7 only
+	ppu.PPUStatus = 0xE0
+	ppu.ReadRegister(0x2002)
+
+	ppu.frame += decay/2 + 1
+	if got := ppu.ReadRegister(0x2001); got != 0xE0 {
+		t.Errorf("expected the bits not refreshed to decay, got $%02X", got)
+	}
+	ppu.frame += decay
+	if got := ppu.ReadRegister(0x2001); got != 0x00 {
+		t.Errorf("expected the bus to decay to 0, got $%02X", got)
+	}
+}
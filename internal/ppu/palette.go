@@ -0,0 +1,154 @@
+package ppu
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+)
+
+const (
+	ScreenWidth  = 256
+	ScreenHeight = 240
+)
+
+// Frame is the PPU output: one 9-bit pixel per dot, the palette index
+// in bits 0-5 and the PPUMASK emphasis bits (red, green, blue) in bits 6-8
+type Frame [ScreenHeight][ScreenWidth]uint16
+
+// Palette maps the 64 colour indices to RGB, for each of the 8 combinations
+// of the PPUMASK emphasis bits: entry emphasis<<6 | index
+type Palette [512]color.RGBA
+
+// DefaultPalette is the palette used when PPU.Palette is nil
+var DefaultPalette = *newPalette(&colors2C02)
+
+// newPalette builds a palette from the 64 base colours, deriving the
+// emphasised sets the way the 2C02 does: each emphasis bit darkens the
+// other two channels
+func newPalette(colors *[64]color.RGBA) *Palette {
+	var pal Palette
+	for emphasis := 0; emphasis < 8; emphasis++ {
+		for i, c := range colors {
+			// The blacks in columns $E and $F are not affected
+			if emphasis != 0 && i&0x0F < 0x0E {
+				rgb := [3]float64{float64(c.R), float64(c.G), float64(c.B)}
+				for bit := 0; bit < 3; bit++ {
+					if emphasis&(1<<bit) == 0 {
+						continue
+					}
+					for ch := range rgb {
+						if ch != bit {
+							rgb[ch] *= emphasisAttenuation
+						}
+					}
+				}
+				c = color.RGBA{byte(rgb[0]), byte(rgb[1]), byte(rgb[2]), 0xFF}
+			}
+			pal[emphasis<<6|i] = c
+		}
+	}
+	return &pal
+}
+
+// newRGBPalette builds a palette for the RGB PPUs, where the emphasis bits
+// drive their channel at full intensity instead of darkening the others
+func newRGBPalette(colors *[64]color.RGBA) *Palette {
+	var pal Palette
+	for emphasis := 0; emphasis < 8; emphasis++ {
+		for i, c := range colors {
+			if emphasis&1 != 0 {
+				c.R = 0xFF
+			}
+			if emphasis&2 != 0 {
+				c.G = 0xFF
+			}
+			if emphasis&4 != 0 {
+				c.B = 0xFF
+			}
+			pal[emphasis<<6|i] = c
+		}
+	}
+	return &pal
+}
+
+// LoadPaletteFile reads a .pal file, see ParsePalette
+func LoadPaletteFile(path string) (*Palette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePalette(data)
+}
+
+// ParsePalette decodes the .pal format: RGB triplets for the 64 colours
+// (192 bytes), optionally followed by the 7 emphasised sets (1536 bytes).
+// Without the emphasised sets they are derived like in newPalette.
+func ParsePalette(data []byte) (*Palette, error) {
+	var colors int
+	switch len(data) {
+	case 64 * 3:
+		colors = 64
+	case 512 * 3:
+		colors = 512
+	default:
+		return nil, fmt.Errorf("invalid palette size: %d bytes, expected 192 or 1536", len(data))
+	}
+
+	var base [64]color.RGBA
+	for i := range base {
+		base[i] = color.RGBA{data[i*3], data[i*3+1], data[i*3+2], 0xFF}
+	}
+	pal := newPalette(&base)
+
+	for i := 64; i < colors; i++ {
+		pal[i] = color.RGBA{data[i*3], data[i*3+1], data[i*3+2], 0xFF}
+	}
+	return pal, nil
+}
+
+// ToRGBA converts frame to RGBA bytes (4 per pixel, row by row) in dst,
+// which must hold at least ScreenWidth*ScreenHeight*4 bytes
+func (pal *Palette) ToRGBA(dst []byte, frame *Frame) {
+	i := 0
+	for y := range frame {
+		for _, pixel := range frame[y] {
+			c := pal[pixel&0x1FF]
+			dst[i] = c.R
+			dst[i+1] = c.G
+			dst[i+2] = c.B
+			dst[i+3] = 0xFF
+			i += 4
+		}
+	}
+}
+
+func (p *PPU) palette() *Palette {
+	if p.Palette == nil {
+		return &DefaultPalette
+	}
+	return p.Palette
+}
+
+// FrameBuffer returns the palette-index buffer of the last rendered pixels.
+// It is updated in place while the PPU renders.
+func (p *PPU) FrameBuffer() *Frame {
+	return &p.framebuffer
+}
+
+// RGBA writes the framebuffer as RGBA bytes to dst, see Palette.ToRGBA
+func (p *PPU) RGBA(dst []byte) {
+	p.palette().ToRGBA(dst, &p.framebuffer)
+}
+
+// Image returns a copy of the framebuffer converted with the PPU palette
+func (p *PPU) Image() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, ScreenWidth, ScreenHeight))
+	p.RGBA(img.Pix)
+	return img
+}
+
+// PixelColor returns the colour last rendered at screen position (x, y)
+func (p *PPU) PixelColor(x, y int) color.RGBA {
+	return p.palette()[p.framebuffer[y][x]&0x1FF]
+}
@@ -0,0 +1,137 @@
+package ppu
+
+import (
+	"image/color"
+	"math"
+)
+
+// Composite signal levels of the 2C02, normalised so that the sync tip is 0.
+// https://www.nesdev.org/wiki/NTSC_video
+var (
+	signalLow  = [4]float64{0.228, 0.312, 0.552, 0.880}
+	signalHigh = [4]float64{0.616, 0.840, 1.100, 1.100}
+)
+
+const (
+	signalBlack = 0.312 // Level of colour $0F
+	signalWhite = 1.100 // Level of colour $20
+
+	// emphasisAttenuation scales the signal during emphasised phases
+	emphasisAttenuation = 0.746
+)
+
+// tvDecoder describes how a TV turns the NES composite signal into RGB
+type tvDecoder struct {
+	// Demodulation axes of R-Y, G-Y and B-Y: angle in degrees from the U axis and gain
+	angles [3]float64
+	gains  [3]float64
+
+	hue        float64 // Degrees added to every colour
+	saturation float64
+	contrast   float64
+	brightness float64
+	// gamma of the display the signal was made for, converted to sRGB (2.2)
+	gamma float64
+}
+
+// decoderYUV is the textbook YUV matrix, as used by Nestopia's YUV palette
+var decoderYUV = tvDecoder{
+	angles:     [3]float64{90, 236, 0},
+	gains:      [3]float64{1.140, 0.702, 2.032},
+	saturation: 1,
+	contrast:   1,
+	gamma:      2.2,
+}
+
+// decoderSonyCXA is the US matrix of the Sony CXA2025AS found in many 90s TVs
+var decoderSonyCXA = tvDecoder{
+	angles:     [3]float64{95, 240, 0},
+	gains:      [3]float64{1.560, 0.600, 2.000},
+	saturation: 1,
+	contrast:   1,
+	gamma:      2.2,
+}
+
+// decoderPVM approximates a broadcast monitor: YUV matrix, richer colour, darker gamma
+var decoderPVM = tvDecoder{
+	angles:     [3]float64{90, 236, 0},
+	gains:      [3]float64{1.140, 0.702, 2.032},
+	saturation: 1.2,
+	contrast:   1.05,
+	brightness: -0.02,
+	gamma:      2.4,
+}
+
+// inColorPhase reports whether the square wave of colour hue is high at
+// subcarrier phase p (the signal has 12 phases per colour cycle)
+func inColorPhase(hue, phase int) bool {
+	return (hue+phase)%12 < 6
+}
+
+// SignalLevel returns the composite level of a 9-bit pixel (emphasis<<6 | index)
+// at subcarrier phase 0-11, normalised so that black is 0 and white is 1.
+// The PPU outputs 8 phases per dot.
+func SignalLevel(pixel uint16, phase int) float64 {
+	hue := int(pixel & 0x0F)
+	level := (pixel >> 4) & 3
+	emphasis := pixel >> 6
+
+	// Colours $xE and $xF output black, $x0 and $xD are flat
+	blank := hue > 13
+	if blank {
+		level = 1
+		hue = 13
+	}
+	v := signalLow[level]
+	if hue == 0 || (hue < 13 && inColorPhase(hue, phase)) {
+		v = signalHigh[level]
+	}
+
+	// Emphasis bits attenuate the signal during the phases of red ($xC), green ($x4)
+	// and blue ($x8), everywhere except the blacks of columns $E and $F
+	if !blank && (emphasis&1 != 0 && inColorPhase(0xC, phase) ||
+		emphasis&2 != 0 && inColorPhase(0x4, phase) ||
+		emphasis&4 != 0 && inColorPhase(0x8, phase)) {
+		v *= emphasisAttenuation
+	}
+
+	return (v - signalBlack) / (signalWhite - signalBlack)
+}
+
+// generatePalette decodes the signal of every colour the way tv would
+func generatePalette(tv tvDecoder) *Palette {
+	var pal Palette
+	hue := tv.hue * math.Pi / 180
+
+	for pixel := range pal {
+		// Demodulate one colour cycle into Y, U and V
+		var y, u, v float64
+		for p := 0; p < 12; p++ {
+			s := SignalLevel(uint16(pixel), p)
+			angle := 2*math.Pi*float64(p)/12 + hue
+			y += s / 12
+			u += s * math.Cos(angle) / 6
+			v -= s * math.Sin(angle) / 6
+		}
+
+		y = y*tv.contrast + tv.brightness
+		u *= tv.saturation * tv.contrast
+		v *= tv.saturation * tv.contrast
+
+		var rgb [3]byte
+		for i := range rgb {
+			a := tv.angles[i] * math.Pi / 180
+			rgb[i] = toSRGB(y+tv.gains[i]*(u*math.Cos(a)+v*math.Sin(a)), tv.gamma)
+		}
+		pal[pixel] = color.RGBA{rgb[0], rgb[1], rgb[2], 0xFF}
+	}
+	return &pal
+}
+
+func toSRGB(x, gamma float64) byte {
+	x = math.Max(0, math.Min(1, x))
+	if gamma != 0 {
+		x = math.Pow(x, gamma/2.2)
+	}
+	return byte(math.Round(x * 255))
+}
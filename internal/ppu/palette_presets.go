@@ -0,0 +1,154 @@
+package ppu
+
+import (
+	"fmt"
+	"image/color"
+)
+
+// colors2C02 is the common measured palette of the NTSC 2C02
+var colors2C02 = [64]color.RGBA{
+	{84, 84, 84, 255},    // 0x00
+	{0, 30, 116, 255},    // 0x01
+	{8, 16, 144, 255},    // 0x02
+	{48, 0, 136, 255},    // 0x03
+	{68, 0, 100, 255},    // 0x04
+	{92, 0, 48, 255},     // 0x05
+	{84, 4, 0, 255},      // 0x06
+	{60, 24, 0, 255},     // 0x07
+	{32, 42, 0, 255},     // 0x08
+	{8, 58, 0, 255},      // 0x09
+	{0, 64, 0, 255},      // 0x0A
+	{0, 60, 0, 255},      // 0x0B
+	{0, 50, 60, 255},     // 0x0C
+	{0, 0, 0, 255},       // 0x0D
+	{0, 0, 0, 255},       // 0x0E
+	{0, 0, 0, 255},       // 0x0F
+	{152, 150, 152, 255}, // 0x10
+	{8, 76, 196, 255},    // 0x11
+	{48, 50, 236, 255},   // 0x12
+	{92, 30, 228, 255},   // 0x13
+	{136, 20, 176, 255},  // 0x14
+	{160, 20, 100, 255},  // 0x15
+	{152, 34, 32, 255},   // 0x16
+	{120, 60, 0, 255},    // 0x17
+	{84, 90, 0, 255},     // 0x18
+	{40, 114, 0, 255},    // 0x19
+	{8, 124, 0, 255},     // 0x1A
+	{0, 118, 40, 255},    // 0x1B
+	{0, 102, 120, 255},   // 0x1C
+	{0, 0, 0, 255},       // 0x1D
+	{0, 0, 0, 255},       // 0x1E
+	{0, 0, 0, 255},       // 0x1F
+	{236, 238, 236, 255}, // 0x20
+	{76, 154, 236, 255},  // 0x21
+	{120, 124, 236, 255}, // 0x22
+	{176, 98, 236, 255},  // 0x23
+	{228, 84, 236, 255},  // 0x24
+	{236, 88, 180, 255},  // 0x25
+	{236, 106, 100, 255}, // 0x26
+	{212, 136, 32, 255},  // 0x27
+	{160, 170, 0, 255},   // 0x28
+	{116, 196, 0, 255},   // 0x29
+	{76, 208, 32, 255},   // 0x2A
+	{56, 204, 108, 255},  // 0x2B
+	{56, 180, 204, 255},  // 0x2C
+	{60, 60, 60, 255},    // 0x2D
+	{0, 0, 0, 255},       // 0x2E
+	{0, 0, 0, 255},       // 0x2F
+	{236, 238, 236, 255}, // 0x30
+	{168, 204, 236, 255}, // 0x31
+	{188, 188, 236, 255}, // 0x32
+	{212, 178, 236, 255}, // 0x33
+	{236, 174, 236, 255}, // 0x34
+	{236, 174, 212, 255}, // 0x35
+	{236, 180, 176, 255}, // 0x36
+	{228, 196, 144, 255}, // 0x37
+	{204, 210, 120, 255}, // 0x38
+	{180, 222, 120, 255}, // 0x39
+	{168, 226, 144, 255}, // 0x3A
+	{152, 226, 180, 255}, // 0x3B
+	{160, 214, 228, 255}, // 0x3C
+	{160, 162, 160, 255}, // 0x3D
+	{0, 0, 0, 255},       // 0x3E
+	{0, 0, 0, 255},       // 0x3F
+}
+
+// colorsFCEUX is the default palette of FCEUX (6 bits per channel)
+var colorsFCEUX = sixBitColors([64][3]byte{
+	{0x1D, 0x1D, 0x1D}, {0x09, 0x06, 0x23}, {0x00, 0x00, 0x2A}, {0x11, 0x00, 0x27},
+	{0x23, 0x00, 0x1D}, {0x2A, 0x00, 0x04}, {0x29, 0x00, 0x00}, {0x1F, 0x02, 0x00},
+	{0x10, 0x0B, 0x00}, {0x00, 0x11, 0x00}, {0x00, 0x14, 0x00}, {0x00, 0x0F, 0x05},
+	{0x06, 0x0F, 0x17}, {0x00, 0x00, 0x00}, {0x00, 0x00, 0x00}, {0x00, 0x00, 0x00},
+	{0x2F, 0x2F, 0x2F}, {0x00, 0x1C, 0x3B}, {0x08, 0x0E, 0x3B}, {0x20, 0x00, 0x3C},
+	{0x2F, 0x00, 0x2F}, {0x39, 0x00, 0x16}, {0x36, 0x0A, 0x00}, {0x32, 0x13, 0x03},
+	{0x22, 0x1C, 0x00}, {0x00, 0x25, 0x00}, {0x00, 0x2A, 0x00}, {0x00, 0x24, 0x0E},
+	{0x00, 0x20, 0x22}, {0x00, 0x00, 0x00}, {0x00, 0x00, 0x00}, {0x00, 0x00, 0x00},
+	{0x3F, 0x3F, 0x3F}, {0x0F, 0x2F, 0x3F}, {0x17, 0x25, 0x3F}, {0x33, 0x22, 0x3F},
+	{0x3D, 0x1E, 0x3F}, {0x3F, 0x1D, 0x2D}, {0x3F, 0x1D, 0x18}, {0x3F, 0x26, 0x0E},
+	{0x3C, 0x2F, 0x0F}, {0x20, 0x34, 0x04}, {0x13, 0x37, 0x12}, {0x16, 0x3E, 0x26},
+	{0x00, 0x3A, 0x36}, {0x1E, 0x1E, 0x1E}, {0x00, 0x00, 0x00}, {0x00, 0x00, 0x00},
+	{0x3F, 0x3F, 0x3F}, {0x2A, 0x39, 0x3F}, {0x31, 0x35, 0x3F}, {0x35, 0x32, 0x3F},
+	{0x3F, 0x31, 0x3F}, {0x3F, 0x31, 0x36}, {0x3F, 0x2F, 0x2C}, {0x3F, 0x36, 0x2A},
+	{0x3F, 0x39, 0x28}, {0x38, 0x3F, 0x28}, {0x2A, 0x3C, 0x2F}, {0x2C, 0x3F, 0x33},
+	{0x27, 0x3F, 0x3C}, {0x31, 0x31, 0x31}, {0x00, 0x00, 0x00}, {0x00, 0x00, 0x00},
+})
+
+// colors2C03 is the palette of the RGB PPUs (2C03, 2C05) used in arcade
+// and PlayChoice-10 machines and in the Sharp Famicom Titler.
+// Each octal digit is the level (0-7) of red, green and blue.
+var colors2C03 = rgbDigitColors([64]uint16{
+	0o333, 0o014, 0o006, 0o326, 0o403, 0o503, 0o510, 0o420, 0o320, 0o120, 0o031, 0o040, 0o022, 0o000, 0o000, 0o000,
+	0o555, 0o036, 0o027, 0o407, 0o507, 0o704, 0o700, 0o630, 0o430, 0o140, 0o040, 0o053, 0o044, 0o000, 0o000, 0o000,
+	0o777, 0o357, 0o447, 0o637, 0o707, 0o737, 0o740, 0o750, 0o660, 0o360, 0o070, 0o276, 0o077, 0o000, 0o000, 0o000,
+	0o777, 0o567, 0o657, 0o757, 0o747, 0o755, 0o764, 0o772, 0o773, 0o572, 0o473, 0o577, 0o067, 0o000, 0o000, 0o000,
+})
+
+func sixBitColors(values [64][3]byte) *[64]color.RGBA {
+	var colors [64]color.RGBA
+	for i, v := range values {
+		// Replicate the top bits so $3F becomes $FF
+		colors[i] = color.RGBA{v[0]<<2 | v[0]>>4, v[1]<<2 | v[1]>>4, v[2]<<2 | v[2]>>4, 0xFF}
+	}
+	return &colors
+}
+
+func rgbDigitColors(values [64]uint16) *[64]color.RGBA {
+	var colors [64]color.RGBA
+	level := func(digit uint16) byte { return byte(digit * 255 / 7) }
+	for i, v := range values {
+		colors[i] = color.RGBA{level(v >> 6 & 7), level(v >> 3 & 7), level(v & 7), 0xFF}
+	}
+	return &colors
+}
+
+// PalettePreset is a built-in palette selectable by name
+type PalettePreset struct {
+	Name        string
+	Description string
+	Palette     *Palette
+}
+
+// PalettePresets lists the built-in palettes, the first one is DefaultPalette
+var PalettePresets = []PalettePreset{
+	{"2c02", "NTSC 2C02 measured", &DefaultPalette},
+	{"fceux", "FCEUX default", newPalette(colorsFCEUX)},
+	{"nestopia-yuv", "Nestopia YUV decoder", generatePalette(decoderYUV)},
+	{"sony-cxa", "Sony CXA2025AS decoder", generatePalette(decoderSonyCXA)},
+	{"pvm", "Sony PVM style broadcast monitor", generatePalette(decoderPVM)},
+	{"rgb", "2C03/2C05 RGB PPU", newRGBPalette(colors2C03)},
+}
+
+// FindPalette returns the built-in palette called name,
+// or loads name as a .pal file if there is no such preset
+func FindPalette(name string) (*Palette, error) {
+	for _, preset := range PalettePresets {
+		if preset.Name == name {
+			return preset.Palette, nil
+		}
+	}
+	pal, err := LoadPaletteFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("palette %q: %w", name, err)
+	}
+	return pal, nil
+}
@@ -0,0 +1,107 @@
+package ppu
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestRGBA(t *testing.T) {
+	ppu := New(make([]byte, 0x2000))
+	ppu.framebuffer[0][0] = 0x21
+	ppu.framebuffer[239][255] = 0x0F
+
+	img := ppu.Image()
+	if got := img.RGBAAt(0, 0); got != DefaultPalette[0x21] {
+		t.Errorf("pixel (0,0): expected %v, got %v", DefaultPalette[0x21], got)
+	}
+	if got := img.RGBAAt(255, 239); got != (color.RGBA{0, 0, 0, 255}) {
+		t.Errorf("pixel (255,239): expected black, got %v", got)
+	}
+
+	// A custom palette is used for conversion and for the Zapper
+	var custom Palette
+	custom[0x21] = color.RGBA{1, 2, 3, 255}
+	ppu.Palette = &custom
+
+	pixels := make([]byte, ScreenWidth*ScreenHeight*4)
+	ppu.RGBA(pixels)
+	if pixels[0] != 1 || pixels[1] != 2 || pixels[2] != 3 || pixels[3] != 255 {
+		t.Errorf("expected custom colour in RGBA output, got %v", pixels[:4])
+	}
+	if got := ppu.PixelColor(0, 0); got != custom[0x21] {
+		t.Errorf("PixelColor: expected %v, got %v", custom[0x21], got)
+	}
+}
+
+func TestParsePalette(t *testing.T) {
+	data := make([]byte, 64*3)
+	data[0x21*3], data[0x21*3+1], data[0x21*3+2] = 10, 20, 30
+
+	pal, err := ParsePalette(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pal[0x21]; got != (color.RGBA{10, 20, 30, 255}) {
+		t.Errorf("expected (10,20,30), got %v", got)
+	}
+	// Without emphasis variants they are derived by attenuation
+	if got := pal[1<<6|0x21]; got != (color.RGBA{10, 14, 22, 255}) {
+		t.Errorf("red emphasis: expected (10,14,22), got %v", got)
+	}
+
+	data = make([]byte, 512*3)
+	data[0x1FF*3] = 99
+	if pal, err = ParsePalette(data); err != nil {
+		t.Fatal(err)
+	}
+	if pal[0x1FF].R != 99 {
+		t.Errorf("expected entry $1FF from the file, got %v", pal[0x1FF])
+	}
+
+	if _, err := ParsePalette(make([]byte, 100)); err == nil {
+		t.Errorf("expected an error for a 100 byte palette")
+	}
+}
+
+func TestFindPalette(t *testing.T) {
+	for _, preset := range PalettePresets {
+		pal, err := FindPalette(preset.Name)
+		if err != nil {
+			t.Fatalf("%s: %v", preset.Name, err)
+		}
+		// $0F is black in every palette, $30 is close to white
+		if c := pal[0x0F]; c.R+c.G+c.B > 0 {
+			t.Errorf("%s: expected black $0F, got %v", preset.Name, c)
+		}
+		if c := pal[0x30]; c.R < 200 || c.G < 200 || c.B < 200 {
+			t.Errorf("%s: expected white $30, got %v", preset.Name, c)
+		}
+	}
+
+	if _, err := FindPalette("no-such-palette"); err == nil {
+		t.Errorf("expected an error for an unknown palette")
+	}
+}
+
+func TestRenderPixelEmphasisAndGreyscale(t *testing.T) {
+	ppu := &PPU{
+		// Background on, greyscale, red and blue emphasis
+		PPUMASK: 0x08 | 0x01 | 0x20 | 0x80,
+	}
+	ppu.PaletteTable[0] = 0x16
+	ppu.scanline = 0
+	ppu.cycle = 1
+
+	ppu.renderPixel()
+	if got := ppu.framebuffer[0][0]; got != 0x10|0x5<<6 {
+		t.Errorf("expected pixel $150, got $%03X", got)
+	}
+
+	// The palette conversion uses the emphasised set
+	if got, want := ppu.PixelColor(0, 0), DefaultPalette[0x150]; got != want {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if DefaultPalette[0x150] == DefaultPalette[0x10] {
+		t.Errorf("emphasis does not change the colour")
+	}
+}
@@ -0,0 +1,76 @@
+package ppu
+
+// Debuggers, tracers and memory viewers look at the PPU through Peek and
+// PeekRegister: they return what a read would without its side effects,
+// so looking never changes what the game sees.
+
+// Peek reads PPU memory like the rendering does, for debug views
+func (ppu *PPU) Peek(addr uint16) byte {
+	// Reads of VRAM have no side effects yet, mappers with CHR latches
+	// like MMC2 would have to be bypassed here
+	return ppu.Read(addr)
+}
+
+// Poke writes PPU memory, CHR ROM included
+func (ppu *PPU) Poke(addr uint16, data byte) {
+	addr %= 0x4000
+	if addr < 0x2000 {
+		if int(addr) < len(ppu.CHR) {
+			ppu.CHR[addr] = data
+		}
+		return
+	}
+	ppu.Write(addr, data)
+}
+
+// PeekRegister returns what ReadRegister would at $2000-$2007, without
+// clearing VBlank or the write toggle, advancing PPUDATA or driving the
+// I/O latch
+func (ppu *PPU) PeekRegister(addr uint16) byte {
+	latch := ppu.decayedLatch()
+	switch addr {
+	case 0x2002: // PPUSTATUS
+		return ppu.PPUStatus&0xE0 | latch&0x1F
+	case 0x2004: // OAMDATA
+		if ppu.rendering() {
+			return ppu.oamLatch
+		}
+		return ppu.OAM[ppu.OAMADDR]
+	case 0x2007: // PPUDATA
+		if ppu.v < 0x3F00 {
+			return ppu.bufferedRead
+		}
+		data := ppu.Read(ppu.v)
+		if ppu.PPUMASK&0x01 != 0 {
+			data &= 0x30
+		}
+		return data&0x3F | latch&0xC0
+	default:
+		return latch
+	}
+}
+
+// PokeRegister sets what a register holds at $2000-$2007: PPUCTRL,
+// PPUSTATUS, PPUMASK, OAMADDR, the OAM byte at OAMADDR or the PPU memory
+// at the VRAM address. Addresses do not increment and the write toggle is
+// left alone, so PPUSCROLL and PPUADDR writes are ignored. The NMI line
+// follows PPUCTRL and PPUSTATUS, so poking them can raise an NMI.
+func (ppu *PPU) PokeRegister(addr uint16, data byte) {
+	switch addr {
+	case 0x2000: // PPUCTRL
+		ppu.PPUCTRL = data
+		ppu.t = (ppu.t & 0xF3FF) | ((uint16(data) & 0x03) << 10)
+		ppu.updateNMI()
+	case 0x2001: // PPUMASK
+		ppu.PPUMASK = data
+	case 0x2002: // PPUSTATUS, only the flags exist
+		ppu.PPUStatus = ppu.PPUStatus&0x1F | data&0xE0
+		ppu.updateNMI()
+	case 0x2003: // OAMADDR
+		ppu.OAMADDR = data
+	case 0x2004: // OAMDATA
+		ppu.OAM[ppu.OAMADDR] = data
+	case 0x2007: // PPUDATA
+		ppu.Poke(ppu.v, data)
+	}
+}
@@ -0,0 +1,60 @@
+package ppu
+
+import "testing"
+
+func TestPeekRegister(t *testing.T) {
+	ppu := New(make([]byte, 0x2000))
+	ppu.WriteRegister(0x2003, 0xFF)
+	ppu.PPUStatus = 0x80
+	ppu.w = true
+
+	// A peek sees what the read would and leaves VBlank and the toggle
+	if got := ppu.PeekRegister(0x2002); got != 0x9F {
+		t.Errorf("PPUSTATUS: expected $9F, got $%02X", got)
+	}
+	if ppu.PPUStatus&0x80 == 0 || !ppu.w {
+		t.Errorf("peeking PPUSTATUS cleared VBlank or the write toggle")
+	}
+	if got := ppu.ReadRegister(0x2002); got != 0x9F {
+		t.Errorf("PPUSTATUS after the peek: expected $9F, got $%02X", got)
+	}
+
+	// PPUDATA: the buffer, without reloading it or moving the address
+	ppu.VRAM[0] = 0x11
+	ppu.VRAM[1] = 0x22
+	ppu.WriteRegister(0x2006, 0x20)
+	ppu.WriteRegister(0x2006, 0x00)
+	ppu.ReadRegister(0x2007)
+	if got := ppu.PeekRegister(0x2007); got != 0x11 || ppu.v != 0x2001 {
+		t.Errorf("PPUDATA: expected $11 at $2001, got $%02X at $%04X", got, ppu.v)
+	}
+	if got := ppu.ReadRegister(0x2007); got != 0x11 {
+		t.Errorf("PPUDATA after the peek: expected $11, got $%02X", got)
+	}
+
+	// Palette reads take the top 2 bits from the bus, as in TestOpenBus
+	ppu.PaletteTable[0] = 0x2A
+	ppu.WriteRegister(0x2006, 0x3F)
+	ppu.WriteRegister(0x2006, 0x00)
+	ppu.WriteRegister(0x2001, 0xC0)
+	if got := ppu.PeekRegister(0x2007); got != 0xEA {
+		t.Errorf("palette: expected $EA, got $%02X", got)
+	}
+}
+
+func TestPoke(t *testing.T) {
+	ppu := New(make([]byte, 0x2000))
+	ppu.Poke(0x0010, 0x55)
+	ppu.Poke(0x2400, 0x66)
+	ppu.Poke(0x3F10, 0x0F)
+	if ppu.CHR[0x10] != 0x55 || ppu.Peek(0x2400) != 0x66 || ppu.Peek(0x3F00) != 0x0F {
+		t.Errorf("expected the pokes in CHR, VRAM and the palette")
+	}
+
+	ppu.OAMADDR = 4
+	ppu.PokeRegister(0x2004, 0x77)
+	ppu.PokeRegister(0x2005, 0x12)
+	if ppu.OAM[4] != 0x77 || ppu.OAMADDR != 4 || ppu.w {
+		t.Errorf("expected OAM[4]=$77 with OAMADDR and the toggle unchanged")
+	}
+}
@@ -1,11 +1,5 @@
 package ppu
 
-import (
-	"image/color"
-
-	"github.com/hajimehoshi/ebiten/v2"
-)
-
 // https://www.nesdev.org/wiki/PPU_registers
 type PPU struct {
 	// Control registers
@@ -19,7 +13,22 @@ type PPU struct {
 	PPUDATA   byte // $2007
 	OAMDMA    byte // $4014
 
-	framebuffer [240][256]byte // 240x256 framebuffer
+	framebuffer Frame // 240x256 framebuffer
+
+	// Palette converts the framebuffer to RGB, nil means DefaultPalette
+	Palette *Palette
+
+	// Frame timing of the PPU variant, nil means NTSCTiming
+	timing *Timing
+
+	// UnlimitedSprites draws every sprite of a line instead of the first 8
+	// to reduce flicker. Only the picture changes: the overflow flag,
+	// sprite 0 hit and everything else the CPU sees follow the hardware.
+	UnlimitedSprites bool
+
+	// OnAccess is a debugger hook for the VRAM accesses of the CPU through
+	// PPUDATA, called after reads and before writes. nil when not debugging.
+	OnAccess func(addr uint16, value byte, write bool)
 
 	VRAM [0x800]byte // 2kb internal RAM
 
@@ -44,12 +53,18 @@ type PPU struct {
 	frame    int // Current frame
 
 	// Flags
-	nmiOccurred bool // NMI occurred flag
-	nmiOutput   bool // NMI output flag
-	nmiPrevious bool // Previous NMI output flag
+	nmiOccurred bool // NMI occurred flag: an NMI edge waits for the CPU
+	nmiOutput   bool // NMI output flag: PPUCTRL bit 7
+	nmiPrevious bool // Previous NMI output flag: level of the NMI line
+	// A $2002 read one dot before vblank keeps the flag clear for this frame
+	suppressVBlank bool
 
 	bufferedRead byte // Buffered read value
 
+	// I/O data bus latch and the frame each of its bits was last driven
+	ioLatch     byte
+	ioRefreshed [8]int
+
 	// Background shift registers
 	bgPatternLow    uint16 // битовая плоскость 0
 	bgPatternHigh   uint16 // битовая плоскость 1
@@ -64,12 +79,27 @@ type PPU struct {
 
 	// Sprite rendering
 	secondaryOAM       [32]byte // 8 sprites * 4 bytes
-	spriteCount        int      // Number of sprites found on next scanline
+	spriteCount        int      // Number of sprites fetched for the current scanline
 	spritePatternsLow  [8]byte  // Low byte of sprite pattern
 	spritePatternsHigh [8]byte  // High byte of sprite pattern
 	spritePositions    [8]byte  // X position of sprite
 	spriteAttributes   [8]byte  // Attributes of sprite
 	spriteIndexes      [8]byte  // Index in OAM (for Sprite 0 hit)
+
+	// Sprite evaluation, see sprites.go
+	oamLatch         byte    // Last OAM byte read by the PPU, returned by $2004 during rendering
+	secondaryAddr    int     // Next free byte of secondary OAM
+	secondaryIndexes [8]byte // Evaluation order of the sprites in secondary OAM
+	evalChecked      int     // Sprites checked so far on this line
+	evalCopy         int     // Bytes of the current sprite left to copy
+	evalDone         bool    // All 64 sprites were checked
+
+	// Sprites of the current line beyond the first 8, for UnlimitedSprites
+	extraCount        int
+	extraPatternsLow  [56]byte
+	extraPatternsHigh [56]byte
+	extraPositions    [56]byte
+	extraAttributes   [56]byte
 }
 
 func (ppu *PPU) Reset() {
@@ -84,8 +114,12 @@ func (ppu *PPU) Reset() {
 	ppu.w = false
 	ppu.PPUStatus = 0
 	ppu.bufferedRead = 0
+	ppu.ioLatch = 0
+	ppu.ioRefreshed = [8]int{}
 	ppu.nmiOccurred = false
 	ppu.nmiOutput = false
+	ppu.nmiPrevious = false
+	ppu.suppressVBlank = false
 	// Сбросить шифтеры
 	ppu.bgPatternLow = 0
 	ppu.bgPatternHigh = 0
@@ -100,6 +134,9 @@ func (ppu *PPU) Reset() {
 		ppu.spriteAttributes[i] = 0
 		ppu.spriteIndexes[i] = 0
 	}
+	ppu.secondaryAddr = 0
+	ppu.evalCopy = 0
+	ppu.evalDone = false
 }
 
 func New(chr []byte) *PPU {
@@ -116,6 +153,11 @@ func (ppu *PPU) Scanline() int {
 	return ppu.scanline
 }
 
+// FrameCount returns the number of frames rendered since power on
+func (ppu *PPU) FrameCount() int {
+	return ppu.frame
+}
+
 func (ppu *PPU) NMIOccurred() bool {
 	return ppu.nmiOccurred
 }
@@ -124,42 +166,62 @@ func (ppu *PPU) ClearNMI() {
 	ppu.nmiOccurred = false
 }
 
+// updateNMI follows the NMI line: the vblank flag ANDed with PPUCTRL bit 7.
+// The CPU takes an NMI on every rising edge, so enabling NMI during vblank
+// raises one at once, and toggling bit 7 off and on again raises another.
+func (ppu *PPU) updateNMI() {
+	ppu.nmiOutput = ppu.PPUCTRL&0x80 != 0
+	line := ppu.nmiOutput && ppu.PPUStatus&0x80 != 0
+	if line && !ppu.nmiPrevious {
+		ppu.nmiOccurred = true
+	}
+	ppu.nmiPrevious = line
+}
+
 func (ppu *PPU) Step() {
+	timing := ppu.Timing()
+	preRender := timing.Scanlines - 1 // 261 NTSC, 311 PAL/Dendy
+
+	renderingEnabled := (ppu.PPUMASK&0x08 != 0) || (ppu.PPUMASK&0x10 != 0) // Background or Sprite enable
+
 	// 1. Инкремент циклов/сканлайнов/кадров
 	ppu.cycle++
+	// On odd frames dot 340 of the pre-render line is skipped: 339 goes straight to 0,0
+	if ppu.scanline == preRender && ppu.cycle == 340 && timing.SkipOddDot && ppu.frame&1 == 1 && renderingEnabled {
+		ppu.cycle = 341
+	}
 	if ppu.cycle >= 341 { // 0-340 циклов
 		ppu.cycle = 0
 		ppu.scanline++
 
-		if ppu.scanline >= 262 { // 0-261 сканлайнов
+		if ppu.scanline > preRender {
 			ppu.scanline = 0
 			ppu.frame++
 			// Здесь можно сигнализировать об окончании кадра для рендеринга на главном потоке
 		}
 	}
 
-	renderingEnabled := (ppu.PPUMASK&0x08 != 0) || (ppu.PPUMASK&0x10 != 0) // Background or Sprite enable
-
 	// 2. Обработка PPUSTATUS (флаги NMI, Sprite Zero Hit, Sprite Overflow)
 	// Эти флаги сбрасываются в начале пред-рендеринг сканлайна (261)
-	if ppu.scanline == 261 && ppu.cycle == 1 {
+	if ppu.scanline == preRender && ppu.cycle == 1 {
 		ppu.PPUStatus &= (^(byte(1 << 7))) // Clear VBlank flag
 		ppu.PPUStatus &= (^(byte(1 << 6))) // Clear Sprite 0 Hit flag
 		ppu.PPUStatus &= (^(byte(1 << 5))) // Clear Sprite Overflow flag
-		ppu.nmiOccurred = false
+		ppu.updateNMI()
 	}
 
 	// 3. Логика NMI
-	// NMI генерируется на scanline 241, cycle 1, если включен в PPUCTRL
-	if ppu.scanline == 241 && ppu.cycle == 1 {
-		ppu.PPUStatus |= (1 << 7)    // Set VBlank flag
-		if ppu.PPUCTRL&(1<<7) != 0 { // Если NMI включен
-			ppu.nmiOccurred = true
+	// NMI генерируется на scanline 241 (291 на Dendy), cycle 1, если включен в PPUCTRL
+	if ppu.scanline == timing.VBlankLine && ppu.cycle == 1 {
+		if !ppu.suppressVBlank {
+			ppu.PPUStatus |= (1 << 7) // Set VBlank flag
 		}
+		ppu.suppressVBlank = false
+		ppu.updateNMI()
 	}
 
 	// 4. Логика рендеринга (Visible Scanlines 0-239 and Pre-render Scanline 261)
-	if (ppu.scanline >= 0 && ppu.scanline <= 239) || ppu.scanline == 261 {
+	if (ppu.scanline >= 0 && ppu.scanline <= 239) || ppu.scanline == preRender {
 		// --- Фаза предвыборки данных (Background Fetch) ---
 		// PPU Fetch sequence: NT byte -> AT byte -> Low Tile byte -> High Tile byte (every 8 cycles)
 		// These happen on cycles: 1, 9, 17, ... 257, 321, 329
@@ -215,7 +277,7 @@ func (ppu *PPU) Step() {
 		}
 
 		// Копирование вертикальных битов VRAM из T в V (на пред-рендеринг сканлайне 261)
-		if ppu.scanline == 261 && ppu.cycle >= 280 && ppu.cycle <= 304 && renderingEnabled {
+		if ppu.scanline == preRender && ppu.cycle >= 280 && ppu.cycle <= 304 && renderingEnabled {
 			ppu.v = (ppu.v & 0x841F) | (ppu.t & 0x7BE0) // V_vert = T_vert
 		}
 
@@ -237,16 +299,9 @@ func (ppu *PPU) Step() {
 			}
 		}
 
-		// Sprite evaluation (Cycles 65-256)
-		if ppu.cycle == 257 && renderingEnabled {
-			ppu.evaluateSprites()
-		}
-
-		// Sprite fetches (Cycles 257-320)
-		// Simplified: do all fetches at 257 for now or spread them if needed.
-		// For accurate timing we should spread them, but for functionality 257 is okay to prepare for next line.
-		if ppu.cycle == 320 && renderingEnabled {
-			ppu.fetchSpritePatterns()
+		// Sprite evaluation for the next line (dots 1-256) and sprite fetches (257-320)
+		if renderingEnabled {
+			ppu.stepSprites(ppu.scanline == preRender)
 		}
 	}
 }
@@ -284,83 +339,6 @@ func (ppu *PPU) shiftBackgroundRegisters() {
 	ppu.bgAttributeHigh <<= 1
 }
 
-var nesPalette = [64]color.RGBA{
-	{84, 84, 84, 255},    // 0x00
-	{0, 30, 116, 255},    // 0x01
-	{8, 16, 144, 255},    // 0x02
-	{48, 0, 136, 255},    // 0x03
-	{68, 0, 100, 255},    // 0x04
-	{92, 0, 48, 255},     // 0x05
-	{84, 4, 0, 255},      // 0x06
-	{60, 24, 0, 255},     // 0x07
-	{32, 42, 0, 255},     // 0x08
-	{8, 58, 0, 255},      // 0x09
-	{0, 64, 0, 255},      // 0x0A
-	{0, 60, 0, 255},      // 0x0B
-	{0, 50, 60, 255},     // 0x0C
-	{0, 0, 0, 255},       // 0x0D
-	{0, 0, 0, 255},       // 0x0E
-	{0, 0, 0, 255},       // 0x0F
-	{152, 150, 152, 255}, // 0x10
-	{8, 76, 196, 255},    // 0x11
-	{48, 50, 236, 255},   // 0x12
-	{92, 30, 228, 255},   // 0x13
-	{136, 20, 176, 255},  // 0x14
-	{160, 20, 100, 255},  // 0x15
-	{152, 34, 32, 255},   // 0x16
-	{120, 60, 0, 255},    // 0x17
-	{84, 90, 0, 255},     // 0x18
-	{40, 114, 0, 255},    // 0x19
-	{8, 124, 0, 255},     // 0x1A
-	{0, 118, 40, 255},    // 0x1B
-	{0, 102, 120, 255},   // 0x1C
-	{0, 0, 0, 255},       // 0x1D
-	{0, 0, 0, 255},       // 0x1E
-	{0, 0, 0, 255},       // 0x1F
-	{236, 238, 236, 255}, // 0x20
-	{76, 154, 236, 255},  // 0x21
-	{120, 124, 236, 255}, // 0x22
-	{176, 98, 236, 255},  // 0x23
-	{228, 84, 236, 255},  // 0x24
-	{236, 88, 180, 255},  // 0x25
-	{236, 106, 100, 255}, // 0x26
-	{212, 136, 32, 255},  // 0x27
-	{160, 170, 0, 255},   // 0x28
-	{116, 196, 0, 255},   // 0x29
-	{76, 208, 32, 255},   // 0x2A
-	{56, 204, 108, 255},  // 0x2B
-	{56, 180, 204, 255},  // 0x2C
-	{60, 60, 60, 255},    // 0x2D
-	{0, 0, 0, 255},       // 0x2E
-	{0, 0, 0, 255},       // 0x2F
-	{236, 238, 236, 255}, // 0x30
-	{168, 204, 236, 255}, // 0x31
-	{188, 188, 236, 255}, // 0x32
-	{212, 178, 236, 255}, // 0x33
-	{236, 174, 236, 255}, // 0x34
-	{236, 174, 212, 255}, // 0x35
-	{236, 180, 176, 255}, // 0x36
-	{228, 196, 144, 255}, // 0x37
-	{204, 210, 120, 255}, // 0x38
-	{180, 222, 120, 255}, // 0x39
-	{168, 226, 144, 255}, // 0x3A
-	{152, 226, 180, 255}, // 0x3B
-	{160, 214, 228, 255}, // 0x3C
-	{160, 162, 160, 255}, // 0x3D
-	{0, 0, 0, 255},       // 0x3E
-	{0, 0, 0, 255},       // 0x3F
-}
-
-func (p *PPU) DrawToImage(dst *ebiten.Image) {
-	for y := 0; y < 240; y++ {
-		for x := 0; x < 256; x++ {
-			colorIndex := p.framebuffer[y][x] & 0x3F // 6 бит
-			c := nesPalette[colorIndex]
-			dst.Set(x, y, c)
-		}
-	}
-}
-
 func (ppu *PPU) Read(addr uint16) byte {
 	addr %= 0x4000 // PPU Memory Map is 0x0000 - 0x3FFF
 
@@ -426,15 +404,39 @@ func (ppu *PPU) ReadRegister(addr uint16) byte {
 		status := ppu.PPUStatus
 		ppu.PPUStatus &= (^(byte(1 << 7))) // Clear VBlank flag
 		ppu.w = false                      // Clear write toggle
-		return status
+		// The read races with the vblank flag being set on dot 1
+		if ppu.scanline == ppu.Timing().VBlankLine {
+			switch ppu.cycle {
+			case 0: // One dot early: reads clear and the flag is not set this frame
+				ppu.suppressVBlank = true
+			case 1, 2: // Same dot or one later: reads set but there is no NMI
+				ppu.nmiOccurred = false
+			}
+		}
+		ppu.updateNMI()
+		// Only the flags are driven, the low 5 bits are open bus
+		return ppu.readBus(status, 0xE0)
 	case 0x2004: // OAMDATA
-		return ppu.OAM[ppu.OAMADDR]
+		// During rendering the PPU drives the OAM bus with its own reads
+		if ppu.rendering() {
+			return ppu.readBus(ppu.oamLatch, 0xFF)
+		}
+		return ppu.readBus(ppu.OAM[ppu.OAMADDR], 0xFF)
 	case 0x2007: // PPUDATA
 		data := ppu.bufferedRead
 		ppu.bufferedRead = ppu.Read(ppu.v) // Загружаем следующее значение
+		if ppu.OnAccess != nil {
+			ppu.OnAccess(ppu.v&0x3FFF, ppu.bufferedRead, false)
+		}
+		mask := byte(0xFF)
 		// Для чтения из палитры - нет буфера, возвращаем сразу
 		if ppu.v >= 0x3F00 {
 			data = ppu.Read(ppu.v)
+			if ppu.PPUMASK&0x01 != 0 { // Greyscale applies to palette reads too
+				data &= 0x30
+			}
+			// Palette entries are 6 bits, the top 2 are open bus
+			mask = 0x3F
 		}
 		// Инкремент VRAM адреса
 		if ppu.PPUCTRL&(1<<2) != 0 { // Bit 2 of PPUCTRL (VRAM address increment)
@@ -442,25 +444,39 @@ func (ppu *PPU) ReadRegister(addr uint16) byte {
 		} else {
 			ppu.v += 1 // Horizontal increment
 		}
-		return data
+		return ppu.readBus(data, mask)
 	default:
-		// Open bus behavior: last value written or last read
-		// For simplicity, return 0 for now or whatever was last on the bus
-		return ppu.bufferedRead // Or some other default
+		// Write-only registers return the I/O latch
+		return ppu.openBus()
 	}
 }
 
 // Write registers
 func (ppu *PPU) WriteRegister(addr uint16, data byte) {
+	ppu.driveBus(data, 0xFF)
 	switch addr {
 	case 0x2000: // PPUCTRL
 		ppu.PPUCTRL = data
 		ppu.t = (ppu.t & 0xF3FF) | ((uint16(data) & 0x03) << 10) // Update nametable select in T
+		// Disabling NMI right after vblank starts cancels the NMI
+		if data&0x80 == 0 && ppu.scanline == ppu.Timing().VBlankLine && ppu.cycle <= 2 {
+			ppu.nmiOccurred = false
+		}
+		ppu.updateNMI()
 	case 0x2001: // PPUMASK
 		ppu.PPUMASK = data
 	case 0x2003: // OAMADDR
 		ppu.OAMADDR = data
 	case 0x2004: // OAMDATA
+		// During rendering the write is lost and bumps the sprite index of OAMADDR
+		if ppu.rendering() {
+			ppu.OAMADDR += 4
+			return
+		}
+		// Bits 2-4 of the attribute byte do not exist
+		if ppu.OAMADDR&0x03 == 2 {
+			data &= 0xE3
+		}
 		ppu.OAM[ppu.OAMADDR] = data
 		ppu.OAMADDR++ // OAMADDR auto-increments
 	case 0x2005: // PPUSCROLL
@@ -481,6 +497,9 @@ func (ppu *PPU) WriteRegister(addr uint16, data byte) {
 		}
 		ppu.w = !ppu.w
 	case 0x2007: // PPUDATA
+		if ppu.OnAccess != nil {
+			ppu.OnAccess(ppu.v&0x3FFF, data, true)
+		}
 		ppu.Write(ppu.v, data)
 		// Инкремент VRAM адреса
 		if ppu.PPUCTRL&(1<<2) != 0 { // Bit 2 of PPUCTRL (VRAM address increment)
@@ -533,137 +552,6 @@ func (ppu *PPU) incrementScrollY() {
 	}
 }
 
-func (ppu *PPU) evaluateSprites() {
-	// Clear secondary OAM
-	ppu.spriteCount = 0
-	for i := 0; i < 32; i++ {
-		ppu.secondaryOAM[i] = 0xFF
-	}
-
-	// Sprite height (8x8 or 8x16)
-	spriteHeight := 8
-	if ppu.PPUCTRL&0x20 != 0 {
-		spriteHeight = 16
-	}
-
-	count := 0
-	for i := 0; i < 64; i++ {
-		y := int(ppu.OAM[i*4])
-		// Check if sprite is on next scanline
-		// Note: Sprite Y is delayed by one scanline, so we check against scanline (which is currently being rendered,
-		// but we are preparing for scanline + 1? No, evaluation happens for the *next* scanline).
-		// Actually, PPU renders current scanline, and evaluates sprites for the NEXT scanline.
-		// So we check if sprite is in range [scanline, scanline + height).
-		// Wait, standard behavior: Y byte in OAM is Y-1.
-		// So sprite is visible on lines Y+1 to Y+height.
-		// We are currently at `ppu.scanline`. We are preparing for `ppu.scanline`.
-		// Wait, evaluation happens on scanline N for scanline N.
-		// The sprites evaluated on scanline N are rendered on scanline N+1.
-
-		// Let's assume we are preparing for the NEXT scanline (ppu.scanline).
-		// The Y coordinate in OAM is the top of the sprite minus 1.
-		// So if OAM_Y = 10, sprite starts at 11.
-		// If we are on scanline 11, we want to render it.
-		// Evaluation happens on scanline 10.
-
-		// So, diff = scanline - y.
-		// If 0 <= diff < height, then it is visible on the NEXT scanline?
-		// Let's stick to: we are evaluating for the current `ppu.scanline` to be rendered?
-		// No, evaluation runs on scanline N to prepare for N+1.
-		// So we check if sprite will be on scanline N+1?
-		// Or does the `scanline` variable track the one being rendered?
-		// Usually `scanline` is the one being output.
-
-		// Correct logic:
-		// On scanline N:
-		// We evaluate sprites that will appear on scanline N.
-		// Wait, no. We evaluate on N for N.
-		// Actually, let's look at the Y coordinate.
-		// If OAM Y = 10. Sprite is on lines 11-18 (for 8x8).
-		// We are currently rendering line 10. We evaluate for line 10? No.
-		// We evaluate for line 11.
-
-		// Let's use the standard logic:
-		// Target line = ppu.scanline.
-		// diff = targetLine - y
-		// If 0 <= diff < height -> Visible.
-
-		diff := ppu.scanline - y
-		if diff >= 0 && diff < spriteHeight {
-			if count < 8 {
-				// Copy sprite data to secondary OAM
-				ppu.secondaryOAM[count*4+0] = ppu.OAM[i*4+0]
-				ppu.secondaryOAM[count*4+1] = ppu.OAM[i*4+1]
-				ppu.secondaryOAM[count*4+2] = ppu.OAM[i*4+2]
-				ppu.secondaryOAM[count*4+3] = ppu.OAM[i*4+3]
-
-				// Store index for Sprite 0 detection
-				ppu.spriteIndexes[count] = byte(i)
-				count++
-			} else {
-				// Sprite overflow flag would be set here
-				ppu.PPUStatus |= 0x20
-				break
-			}
-		}
-	}
-	ppu.spriteCount = count
-}
-
-func (ppu *PPU) fetchSpritePatterns() {
-	spriteHeight := 8
-	if ppu.PPUCTRL&0x20 != 0 {
-		spriteHeight = 16
-	}
-
-	for i := 0; i < ppu.spriteCount; i++ {
-		y := int(ppu.secondaryOAM[i*4+0])
-		tileIndex := ppu.secondaryOAM[i*4+1]
-		attributes := ppu.secondaryOAM[i*4+2]
-		x := ppu.secondaryOAM[i*4+3]
-
-		ppu.spritePositions[i] = x
-		ppu.spriteAttributes[i] = attributes
-
-		// Calculate row within the sprite
-		// We are preparing for the current scanline (which we just evaluated? No, we evaluated for THIS scanline).
-		// Wait, if we evaluated for `ppu.scanline`, then we are fetching for `ppu.scanline`.
-		row := ppu.scanline - y
-
-		// Vertical flip
-		if attributes&0x80 != 0 {
-			row = spriteHeight - 1 - row
-		}
-
-		var addr uint16
-		if spriteHeight == 8 {
-			// 8x8 Sprites
-			// Table from PPUCTRL bit 3
-			table := uint16(0)
-			if ppu.PPUCTRL&0x08 != 0 {
-				table = 0x1000
-			}
-			addr = table | (uint16(tileIndex) << 4) | uint16(row)
-		} else {
-			// 8x16 Sprites
-			// Table from bit 0 of tile index
-			table := uint16(0)
-			if tileIndex&1 != 0 {
-				table = 0x1000
-			}
-			tileIndex &= 0xFE // Ignore last bit
-			if row >= 8 {
-				tileIndex++
-				row -= 8
-			}
-			addr = table | (uint16(tileIndex) << 4) | uint16(row)
-		}
-
-		ppu.spritePatternsLow[i] = ppu.Read(addr)
-		ppu.spritePatternsHigh[i] = ppu.Read(addr + 8)
-	}
-}
-
 func (ppu *PPU) renderPixel() {
 	if ppu.scanline >= 0 && ppu.scanline <= 239 && ppu.cycle >= 1 && ppu.cycle <= 256 {
 		renderBackground := (ppu.PPUMASK & 0x08) != 0
@@ -725,6 +613,10 @@ func (ppu *PPU) renderPixel() {
 						}
 					}
 				}
+				// Extra sprites come after the real ones and never hit sprite 0
+				if spritePixel == 0 && ppu.UnlimitedSprites {
+					spritePixel, spritePalette, spritePriority = ppu.extraSpritePixel()
+				}
 			}
 		}
 
@@ -756,6 +648,15 @@ func (ppu *PPU) renderPixel() {
 			}
 		}
 
-		ppu.framebuffer[ppu.scanline][ppu.cycle-1] = finalColorIndex
+		// Greyscale keeps only the brightness column of the colour
+		if ppu.PPUMASK&0x01 != 0 {
+			finalColorIndex &= 0x30
+		}
+		// Bits 6-8 of the pixel are the emphasis bits 5-7 of PPUMASK, always in red, green, blue order
+		emphasis := ppu.PPUMASK & 0xE0
+		if ppu.Timing().SwapEmphasis {
+			emphasis = emphasis&0x80 | emphasis&0x40>>1 | emphasis&0x20<<1
+		}
+		ppu.framebuffer[ppu.scanline][ppu.cycle-1] = uint16(finalColorIndex&0x3F) | uint16(emphasis)<<1
 	}
 }
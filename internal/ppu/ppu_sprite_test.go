@@ -61,3 +61,171 @@ func TestSprite0Hit(t *testing.T) {
 		t.Errorf("Sprite 0 Hit failed. Status: 0x%02X", ppu.PPUStatus)
 	}
 }
+
+// newSpritePPU returns a PPU with rendering on and all sprites off screen
+func newSpritePPU() *PPU {
+	chr := make([]byte, 0x2000)
+	for i := range chr {
+		chr[i] = byte(i >> 4) // Every byte of tile n is n
+	}
+	ppu := New(chr)
+	ppu.PPUMASK = 0x18
+	for i := range ppu.OAM {
+		ppu.OAM[i] = 0xF0
+	}
+	return ppu
+}
+
+func setSprite(ppu *PPU, n int, y, tile, attributes, x byte) {
+	copy(ppu.OAM[n*4:], []byte{y, tile, attributes, x})
+}
+
+func TestSpriteEvaluation(t *testing.T) {
+	ppu := newSpritePPU()
+	for n := 0; n < 9; n++ {
+		setSprite(ppu, n*2, 10, byte(n+1), 0, byte(n*8))
+	}
+
+	runTo(ppu, 11, 0)
+	if ppu.spriteCount != 8 {
+		t.Fatalf("expected 8 sprites on line 11, got %d", ppu.spriteCount)
+	}
+	if ppu.PPUStatus&0x20 == 0 {
+		t.Errorf("expected the sprite overflow flag with 9 sprites")
+	}
+	for i := 0; i < 8; i++ {
+		if ppu.spritePositions[i] != byte(i*8) || ppu.spritePatternsLow[i] != byte(i+1) {
+			t.Errorf("slot %d: unexpected sprite X %d pattern %d", i, ppu.spritePositions[i], ppu.spritePatternsLow[i])
+		}
+		if ppu.spriteIndexes[i] != byte(i*2) {
+			t.Errorf("slot %d: expected OAM index %d, got %d", i, i*2, ppu.spriteIndexes[i])
+		}
+	}
+	if ppu.OAMADDR != 0 {
+		t.Errorf("expected OAMADDR reset to 0 by the fetches, got %d", ppu.OAMADDR)
+	}
+}
+
+func TestSpriteOverflowBug(t *testing.T) {
+	ppu := newSpritePPU()
+	for n := 0; n < 8; n++ {
+		setSprite(ppu, n, 10, 0, 0, 0)
+	}
+	// Sprite 8 is out of range, so the next check reads byte 1 of sprite 9:
+	// its tile number looks like a Y on the line
+	setSprite(ppu, 9, 0xF0, 10, 0, 0)
+
+	runTo(ppu, 11, 0)
+	if ppu.PPUStatus&0x20 == 0 {
+		t.Errorf("expected a false sprite overflow")
+	}
+
+	// The diagonal scan misses a real 9th sprite
+	ppu = newSpritePPU()
+	for n := 0; n < 8; n++ {
+		setSprite(ppu, n, 10, 0, 0, 0)
+	}
+	setSprite(ppu, 10, 10, 0, 0, 0)
+
+	runTo(ppu, 11, 0)
+	if ppu.PPUStatus&0x20 != 0 {
+		t.Errorf("expected the overflow of sprite 10 to be missed")
+	}
+}
+
+func TestSpriteEvaluationStartsAtOAMADDR(t *testing.T) {
+	ppu := newSpritePPU()
+	setSprite(ppu, 0, 10, 1, 0, 0)
+	setSprite(ppu, 1, 10, 2, 0, 8)
+
+	// OAMADDR left at sprite 1 by the game: sprite 0 is never evaluated
+	runTo(ppu, 10, 64)
+	ppu.OAMADDR = 4
+	runTo(ppu, 11, 0)
+
+	if ppu.spriteCount != 1 || ppu.spritePositions[0] != 8 {
+		t.Fatalf("expected only sprite 1, got %d sprites", ppu.spriteCount)
+	}
+	// It is the first one evaluated, so it takes the role of sprite 0
+	if ppu.spriteIndexes[0] != 0 {
+		t.Errorf("expected sprite 1 to act as sprite 0")
+	}
+}
+
+func TestOAMDataDuringRendering(t *testing.T) {
+	ppu := newSpritePPU()
+	setSprite(ppu, 0, 10, 0x42, 0, 0)
+
+	runTo(ppu, 10, 30)
+	if got := ppu.ReadRegister(0x2004); got != 0xFF {
+		t.Errorf("expected $FF while secondary OAM is cleared, got $%02X", got)
+	}
+	runTo(ppu, 10, 67)
+	if got := ppu.ReadRegister(0x2004); got != 0x42 {
+		t.Errorf("expected the tile byte read by the evaluation, got $%02X", got)
+	}
+
+	// Writes are dropped and move OAMADDR to the next sprite
+	runTo(ppu, 20, 300)
+	ppu.WriteRegister(0x2004, 0x99)
+	if ppu.OAMADDR != 4 || ppu.OAM[0] != 10 {
+		t.Errorf("unexpected OAMADDR %d and OAM[0] $%02X", ppu.OAMADDR, ppu.OAM[0])
+	}
+
+	// Outside rendering OAM is read directly
+	ppu.PPUMASK = 0
+	ppu.OAMADDR = 1
+	if got := ppu.ReadRegister(0x2004); got != 0x42 {
+		t.Errorf("expected OAM[1], got $%02X", got)
+	}
+}
+
+func TestSpriteFetchTiming(t *testing.T) {
+	ppu := newSpritePPU()
+	setSprite(ppu, 0, 10, 1, 0, 0)
+	setSprite(ppu, 1, 10, 2, 0, 0)
+
+	// The low pattern of slot 0 is read on dot 261, slot 1 eight dots later
+	runTo(ppu, 10, 260)
+	if ppu.spritePatternsLow[0] != 0 {
+		t.Errorf("slot 0 fetched too early")
+	}
+	runTo(ppu, 10, 261)
+	if ppu.spritePatternsLow[0] != 1 || ppu.spritePatternsLow[1] != 0 {
+		t.Errorf("unexpected patterns after dot 261: %v", ppu.spritePatternsLow)
+	}
+	runTo(ppu, 10, 269)
+	if ppu.spritePatternsLow[1] != 2 {
+		t.Errorf("slot 1 not fetched on dot 269")
+	}
+}
+
+func TestUnlimitedSprites(t *testing.T) {
+	for _, unlimited := range []bool{false, true} {
+		ppu := newSpritePPU()
+		ppu.UnlimitedSprites = unlimited
+		ppu.PaletteTable[0x13] = 0x16
+		for n := 0; n < 10; n++ {
+			setSprite(ppu, n, 10, 0xFF, 0, byte(16+n*16))
+		}
+
+		runTo(ppu, 12, 0)
+		// The CPU sees the same overflow either way
+		if ppu.PPUStatus&0x20 == 0 {
+			t.Errorf("unlimited %v: expected the sprite overflow flag", unlimited)
+		}
+		if got := ppu.framebuffer[11][16]; got != 0x16 {
+			t.Errorf("unlimited %v: expected sprite 0 drawn, got $%02X", unlimited, got)
+		}
+
+		want := uint16(0)
+		if unlimited {
+			want = 0x16
+		}
+		for _, x := range []int{16 + 8*16, 16 + 9*16} {
+			if got := ppu.framebuffer[11][x]; got != want {
+				t.Errorf("unlimited %v: expected $%02X at x=%d, got $%02X", unlimited, want, x, got)
+			}
+		}
+	}
+}
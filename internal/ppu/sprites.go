@@ -0,0 +1,259 @@
+package ppu
+
+// Sprite evaluation and fetches, dot by dot as the 2C02 does them.
+// https://www.nesdev.org/wiki/PPU_sprite_evaluation
+//
+// On every visible line the PPU prepares the sprites of the next line:
+//
+//	dots 1-64     secondary OAM is filled with $FF
+//	dots 65-256   primary OAM is scanned from OAMADDR, in-range sprites are
+//	              copied to secondary OAM, odd dots read and even dots write
+//	dots 257-320  OAMADDR is held at 0 and the patterns of the 8 sprites in
+//	              secondary OAM are fetched, 8 dots per sprite
+
+// rendering reports whether the PPU is using OAM and VRAM itself
+func (ppu *PPU) rendering() bool {
+	renderingEnabled := ppu.PPUMASK&0x18 != 0
+	visible := ppu.scanline < ScreenHeight || ppu.scanline == ppu.Timing().Scanlines-1
+	return renderingEnabled && visible
+}
+
+func (ppu *PPU) spriteHeight() int {
+	if ppu.PPUCTRL&0x20 != 0 {
+		return 16
+	}
+	return 8
+}
+
+// stepSprites runs the sprite pipeline for the current dot of a rendered line
+func (ppu *PPU) stepSprites(preRender bool) {
+	switch {
+	case ppu.cycle >= 1 && ppu.cycle <= 64:
+		// Reads of secondary OAM return $FF while it is cleared
+		ppu.oamLatch = 0xFF
+		if !preRender && ppu.cycle%2 == 0 {
+			ppu.secondaryOAM[ppu.cycle/2-1] = 0xFF
+		}
+
+	case ppu.cycle >= 65 && ppu.cycle <= 256:
+		// No evaluation on the pre-render line, so no sprites on line 0
+		if preRender {
+			return
+		}
+		if ppu.cycle == 65 {
+			ppu.secondaryAddr = 0
+			ppu.evalChecked = 0
+			ppu.evalCopy = 0
+			ppu.evalDone = false
+		}
+		if ppu.cycle%2 == 1 {
+			ppu.oamLatch = ppu.OAM[ppu.OAMADDR]
+		} else {
+			ppu.evaluateSprite()
+		}
+
+	case ppu.cycle >= 257 && ppu.cycle <= 320:
+		ppu.OAMADDR = 0
+		ppu.fetchSprite(preRender)
+
+	default:
+		ppu.oamLatch = ppu.secondaryOAM[0]
+	}
+}
+
+// evaluateSprite handles the byte read on the previous dot
+func (ppu *PPU) evaluateSprite() {
+	switch {
+	case ppu.evalDone:
+		// Evaluation keeps running: the Y of the next sprite goes to the
+		// free slot, where it is overwritten by the next one
+		if ppu.secondaryAddr < len(ppu.secondaryOAM) {
+			ppu.secondaryOAM[ppu.secondaryAddr] = ppu.oamLatch
+		}
+		ppu.OAMADDR += 4
+
+	case ppu.evalCopy > 0:
+		// Tile, attributes and X of an in-range sprite
+		ppu.secondaryOAM[ppu.secondaryAddr] = ppu.oamLatch
+		ppu.secondaryAddr++
+		ppu.evalCopy--
+		ppu.advanceOAM(1)
+
+	case ppu.secondaryAddr < len(ppu.secondaryOAM):
+		// Y is always copied, the slot is only kept if the sprite is in range
+		ppu.secondaryOAM[ppu.secondaryAddr] = ppu.oamLatch
+		if ppu.spriteInRange(ppu.oamLatch) {
+			ppu.secondaryIndexes[ppu.secondaryAddr/4] = byte(min(ppu.evalChecked, 0xFF))
+			ppu.secondaryAddr++
+			ppu.evalCopy = 3
+			ppu.advanceOAM(1)
+		} else {
+			ppu.advanceOAM(4)
+		}
+		ppu.evalChecked++
+
+	default:
+		// Secondary OAM is full: look for a 9th sprite to set the overflow flag
+		if ppu.spriteInRange(ppu.oamLatch) {
+			ppu.PPUStatus |= 0x20
+			// The PPU reads the rest of the sprite, then stops looking
+			ppu.advanceOAM(3)
+			ppu.evalDone = true
+			return
+		}
+		// Hardware bug: m is incremented together with n, so the following
+		// sprites are checked against their tile, attribute or X byte
+		next := int(ppu.OAMADDR&0xFC) + 4
+		ppu.OAMADDR = byte(next) | (ppu.OAMADDR+1)&0x03
+		if next >= 0x100 {
+			ppu.evalDone = true
+		}
+	}
+}
+
+// advanceOAM moves OAMADDR on and ends the evaluation when it wraps past sprite 63
+func (ppu *PPU) advanceOAM(delta int) {
+	next := int(ppu.OAMADDR) + delta
+	ppu.OAMADDR = byte(next)
+	if next >= 0x100 {
+		ppu.evalDone = true
+	}
+}
+
+// spriteInRange reports whether a sprite with the given Y is on the next line.
+// Sprites are drawn one line below their Y.
+func (ppu *PPU) spriteInRange(y byte) bool {
+	row := ppu.scanline - int(y)
+	return row >= 0 && row < ppu.spriteHeight()
+}
+
+// fetchSprite runs one dot of the fetches of dots 257-320. Each sprite takes
+// 8 dots: two garbage nametable reads, then the low and high pattern bytes.
+// Empty slots fetch tile $FF, which mappers watching A12 see too.
+func (ppu *PPU) fetchSprite(preRender bool) {
+	i := (ppu.cycle - 257) / 8
+	entry := ppu.secondaryOAM[i*4 : i*4+4]
+
+	switch (ppu.cycle - 257) % 8 {
+	case 0:
+		if i == 0 {
+			// The sprites of the next line replace the ones just drawn
+			ppu.spriteCount = ppu.secondaryAddr / 4
+			if preRender {
+				ppu.spriteCount = 0
+			}
+			ppu.spriteIndexes = ppu.secondaryIndexes
+			if ppu.UnlimitedSprites {
+				ppu.fetchExtraSprites()
+			}
+		}
+		ppu.oamLatch = entry[0]
+		ppu.Read(0x2000 | (ppu.v & 0x0FFF))
+	case 1:
+		ppu.oamLatch = entry[1]
+	case 2:
+		ppu.oamLatch = entry[2]
+		ppu.spriteAttributes[i] = entry[2]
+		ppu.Read(0x2000 | (ppu.v & 0x0FFF))
+	case 3:
+		ppu.oamLatch = entry[3]
+		ppu.spritePositions[i] = entry[3]
+	case 4:
+		ppu.spritePatternsLow[i] = ppu.fetchSpritePattern(i, entry, 0)
+	case 6:
+		ppu.spritePatternsHigh[i] = ppu.fetchSpritePattern(i, entry, 8)
+	}
+}
+
+// fetchSpritePattern reads one bit plane of the row of sprite slot i on the next line
+func (ppu *PPU) fetchSpritePattern(i int, entry []byte, plane uint16) byte {
+	data := ppu.Read(ppu.spritePatternAddr(entry[0], entry[1], entry[2]) + plane)
+	// Empty slots are transparent whatever they fetch
+	if i >= ppu.spriteCount {
+		return 0
+	}
+	return data
+}
+
+// spritePatternAddr returns the address of the low bit plane of the row of a sprite on the next line
+func (ppu *PPU) spritePatternAddr(y, tileIndex, attributes byte) uint16 {
+	spriteHeight := ppu.spriteHeight()
+
+	row := (ppu.scanline - int(y)) & (spriteHeight - 1)
+	// Vertical flip
+	if attributes&0x80 != 0 {
+		row = spriteHeight - 1 - row
+	}
+
+	if spriteHeight == 8 {
+		// 8x8 Sprites
+		// Table from PPUCTRL bit 3
+		table := uint16(0)
+		if ppu.PPUCTRL&0x08 != 0 {
+			table = 0x1000
+		}
+		return table | (uint16(tileIndex) << 4) | uint16(row)
+	}
+
+	// 8x16 Sprites
+	// Table from bit 0 of tile index
+	table := uint16(0)
+	if tileIndex&1 != 0 {
+		table = 0x1000
+	}
+	tileIndex &= 0xFE // Ignore last bit
+	if row >= 8 {
+		tileIndex++
+		row -= 8
+	}
+	return table | (uint16(tileIndex) << 4) | uint16(row)
+}
+
+// fetchExtraSprites finds the sprites of the next line beyond the first 8
+// for UnlimitedSprites. Their patterns are read straight from CHR, so
+// mappers watching the PPU address bus do not see the extra fetches.
+func (ppu *PPU) fetchExtraSprites() {
+	ppu.extraCount = 0
+	skip := ppu.spriteCount // Already in secondary OAM
+	if skip < 8 {
+		return
+	}
+	for n := 0; n < 64; n++ {
+		sprite := ppu.OAM[n*4 : n*4+4]
+		if !ppu.spriteInRange(sprite[0]) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		addr := ppu.spritePatternAddr(sprite[0], sprite[1], sprite[2])
+		i := ppu.extraCount
+		ppu.extraPatternsLow[i] = ppu.CHR[addr]
+		ppu.extraPatternsHigh[i] = ppu.CHR[addr+8]
+		ppu.extraAttributes[i] = sprite[2]
+		ppu.extraPositions[i] = sprite[3]
+		ppu.extraCount++
+	}
+}
+
+// extraSpritePixel returns the pixel of the sprites beyond the first 8 at the current dot
+func (ppu *PPU) extraSpritePixel() (pixel, palette byte, behind bool) {
+	for i := 0; i < ppu.extraCount; i++ {
+		col := (ppu.cycle - 1) - int(ppu.extraPositions[i])
+		if col < 0 || col >= 8 {
+			continue
+		}
+		attributes := ppu.extraAttributes[i]
+		// Horizontal flip
+		if attributes&0x40 != 0 {
+			col = 7 - col
+		}
+		bit0 := (ppu.extraPatternsLow[i] >> (7 - col)) & 1
+		bit1 := (ppu.extraPatternsHigh[i] >> (7 - col)) & 1
+		if pixel := bit0 | bit1<<1; pixel != 0 {
+			return pixel, attributes&0x03 + 4, attributes&0x20 != 0
+		}
+	}
+	return 0, 0, false
+}
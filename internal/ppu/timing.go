@@ -0,0 +1,40 @@
+package ppu
+
+// Timing describes the frame of a PPU variant.
+// https://www.nesdev.org/wiki/Cycle_reference_chart
+type Timing struct {
+	// Scanlines per frame, the last one is the pre-render line
+	Scanlines int
+	// VBlankLine is the scanline where the vblank flag is set and NMI fires
+	VBlankLine int
+	// SwapEmphasis swaps the red and green emphasis bits of PPUMASK
+	SwapEmphasis bool
+	// SkipOddDot shortens the pre-render line of odd frames by one dot when rendering is on
+	SkipOddDot bool
+	// OpenBusDecay is the number of frames until a bit of the I/O latch
+	// that is not refreshed reads 0, about 600 ms
+	OpenBusDecay int
+}
+
+var (
+	// NTSCTiming is the RP2C02: 20 lines of vblank
+	NTSCTiming = Timing{Scanlines: 262, VBlankLine: 241, SkipOddDot: true, OpenBusDecay: 36}
+	// PALTiming is the RP2C07: 70 lines of vblank
+	PALTiming = Timing{Scanlines: 312, VBlankLine: 241, SwapEmphasis: true, OpenBusDecay: 30}
+	// DendyTiming is the UMC UA6538: PAL frame length with the NTSC vblank
+	// length, the extra 50 lines come before vblank
+	DendyTiming = Timing{Scanlines: 312, VBlankLine: 291, SwapEmphasis: true, OpenBusDecay: 30}
+)
+
+// SetTiming switches the PPU to another variant
+func (ppu *PPU) SetTiming(timing Timing) {
+	ppu.timing = &timing
+}
+
+// Timing returns the variant the PPU emulates
+func (ppu *PPU) Timing() Timing {
+	if ppu.timing == nil {
+		return NTSCTiming
+	}
+	return *ppu.timing
+}
@@ -0,0 +1,166 @@
+package ppu
+
+import "testing"
+
+// runTo steps the PPU until it reaches the given dot
+func runTo(ppu *PPU, scanline, cycle int) {
+	for ppu.scanline != scanline || ppu.cycle != cycle {
+		ppu.Step()
+	}
+}
+
+func TestVBlankLine(t *testing.T) {
+	for _, timing := range []Timing{NTSCTiming, PALTiming, DendyTiming} {
+		ppu := New(make([]byte, 0x2000))
+		ppu.SetTiming(timing)
+		ppu.PPUCTRL = 0x80
+
+		runTo(ppu, timing.VBlankLine, 0)
+		if ppu.PPUStatus&0x80 != 0 || ppu.NMIOccurred() {
+			t.Errorf("%+v: vblank set before line %d", timing, timing.VBlankLine)
+		}
+		ppu.Step()
+		if ppu.PPUStatus&0x80 == 0 || !ppu.NMIOccurred() {
+			t.Errorf("%+v: vblank not set on line %d", timing, timing.VBlankLine)
+		}
+
+		runTo(ppu, timing.Scanlines-1, 1)
+		if ppu.PPUStatus&0x80 != 0 {
+			t.Errorf("%+v: vblank not cleared on the pre-render line", timing)
+		}
+	}
+}
+
+func TestPALEmphasisSwap(t *testing.T) {
+	ppu := &PPU{
+		// Background on, PAL green emphasis (bit 5)
+		PPUMASK: 0x08 | 0x20,
+	}
+	ppu.SetTiming(PALTiming)
+	ppu.PaletteTable[0] = 0x16
+	ppu.scanline = 0
+	ppu.cycle = 1
+
+	ppu.renderPixel()
+	// Stored as green emphasis (pixel bit 7), like NTSC bit 6 of PPUMASK
+	if got := ppu.framebuffer[0][0]; got != 0x16|0x2<<6 {
+		t.Errorf("expected pixel $096, got $%03X", got)
+	}
+}
+
+// frameDots counts the dots of the next frame
+func frameDots(ppu *PPU) int {
+	frame := ppu.FrameCount()
+	dots := 0
+	for ppu.FrameCount() == frame {
+		ppu.Step()
+		dots++
+	}
+	return dots
+}
+
+func TestOddFrameDotSkip(t *testing.T) {
+	ppu := New(make([]byte, 0x2000))
+	ppu.PPUMASK = 0x08
+	frameDots(ppu) // Finish frame 0 started at power on
+
+	// Frame 1 is odd
+	if got := frameDots(ppu); got != 341*262-1 {
+		t.Errorf("odd frame: expected %d dots, got %d", 341*262-1, got)
+	}
+	if got := frameDots(ppu); got != 341*262 {
+		t.Errorf("even frame: expected %d dots, got %d", 341*262, got)
+	}
+
+	// No skip with rendering off, or on PAL
+	ppu.PPUMASK = 0
+	if got := frameDots(ppu); got != 341*262 {
+		t.Errorf("rendering off: expected %d dots, got %d", 341*262, got)
+	}
+	ppu.PPUMASK = 0x08
+	ppu.SetTiming(PALTiming)
+	frameDots(ppu)
+	if got := frameDots(ppu); got != 341*312 {
+		t.Errorf("PAL: expected %d dots, got %d", 341*312, got)
+	}
+}
+
+func TestStatusReadRacesVBlank(t *testing.T) {
+	tests := []struct {
+		cycle      int // Dot of line 241 when $2002 is read
+		wantStatus byte
+		wantNMI    bool
+		wantFlag   bool // Vblank flag after the read and the next dots
+	}{
+		{cycle: 0, wantStatus: 0, wantNMI: false, wantFlag: false},
+		{cycle: 1, wantStatus: 0x80, wantNMI: false, wantFlag: false},
+		{cycle: 2, wantStatus: 0x80, wantNMI: false, wantFlag: false},
+		{cycle: 3, wantStatus: 0x80, wantNMI: true, wantFlag: false},
+	}
+	for _, tt := range tests {
+		ppu := New(make([]byte, 0x2000))
+		ppu.WriteRegister(0x2000, 0x80)
+		runTo(ppu, 241, tt.cycle)
+
+		if got := ppu.ReadRegister(0x2002) & 0x80; got != tt.wantStatus {
+			t.Errorf("dot %d: expected status $%02X, got $%02X", tt.cycle, tt.wantStatus, got)
+		}
+		runTo(ppu, 241, 10)
+		if ppu.NMIOccurred() != tt.wantNMI {
+			t.Errorf("dot %d: expected NMI %v", tt.cycle, tt.wantNMI)
+		}
+		if got := ppu.PPUStatus&0x80 != 0; got != tt.wantFlag {
+			t.Errorf("dot %d: expected vblank flag %v", tt.cycle, tt.wantFlag)
+		}
+	}
+}
+
+func TestNMIEdgeOnPPUCTRLWrite(t *testing.T) {
+	ppu := New(make([]byte, 0x2000))
+	runTo(ppu, 250, 0)
+	if ppu.NMIOccurred() {
+		t.Fatalf("NMI raised with NMI disabled")
+	}
+
+	// Enabling NMI during vblank raises it at once
+	ppu.WriteRegister(0x2000, 0x80)
+	if !ppu.NMIOccurred() {
+		t.Errorf("expected an NMI when enabling it during vblank")
+	}
+	ppu.ClearNMI()
+
+	// Writing bit 7 again is not an edge
+	ppu.WriteRegister(0x2000, 0x80)
+	if ppu.NMIOccurred() {
+		t.Errorf("expected no NMI without a rising edge")
+	}
+
+	// Toggling it off and on is
+	ppu.WriteRegister(0x2000, 0x00)
+	ppu.WriteRegister(0x2000, 0x80)
+	if !ppu.NMIOccurred() {
+		t.Errorf("expected an NMI after toggling PPUCTRL bit 7")
+	}
+	ppu.ClearNMI()
+
+	// Outside vblank there is nothing to raise
+	runTo(ppu, 0, 10)
+	ppu.WriteRegister(0x2000, 0x00)
+	ppu.WriteRegister(0x2000, 0x80)
+	if ppu.NMIOccurred() {
+		t.Errorf("expected no NMI outside vblank")
+	}
+}
+
+func TestDisablingNMIAtVBlankStartCancelsIt(t *testing.T) {
+	ppu := New(make([]byte, 0x2000))
+	ppu.WriteRegister(0x2000, 0x80)
+	runTo(ppu, 241, 1)
+	ppu.WriteRegister(0x2000, 0x00)
+	if ppu.NMIOccurred() {
+		t.Errorf("expected the NMI to be cancelled")
+	}
+	if ppu.PPUStatus&0x80 == 0 {
+		t.Errorf("expected the vblank flag to stay set")
+	}
+}
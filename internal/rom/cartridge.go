@@ -13,4 +13,8 @@ type Cartridge struct {
 	Mapper    byte          // Mapper type
 	Mirroring MirroringType // Mirroring type
 	HasCHRROM bool          // Indicates if the cartridge has CHR ROM
+
+	IsNES20         bool   // Header is in NES 2.0 format
+	ExpansionDevice byte   // NES 2.0 default expansion device, 0 if unspecified
+	Region          Region // TV system the game was made for
 }
@@ -0,0 +1,89 @@
+package rom
+
+import (
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+)
+
+// Database holds what iNES 1.0 headers do not say about games: the TV
+// system and the expansion device, by the checksum of their ROM data.
+// It reads the NES 2.0 XML database (nes20db.xml) maintained by the
+// NesDev community; no database comes with the emulator.
+// https://forums.nesdev.org/viewtopic.php?t=19940
+type Database map[uint32]DatabaseEntry
+
+// DatabaseEntry is the NES 2.0 header data of a game in the database
+type DatabaseEntry struct {
+	Region          Region
+	ExpansionDevice byte
+}
+
+// LoadDatabase reads a database file
+func LoadDatabase(path string) (Database, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	db, err := ParseDatabase(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+// nes20db is the part of the XML database the emulator uses. The rom
+// element has the checksum of PRG and CHR ROM together, without header.
+type nes20db struct {
+	Games []struct {
+		ROM struct {
+			CRC32 string `xml:"crc32,attr"`
+		} `xml:"rom"`
+		Console struct {
+			Region int `xml:"region,attr"`
+		} `xml:"console"`
+		Expansion struct {
+			Type int `xml:"type,attr"`
+		} `xml:"expansion"`
+	} `xml:"game"`
+}
+
+// ParseDatabase reads the NES 2.0 XML database
+func ParseDatabase(r io.Reader) (Database, error) {
+	var doc nes20db
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	db := Database{}
+	for _, g := range doc.Games {
+		crc, err := strconv.ParseUint(g.ROM.CRC32, 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad crc32 %q", g.ROM.CRC32)
+		}
+		db[uint32(crc)] = DatabaseEntry{
+			Region:          Region(g.Console.Region & 0x03),
+			ExpansionDevice: byte(g.Expansion.Type & 0x3F),
+		}
+	}
+	return db, nil
+}
+
+// Checksum returns the CRC32 of PRG and CHR ROM, the key of the database
+func (c *Cartridge) Checksum() uint32 {
+	crc := crc32.ChecksumIEEE(c.PRG)
+	if c.HasCHRROM {
+		crc = crc32.Update(crc, crc32.IEEETable, c.CHR)
+	}
+	return crc
+}
+
+// Lookup finds the entry of a cartridge
+func (db Database) Lookup(c *Cartridge) (DatabaseEntry, bool) {
+	entry, ok := db[c.Checksum()]
+	return entry, ok
+}
@@ -0,0 +1,53 @@
+package rom
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDatabase(t *testing.T) {
+	prg := make([]byte, 16*1024)
+	prg[0] = 0x42
+	cartridge := &Cartridge{PRG: prg}
+
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+<nes20db date="2024-01-01">
+	<game>
+		<!-- Test\Game (E).nes -->
+		<prgrom size="16384" crc32="00000000"/>
+		<rom size="16384" crc32="` + fmt.Sprintf("%08X", cartridge.Checksum()) + `"/>
+		<pcb mapper="0" submapper="0" mirroring="H" battery="0"/>
+		<console type="0" region="1"/>
+		<expansion type="12"/>
+	</game>
+</nes20db>`
+	db, err := ParseDatabase(strings.NewReader(xml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := db.Lookup(cartridge)
+	if !ok || entry.Region != RegionPAL || entry.ExpansionDevice != 12 {
+		t.Errorf("unexpected entry %+v, %v", entry, ok)
+	}
+
+	// LoadRomWith prefers the database to the file name of an iNES 1.0 ROM
+	path := filepath.Join(t.TempDir(), "Game (U).nes")
+	data := append([]byte{'N', 'E', 'S', 0x1A, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, prg...)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadRomWith(path, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Region != RegionPAL || loaded.ExpansionDevice != 12 {
+		t.Errorf("expected PAL with the Power Pad side B from the database, got %v and %d", loaded.Region, loaded.ExpansionDevice)
+	}
+
+	if _, err := ParseDatabase(strings.NewReader(`<nes20db><game><rom crc32="xyz"/></game></nes20db>`)); err == nil {
+		t.Errorf("expected an error for a bad checksum")
+	}
+}
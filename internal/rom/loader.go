@@ -6,6 +6,12 @@ import (
 )
 
 func LoadRom(path string) (*Cartridge, error) {
+	return LoadRomWith(path, nil)
+}
+
+// LoadRomWith reads a ROM file, looking up iNES 1.0 ROMs in a database,
+// which may be nil
+func LoadRomWith(path string, db Database) (*Cartridge, error) {
 	// Open the ROM file
 	data, err := os.ReadFile(path)
 
@@ -13,7 +19,24 @@ func LoadRom(path string) (*Cartridge, error) {
 		return nil, err
 	}
 
-	return createCartridge(data)
+	cartridge, err := createCartridge(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Old iNES headers rarely set the TV system: the database knows it,
+	// and the file name is a better guess than the header
+	if !cartridge.IsNES20 {
+		if entry, ok := db.Lookup(cartridge); ok {
+			cartridge.Region = entry.Region
+			cartridge.ExpansionDevice = entry.ExpansionDevice
+		} else if cartridge.Region == RegionNTSC {
+			if region, ok := RegionFromFilename(path); ok {
+				cartridge.Region = region
+			}
+		}
+	}
+	return cartridge, nil
 }
 
 func createCartridge(data []byte) (*Cartridge, error) {
@@ -74,5 +97,15 @@ func createCartridge(data []byte) (*Cartridge, error) {
 		HasCHRROM: hasCHRRom,
 	}
 
+	// NES 2.0 is identified by bits 2-3 of flag 7 being %10
+	if flag7&0x0C == 0x08 {
+		cartridge.IsNES20 = true
+		cartridge.ExpansionDevice = data[15] & 0x3F
+		cartridge.Region = Region(data[12] & 0x03)
+	} else if data[9]&0x01 != 0 {
+		// iNES flag 9: TV system
+		cartridge.Region = RegionPAL
+	}
+
 	return cartridge, nil
 }
@@ -29,3 +29,52 @@ func TestCreateCartridge(t *testing.T) {
 		t.Fatal("expected an error for invalid ROM file")
 	}
 }
+
+func TestCartridgeRegion(t *testing.T) {
+	header := func(flag7, flag9, byte12 byte) []byte {
+		data := []byte{'N', 'E', 'S', 0x1A, 1, 0, 0, flag7, 0, flag9, 0, 0, byte12, 0, 0, 0}
+		return append(data, make([]byte, 16*1024)...)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want Region
+	}{
+		{"iNES NTSC", header(0, 0, 0), RegionNTSC},
+		{"iNES PAL flag", header(0, 1, 0), RegionPAL},
+		{"NES 2.0 PAL", header(0x08, 0, 1), RegionPAL},
+		{"NES 2.0 Dendy", header(0x08, 0, 3), RegionDendy},
+		{"NES 2.0 ignores iNES flag 9", header(0x08, 1, 0), RegionNTSC},
+	}
+	for _, tt := range tests {
+		cartridge, err := createCartridge(tt.data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if cartridge.Region != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, cartridge.Region)
+		}
+	}
+}
+
+func TestRegionFromFilename(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   Region
+		wantOK bool
+	}{
+		{"./assets/roms/Super Mario Bros (E).nes", RegionPAL, true},
+		{"Tetris (U) [!].nes", RegionNTSC, true},
+		{"Game (Europe) (En,Fr,De).nes", RegionPAL, true},
+		{"Game (USA, Europe).nes", RegionNTSC, true},
+		{"Game (R) [p1].nes", RegionDendy, true},
+		{"nestest.nes", RegionNTSC, false},
+	}
+	for _, tt := range tests {
+		got, ok := RegionFromFilename(tt.name)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("%s: expected %v %v, got %v %v", tt.name, tt.want, tt.wantOK, got, ok)
+		}
+	}
+}
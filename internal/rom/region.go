@@ -0,0 +1,75 @@
+package rom
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Region is the TV system of a console or game.
+// The values match the CPU/PPU timing field of the NES 2.0 header.
+type Region int
+
+const (
+	RegionNTSC  Region = iota // RP2C02, 60 Hz (North America, Japan)
+	RegionPAL                 // RP2C07, 50 Hz (Europe, Australia)
+	RegionMulti               // Runs on both, played as NTSC
+	RegionDendy               // Famiclone timing, 50 Hz (Russia, former USSR)
+)
+
+var regionNames = [...]string{"ntsc", "pal", "multi", "dendy"}
+
+func (r Region) String() string {
+	if r < 0 || int(r) >= len(regionNames) {
+		return fmt.Sprintf("Region(%d)", int(r))
+	}
+	return regionNames[r]
+}
+
+// ParseRegion reads a region name: ntsc, pal or dendy
+func ParseRegion(name string) (Region, error) {
+	for r, n := range regionNames {
+		if n == strings.ToLower(name) && Region(r) != RegionMulti {
+			return Region(r), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown region: %q (expected ntsc, pal or dendy)", name)
+}
+
+// Country tags of GoodNES and No-Intro file names, e.g. "Super Mario Bros (E).nes"
+var (
+	regionTag = regexp.MustCompile(`\(([^)]*)\)`)
+	palTags   = []string{"E", "A", "G", "F", "S", "I", "Sw", "Europe", "Australia", "Germany", "France", "Spain", "Italy", "Sweden", "PAL"}
+	dendyTags = []string{"R", "Russia", "Dendy"}
+	ntscTags  = []string{"U", "J", "JU", "USA", "Japan", "NTSC"}
+)
+
+// RegionFromFilename guesses the region from the country tags of a ROM file name.
+// ok is false when the name has no known tag.
+func RegionFromFilename(path string) (region Region, ok bool) {
+	name := filepath.Base(path)
+	for _, match := range regionTag.FindAllStringSubmatch(name, -1) {
+		for _, tag := range strings.Split(match[1], ",") {
+			tag = strings.TrimSpace(tag)
+			switch {
+			case hasTag(dendyTags, tag):
+				return RegionDendy, true
+			case hasTag(palTags, tag):
+				return RegionPAL, true
+			case hasTag(ntscTags, tag):
+				return RegionNTSC, true
+			}
+		}
+	}
+	return RegionNTSC, false
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
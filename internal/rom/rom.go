@@ -1,25 +1,37 @@
 package rom
 
-func (c *Cartridge) ReadPRG(addr uint16) byte {
-	if c.PRG == nil {
-		return 0
+// PRGOffset returns the offset in PRG ROM the CPU reads at addr, or -1
+// below $8000. Debug symbols of banked ROMs resolve through it.
+func (c *Cartridge) PRGOffset(addr uint16) int {
+	if len(c.PRG) == 0 || addr < 0x8000 {
+		return -1
 	}
+	// 16KB PRG is mirrored at $C000, 32KB is mapped directly
+	return int(addr-0x8000) % len(c.PRG) // PRG-ROM начинается с 0x8000
+}
 
-	addr -= 0x8000 // PRG-ROM начинается с 0x8000
-
-	if len(c.PRG) == 0x4000 {
-		// Если только 16KB PRG, дублируем банк (mirror)
-		addr %= 0x4000
-	} else if len(c.PRG) == 0x8000 {
-		// Если 32KB — прямой доступ
-		addr %= 0x8000
-	} else {
-		addr %= uint16(len(c.PRG))
+func (c *Cartridge) ReadPRG(addr uint16) byte {
+	offset := c.PRGOffset(addr)
+	if offset < 0 {
+		return 0
 	}
-
-	return c.PRG[addr]
+	return c.PRG[offset]
 }
 
 func (c *Cartridge) WritePRG(addr uint16, value byte) {
 	panic("WritePRG not implemented")
 }
+
+// Peek returns what ReadPRG would without the side effects a mapper may
+// have on reads, for debuggers
+func (c *Cartridge) Peek(addr uint16) byte {
+	return c.ReadPRG(addr)
+}
+
+// Poke patches PRG ROM where addr is mapped, e.g. for a debugger. Writes
+// outside ROM are ignored.
+func (c *Cartridge) Poke(addr uint16, value byte) {
+	if offset := c.PRGOffset(addr); offset >= 0 {
+		c.PRG[offset] = value
+	}
+}
@@ -0,0 +1,229 @@
+package symbols
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// inesHeader is the size of the header before PRG ROM in the output file
+// of ld65, which the file offsets of segments count
+const inesHeader = 16
+
+// LoadDbg reads a debug file written by ld65 --dbgfile. Relative source
+// paths are taken as relative to the directory of the debug file.
+func (t *Table) LoadDbg(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := t.ReadDbg(f, filepath.Dir(path)); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// dbgRecord is a line of a debug file: a type and its key=value fields
+type dbgRecord struct {
+	kind   string
+	fields map[string]string
+}
+
+func parseRecord(text string) (dbgRecord, error) {
+	kind, rest, _ := strings.Cut(text, "\t")
+	r := dbgRecord{kind: kind, fields: map[string]string{}}
+	for rest != "" {
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			return r, fmt.Errorf("bad field %q", rest)
+		}
+		if strings.HasPrefix(value, `"`) {
+			// Quoted strings may contain commas
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				return r, fmt.Errorf("unterminated string in %q", text)
+			}
+			r.fields[key] = value[1 : end+1]
+			rest = strings.TrimPrefix(value[end+2:], ",")
+			continue
+		}
+		value, rest, _ = strings.Cut(value, ",")
+		r.fields[key] = value
+	}
+	return r, nil
+}
+
+// int reads a decimal or 0x hex field, 0 if missing
+func (r dbgRecord) int(key string) (int, error) {
+	s, ok := r.fields[key]
+	if !ok {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: bad %s %q", r.kind, key, s)
+	}
+	return int(n), nil
+}
+
+// ints reads several fields, stopping at the first error
+func (r dbgRecord) ints(fields map[string]*int) error {
+	for key, dst := range fields {
+		var err error
+		if *dst, err = r.int(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ids reads a list of IDs like "3+4+7"
+func (r dbgRecord) ids(key string) ([]int, error) {
+	var ids []int
+	for _, s := range strings.Split(r.fields[key], "+") {
+		if s == "" {
+			continue
+		}
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bad %s %q", r.kind, key, s)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// segment of a debug file. Segments in ROM have their offset in PRG ROM,
+// the others -1.
+type segment struct {
+	start int
+	prg   int
+}
+
+// prgOffset returns the PRG offset of addr in the segment, -1 if not in ROM
+func (s segment) prgOffset(addr int) int {
+	if s.prg < 0 {
+		return -1
+	}
+	return s.prg + addr - s.start
+}
+
+// ReadDbg reads the debug file of ld65: the labels, and the source lines
+// assembled into the read-only segments, the code and data in ROM.
+// Relative source paths are joined to dir.
+func (t *Table) ReadDbg(r io.Reader, dir string) error {
+	type span struct {
+		seg, start, size int
+	}
+	files := map[int]string{}
+	segments := map[int]segment{}
+	rom := map[int]bool{}
+	spans := map[int]span{}
+	// Lines and symbols may come before the spans and segments they use
+	var lines, syms []dbgRecord
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		rec, err := parseRecord(text)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+		id, err := rec.int("id")
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+
+		switch rec.kind {
+		case "file":
+			name := rec.fields["name"]
+			if dir != "" && !filepath.IsAbs(name) {
+				name = filepath.Join(dir, name)
+			}
+			files[id] = name
+		case "seg":
+			s := segment{prg: -1}
+			var offset int
+			if err := rec.ints(map[string]*int{"start": &s.start, "ooffs": &offset}); err != nil {
+				return fmt.Errorf("line %d: %w", n, err)
+			}
+			// Segments in RAM, like the copied DATA, keep the file offset of their load address
+			rom[id] = rec.fields["type"] == "ro"
+			if _, ok := rec.fields["ooffs"]; ok && rom[id] && offset >= inesHeader {
+				s.prg = offset - inesHeader
+			}
+			segments[id] = s
+		case "span":
+			var s span
+			if err := rec.ints(map[string]*int{"seg": &s.seg, "start": &s.start, "size": &s.size}); err != nil {
+				return fmt.Errorf("line %d: %w", n, err)
+			}
+			spans[id] = s
+		case "line":
+			lines = append(lines, rec)
+		case "sym":
+			syms = append(syms, rec)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, rec := range lines {
+		var fileID, number int
+		if err := rec.ints(map[string]*int{"file": &fileID, "line": &number}); err != nil {
+			return err
+		}
+		spanIDs, err := rec.ids("span")
+		if err != nil {
+			return err
+		}
+		for _, id := range spanIDs {
+			s, ok := spans[id]
+			if !ok || !rom[s.seg] || s.size == 0 {
+				continue
+			}
+			seg := segments[s.seg]
+			t.addLine(Line{
+				File: files[fileID],
+				Line: number,
+				Addr: uint16(seg.start + s.start),
+				PRG:  seg.prgOffset(seg.start + s.start),
+				size: s.size,
+			})
+		}
+	}
+	t.sortLines()
+
+	for _, rec := range syms {
+		// Equates are constants more often than addresses, imports repeat exports
+		if rec.fields["type"] != "lab" {
+			continue
+		}
+		var value, size int
+		if err := rec.ints(map[string]*int{"val": &value, "size": &size}); err != nil {
+			return err
+		}
+		prg := -1
+		if segID, ok := rec.fields["seg"]; ok {
+			id, err := strconv.Atoi(segID)
+			if err != nil {
+				return fmt.Errorf("sym: bad seg %q", segID)
+			}
+			if seg, ok := segments[id]; ok {
+				prg = seg.prgOffset(value)
+			}
+		}
+		t.addSymbol(Symbol{Name: rec.fields["name"], Addr: uint16(value), Size: size, PRG: prg})
+	}
+	return nil
+}
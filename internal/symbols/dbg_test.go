@@ -0,0 +1,111 @@
+package symbols
+
+import (
+	"strings"
+	"testing"
+)
+
+// Output of ld65 --dbgfile for a small program, trimmed
+const testDbg = `version	major=2,minor=0
+info	csym=0,file=2,lib=0,line=8,mod=1,scope=2,seg=3,span=6,sym=3,type=3
+file	id=0,name="src/main.s",size=210,mtime=0x66000000,mod=0
+file	id=1,name="src/macros.inc",size=80,mtime=0x66000000,mod=0
+line	id=0,file=0,line=5,span=0
+line	id=1,file=0,line=6,span=1
+line	id=2,file=0,line=8,span=2
+line	id=3,file=0,line=12,type=2,span=3
+line	id=4,file=1,line=3,span=4
+line	id=5,file=0,line=20,span=5
+line	id=6,file=0,line=2
+mod	id=0,name="main.o",file=0
+seg	id=0,name="CODE",start=0x008000,size=0x0010,addrsize=absolute,type=ro,oname="game.nes",ooffs=16
+seg	id=1,name="BSS",start=0x000300,size=0x0002,addrsize=absolute,type=rw
+seg	id=2,name="VECTORS",start=0x00FFFA,size=0x0006,addrsize=absolute,type=ro,oname="game.nes",ooffs=32762
+span	id=0,seg=0,start=0,size=2
+span	id=1,seg=0,start=2,size=3
+span	id=2,seg=0,start=5,size=1
+span	id=3,seg=0,start=6,size=4
+span	id=4,seg=0,start=6,size=2
+span	id=5,seg=1,start=0,size=2
+sym	id=0,name="Reset",addrsize=absolute,scope=0,def=0,val=0x8000,seg=0,type=lab
+sym	id=1,name="@loop",addrsize=absolute,scope=0,def=2,val=0x8005,seg=0,type=lab
+sym	id=2,name="Main",addrsize=absolute,scope=0,def=2,val=0x8005,seg=0,type=lab
+sym	id=3,name="buffer",addrsize=absolute,size=2,scope=0,def=5,val=0x0300,seg=1,type=lab
+sym	id=4,name="PPUCTRL",addrsize=absolute,scope=0,def=1,val=0x2000,type=equ
+`
+
+func TestReadDbg(t *testing.T) {
+	table := New()
+	if err := table.ReadDbg(strings.NewReader(testDbg), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		addr uint16
+		file string
+		line int
+	}{
+		{0x8000, "src/main.s", 5},
+		{0x8003, "src/main.s", 6},
+		// Inside the macro call, the line of the macro body wins
+		{0x8007, "src/macros.inc", 3},
+		{0x8008, "src/main.s", 12},
+	}
+	for _, tt := range tests {
+		l, ok := table.LineAt(tt.addr)
+		if !ok || l.File != tt.file || l.Line != tt.line {
+			t.Errorf("$%04X: expected %s:%d, got %v %v", tt.addr, tt.file, tt.line, l, ok)
+		}
+	}
+	// RAM segments are not code
+	if l, ok := table.LineAt(0x0300); ok {
+		t.Errorf("expected no line at $0300, got %v", l)
+	}
+
+	// A line without code moves to the next one
+	l, addrs, ok := table.Find("/home/user/game/src/main.s", 7)
+	if !ok || l.Line != 8 || len(addrs) != 1 || addrs[0] != 0x8005 {
+		t.Errorf("expected line 8 at $8005, got %v %X %v", l, addrs, ok)
+	}
+	if _, _, ok := table.Find("other.s", 1); ok {
+		t.Errorf("expected no match for another file")
+	}
+	if _, _, ok := table.Find("src/main.s", 13); ok {
+		t.Errorf("expected no code after line 12")
+	}
+	if l.PRG != 5 {
+		t.Errorf("expected line 8 at PRG offset 5, got %d", l.PRG)
+	}
+
+	for addr, want := range map[uint16]string{
+		0x8000: "Reset",
+		0x8005: "Main", // Not the cheap local label
+		0x0300: "buffer",
+		0x0301: "buffer+1",
+		0x0302: "",
+		0x2000: "", // Equates are left out
+	} {
+		if got := table.Label(addr); got != want {
+			t.Errorf("$%04X: expected %q, got %q", addr, want, got)
+		}
+	}
+	if s, ok := table.Lookup("Main"); !ok || s.Addr != 0x8005 || s.PRG != 5 {
+		t.Errorf("unexpected Main %+v", s)
+	}
+	if s, ok := table.Nearest(0x8007); !ok || s.Name != "Main" {
+		t.Errorf("expected $8007 in Main, got %+v", s)
+	}
+}
+
+func TestReadDbgErrors(t *testing.T) {
+	for _, bad := range []string{
+		"file\tid=0,name=\"main.s",
+		"span\tid=0,seg=0,start=zero,size=1",
+		"line\tid=0,file=0,line=1,span=1+x",
+		"seg\tid",
+	} {
+		if err := New().ReadDbg(strings.NewReader(bad), ""); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package symbols
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// prgBankSize is the size of the banks FCEUX numbers its .nl files by
+const prgBankSize = 0x4000
+
+// ReadNL reads the symbols of an FCEUX .nl file, lines like
+//
+//	$C000#Reset#Entry point
+//	$0300/10#buffer#16 bytes
+//	\continued comment
+//
+// bank is the 16KB PRG bank of the file, or -1 for the RAM file.
+func (t *Table) ReadNL(r io.Reader, bank int) error {
+	var last *Symbol // Symbol a continued comment belongs to
+	flush := func() {
+		if last != nil && last.Name != "" {
+			t.addSymbol(*last)
+		}
+		last = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case strings.TrimSpace(text) == "":
+			continue
+		case strings.HasPrefix(text, `\`):
+			if last != nil {
+				last.Comment += "\n" + text[1:]
+			}
+			continue
+		case !strings.HasPrefix(text, "$"):
+			return fmt.Errorf("line %d: expected $address#name#comment, got %q", n, text)
+		}
+		flush()
+
+		fields := strings.SplitN(text[1:], "#", 3)
+		where, size, hasSize := strings.Cut(fields[0], "/")
+		addr, err := strconv.ParseUint(where, 16, 16)
+		if err != nil {
+			return fmt.Errorf("line %d: bad address %q", n, where)
+		}
+		s := Symbol{Addr: uint16(addr), Size: 1, PRG: -1}
+		if hasSize {
+			n64, err := strconv.ParseUint(size, 16, 16)
+			if err != nil {
+				return fmt.Errorf("line %d: bad size %q", n, size)
+			}
+			s.Size = int(n64)
+		}
+		if len(fields) > 1 {
+			s.Name = strings.TrimSpace(fields[1])
+		}
+		if len(fields) > 2 {
+			s.Comment = strings.TrimSpace(fields[2])
+		}
+		if bank >= 0 && addr >= 0x8000 {
+			s.PRG = bank*prgBankSize + int(addr)%prgBankSize
+		}
+		last = &s
+	}
+	flush()
+	return scanner.Err()
+}
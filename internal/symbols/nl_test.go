@@ -0,0 +1,103 @@
+package symbols
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadNL(t *testing.T) {
+	table := New()
+	ram := "$0000#temp#\n$0300/10#buffer#Object\n\\slots\n$0400##Comment only\n"
+	if err := table.ReadNL(strings.NewReader(ram), -1); err != nil {
+		t.Fatal(err)
+	}
+	s, ok := table.Lookup("buffer")
+	if !ok || s.Addr != 0x0300 || s.Size != 16 || s.PRG != -1 || s.Comment != "Object\nslots" {
+		t.Errorf("unexpected buffer %+v", s)
+	}
+	if got := table.Label(0x030F); got != "buffer+15" {
+		t.Errorf("expected buffer+15, got %q", got)
+	}
+	if got := table.Label(0x0400); got != "" {
+		t.Errorf("expected no label for a comment, got %q", got)
+	}
+
+	if err := table.ReadNL(strings.NewReader("C000#oops#\n"), 0); err == nil {
+		t.Errorf("expected an error without $")
+	}
+}
+
+// Two banks switched in at $8000, as a mapper would
+func TestBanks(t *testing.T) {
+	table := New()
+	if err := table.ReadNL(strings.NewReader("$8000#Bank0Start#\n$8010#InBank0#\n"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.ReadNL(strings.NewReader("$8000#Bank1Start#\n$8000#Bank1Alias#\n"), 1); err != nil {
+		t.Fatal(err)
+	}
+	bank := 0
+	table.PRGOffset = func(addr uint16) int {
+		if addr < 0x8000 || addr >= 0xC000 {
+			return -1
+		}
+		return bank*prgBankSize + int(addr-0x8000)
+	}
+
+	if got := table.Label(0x8000); got != "Bank0Start" {
+		t.Errorf("bank 0: expected Bank0Start, got %q", got)
+	}
+	if s, _ := table.Nearest(0x8020); s.Name != "InBank0" {
+		t.Errorf("bank 0: expected $8020 in InBank0, got %q", s.Name)
+	}
+
+	bank = 1
+	if got := table.Label(0x8000); got != "Bank1Start" {
+		t.Errorf("bank 1: expected Bank1Start, got %q", got)
+	}
+	if got := table.Label(0x8010); got != "" {
+		t.Errorf("bank 1: expected no label at $8010, got %q", got)
+	}
+	if s, _ := table.Nearest(0x8020); s.Name != "Bank1Start" {
+		t.Errorf("bank 1: expected $8020 in Bank1Start, got %q", s.Name)
+	}
+	if s, ok := table.Lookup("InBank0"); !ok || s.PRG != 0x10 {
+		t.Errorf("expected labels of unmapped banks to be found by name, got %+v", s)
+	}
+}
+
+func TestLoadFor(t *testing.T) {
+	dir := t.TempDir()
+	rom := filepath.Join(dir, "game [!].nes")
+	for name, text := range map[string]string{
+		"game [!].dbg":        testDbg,
+		"game [!].nes.ram.nl": "$0010#lives#\n",
+		"game [!].nes.1.nl":   "$C000#NMI#\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	table, err := LoadFor(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Reset", "lives", "NMI"} {
+		if _, ok := table.Lookup(name); !ok {
+			t.Errorf("expected %s to be loaded", name)
+		}
+	}
+	if s, _ := table.Lookup("NMI"); s.PRG != 0x4000 {
+		t.Errorf("expected NMI at PRG offset $4000, got $%X", s.PRG)
+	}
+	if l, _ := table.LineAt(0x8000); l.File != filepath.Join(dir, "src/main.s") {
+		t.Errorf("expected the source path relative to the debug file, got %q", l.File)
+	}
+
+	if table, err := LoadFor(filepath.Join(dir, "other.nes")); table != nil || err != nil {
+		t.Errorf("expected no symbols for another ROM, got %v %v", table, err)
+	}
+}
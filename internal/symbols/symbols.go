@@ -0,0 +1,358 @@
+// Package symbols reads the debug information of assemblers and emulators,
+// so debuggers can show labels and source lines instead of bare addresses:
+// the ld65 debug file (ld65 --dbgfile) and the FCEUX .nl files.
+package symbols
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Symbol is a named address: a label of the program or a variable
+type Symbol struct {
+	Name string
+	Addr uint16 // CPU address
+	Size int    // Bytes, more than 1 for arrays
+	// PRG is the offset in PRG ROM of labels in ROM, -1 for the others.
+	// A label with one resolves only while its bank is mapped.
+	PRG     int
+	Comment string
+}
+
+// Line is a source line that assembled to code or data at Addr
+type Line struct {
+	File string
+	Line int
+	Addr uint16
+	PRG  int // Offset in PRG ROM, -1 if unknown
+	size int // Bytes of the span, the smallest wins when spans overlap
+}
+
+// Table maps addresses to labels and source lines and back.
+// Set PRGOffset to make the lookups bank-aware.
+type Table struct {
+	// PRGOffset returns the PRG ROM offset the CPU reads at an address, -1
+	// outside ROM, e.g. Cartridge.PRGOffset. Without it symbols and lines
+	// resolve by their address alone, whatever bank is mapped.
+	PRGOffset func(addr uint16) int
+
+	lines       []Line // Sorted by file, line and address
+	linesByAddr map[uint16]Line
+	linesByPRG  map[int]Line
+
+	symbols   []Symbol
+	byAddr    map[uint16]int // Indexes in symbols
+	byPRG     map[int]int
+	byName    map[string][]int
+	arrays    []int // Symbols of more than a byte
+	byAddress []int // All symbols sorted by address, built when needed
+}
+
+// New returns an empty table
+func New() *Table {
+	return &Table{
+		linesByAddr: map[uint16]Line{},
+		linesByPRG:  map[int]Line{},
+		byAddr:      map[uint16]int{},
+		byPRG:       map[int]int{},
+		byName:      map[string][]int{},
+	}
+}
+
+// LoadFor loads the symbols that come with a ROM: the ld65 debug file with
+// the name of the ROM and the .dbg extension, and the FCEUX files
+// ROM.ram.nl and ROM.N.nl for the PRG banks N. It returns nil if there
+// are none.
+func LoadFor(romPath string) (*Table, error) {
+	t := New()
+	found := false
+	if dbg := strings.TrimSuffix(romPath, filepath.Ext(romPath)) + ".dbg"; fileExists(dbg) {
+		if err := t.LoadDbg(dbg); err != nil {
+			return nil, err
+		}
+		found = true
+	}
+	nl, err := filepath.Glob(globEscape(romPath) + ".*.nl")
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range nl {
+		if err := t.LoadNL(path); err != nil {
+			return nil, err
+		}
+		found = true
+	}
+	if !found {
+		return nil, nil
+	}
+	return t, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// globEscape quotes the characters of a path Glob treats as patterns
+func globEscape(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// LoadNL reads an FCEUX symbol file. The bank comes from the name:
+// game.nes.ram.nl for RAM, game.nes.N.nl for the 16KB PRG bank N in hex.
+func (t *Table) LoadNL(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	bank := -1
+	if ext := filepath.Ext(strings.TrimSuffix(path, ".nl")); ext != ".ram" {
+		n, err := strconv.ParseUint(strings.TrimPrefix(ext, "."), 16, 16)
+		if err != nil {
+			return fmt.Errorf("%s: no bank number in the name", path)
+		}
+		bank = int(n)
+	}
+	if err := t.ReadNL(f, bank); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func (t *Table) addLine(l Line) {
+	t.lines = append(t.lines, l)
+	for i := 0; i < l.size; i++ {
+		addr := l.Addr + uint16(i)
+		// A macro call or .proc covers the lines inside it, keep the innermost
+		if old, ok := t.linesByAddr[addr]; !ok || l.size < old.size {
+			t.linesByAddr[addr] = l
+		}
+		if l.PRG >= 0 {
+			if old, ok := t.linesByPRG[l.PRG+i]; !ok || l.size < old.size {
+				t.linesByPRG[l.PRG+i] = l
+			}
+		}
+	}
+}
+
+func (t *Table) sortLines() {
+	sort.Slice(t.lines, func(i, j int) bool {
+		a, b := t.lines[i], t.lines[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Addr < b.Addr
+	})
+}
+
+// better tells whether a symbol should name its address instead of old:
+// the first one loaded does, unless it is a cheap local label like @loop
+func better(s, old Symbol) bool {
+	return strings.HasPrefix(old.Name, "@") && !strings.HasPrefix(s.Name, "@")
+}
+
+func (t *Table) addSymbol(s Symbol) {
+	if s.Size < 1 {
+		s.Size = 1
+	}
+	i := len(t.symbols)
+	t.symbols = append(t.symbols, s)
+	t.byName[s.Name] = append(t.byName[s.Name], i)
+	t.byAddress = nil
+
+	if old, ok := t.byAddr[s.Addr]; !ok || better(s, t.symbols[old]) {
+		t.byAddr[s.Addr] = i
+	}
+	if s.PRG >= 0 {
+		if old, ok := t.byPRG[s.PRG]; !ok || better(s, t.symbols[old]) {
+			t.byPRG[s.PRG] = i
+		}
+	}
+	if s.Size > 1 {
+		t.arrays = append(t.arrays, i)
+	}
+}
+
+// prg returns the PRG offset of addr, -1 outside ROM or without PRGOffset
+func (t *Table) prg(addr uint16) int {
+	if t.PRGOffset == nil {
+		return -1
+	}
+	return t.PRGOffset(addr)
+}
+
+// resolve finds what is at addr: by PRG offset in mapped ROM, otherwise by
+// address, skipping the ROM entries of banks that are not mapped
+func resolve[T any](t *Table, addr uint16, byPRG map[int]T, byAddr map[uint16]T, prgOf func(T) int) (T, bool) {
+	if offset := t.prg(addr); offset >= 0 {
+		if v, ok := byPRG[offset]; ok {
+			return v, true
+		}
+	}
+	v, ok := byAddr[addr]
+	if ok && prgOf(v) >= 0 && t.prg(addr) >= 0 {
+		// Found in another bank
+		var zero T
+		return zero, false
+	}
+	return v, ok
+}
+
+// mapped tells whether a symbol is at its address in the current banks
+func (t *Table) mapped(s Symbol) bool {
+	offset := t.prg(s.Addr)
+	return s.PRG < 0 || offset < 0 || offset == s.PRG
+}
+
+// Symbol returns the symbol at addr
+func (t *Table) Symbol(addr uint16) (Symbol, bool) {
+	i, ok := resolve(t, addr, t.byPRG, t.byAddr, func(i int) int { return t.symbols[i].PRG })
+	if !ok {
+		return Symbol{}, false
+	}
+	return t.symbols[i], true
+}
+
+// Label names addr: the symbol there, or an array it is in like
+// "buffer+3". It returns "" for addresses without a name.
+func (t *Table) Label(addr uint16) string {
+	if s, ok := t.Symbol(addr); ok {
+		return s.Name
+	}
+	for _, i := range t.arrays {
+		s := t.symbols[i]
+		if addr > s.Addr && int(addr-s.Addr) < s.Size && t.mapped(s) {
+			return fmt.Sprintf("%s+%d", s.Name, addr-s.Addr)
+		}
+	}
+	return ""
+}
+
+// Nearest returns the closest label at or before addr in the same half of
+// the address space, ROM or not: the routine code at addr belongs to
+func (t *Table) Nearest(addr uint16) (Symbol, bool) {
+	if t.byAddress == nil {
+		t.byAddress = make([]int, len(t.symbols))
+		for i := range t.byAddress {
+			t.byAddress[i] = i
+		}
+		sort.SliceStable(t.byAddress, func(a, b int) bool {
+			return t.symbols[t.byAddress[a]].Addr < t.symbols[t.byAddress[b]].Addr
+		})
+	}
+	n := sort.Search(len(t.byAddress), func(i int) bool { return t.symbols[t.byAddress[i]].Addr > addr })
+	for i := n - 1; i >= 0; i-- {
+		s := t.symbols[t.byAddress[i]]
+		if s.Addr >= 0x8000 != (addr >= 0x8000) {
+			break
+		}
+		if t.mapped(s) && !strings.HasPrefix(s.Name, "@") {
+			// The name Label gives among those at the address
+			if named, ok := t.Symbol(s.Addr); ok {
+				return named, true
+			}
+			return s, true
+		}
+	}
+	return Symbol{}, false
+}
+
+// Lookup finds a symbol by name. Of labels with the same name in several
+// banks, a mapped one wins.
+func (t *Table) Lookup(name string) (Symbol, bool) {
+	indexes := t.byName[name]
+	for _, i := range indexes {
+		if t.mapped(t.symbols[i]) {
+			return t.symbols[i], true
+		}
+	}
+	if len(indexes) > 0 {
+		return t.symbols[indexes[0]], true
+	}
+	return Symbol{}, false
+}
+
+// LineAt returns the source line of the byte at addr
+func (t *Table) LineAt(addr uint16) (Line, bool) {
+	return resolve(t, addr, t.linesByPRG, t.linesByAddr, func(l Line) int { return l.PRG })
+}
+
+// Files returns the source files with code, sorted
+func (t *Table) Files() []string {
+	var files []string
+	for _, l := range t.lines {
+		if len(files) == 0 || files[len(files)-1] != l.File {
+			files = append(files, l.File)
+		}
+	}
+	return files
+}
+
+// Find returns the first line with code at or after line in file, and the
+// addresses it starts at: a line of a macro used twice has two, and so do
+// lines of banks assembled at the same address. The file is matched by its
+// path or, for paths from another directory, its longest common suffix.
+func (t *Table) Find(file string, line int) (Line, []uint16, bool) {
+	file = t.matchFile(file)
+	if file == "" {
+		return Line{}, nil, false
+	}
+	i := sort.Search(len(t.lines), func(i int) bool {
+		l := t.lines[i]
+		return l.File > file || l.File == file && l.Line >= line
+	})
+	if i == len(t.lines) || t.lines[i].File != file {
+		return Line{}, nil, false
+	}
+	found := t.lines[i]
+	var addrs []uint16
+	for ; i < len(t.lines) && t.lines[i].File == file && t.lines[i].Line == found.Line; i++ {
+		if n := len(addrs); n == 0 || addrs[n-1] != t.lines[i].Addr {
+			addrs = append(addrs, t.lines[i].Addr)
+		}
+	}
+	return found, addrs, true
+}
+
+// matchFile finds the name the table uses for a source path
+func (t *Table) matchFile(path string) string {
+	path = filepath.ToSlash(filepath.Clean(path))
+	best, bestLen := "", 0
+	for _, f := range t.Files() {
+		name := filepath.ToSlash(f)
+		if name == path {
+			return f
+		}
+		if n := commonSuffix(name, path); n > bestLen {
+			best, bestLen = f, n
+		}
+	}
+	return best
+}
+
+// commonSuffix counts the path elements two paths end with, 0 unless the
+// file names are equal
+func commonSuffix(a, b string) int {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	n := 0
+	for n < len(as) && n < len(bs) && as[len(as)-1-n] == bs[len(bs)-1-n] {
+		n++
+	}
+	return n
+}
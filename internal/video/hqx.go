@@ -0,0 +1,275 @@
+package video
+
+import (
+	"image"
+	"image/color"
+)
+
+// hqx is Maxim Stepin's hqNx. Every pixel is compared with its 8 neighbours
+// by the YUV thresholds of hqx, which gives an 8-bit pattern, and a rule per
+// pattern says how each corner of the enlarged pixel is interpolated from
+// the centre and the neighbours of that corner.
+//
+// hqxRules is the compact form of the 256 cases of hq2x written for bsnes:
+// the rules of the top-left corner, the other corners rotate the pattern.
+// hq3x and hq4x apply the same corner rules to the larger blocks, fading
+// them towards the centre, instead of the separate hand-written case lists
+// of hq3x and hq4x, so these two differ from the reference on some patterns.
+type hqx struct {
+	factor int
+	// The corners that shape every sub-pixel of a block, row by row
+	subPixels [][]hqxPart
+}
+
+// hqxPart is the share of a corner rule in a sub-pixel: the rule weights of
+// the diagonal neighbour A and of B and D, the neighbours above and to the
+// left in the rotated kernel, are multiplied by a, b and d in eighths
+type hqxPart struct {
+	corner  int
+	a, b, d int
+}
+
+// Corners in the order of the kernel rotations
+const (
+	hqxTopLeft = iota
+	hqxTopRight
+	hqxBottomRight
+	hqxBottomLeft
+)
+
+// hqxRules holds the rule of the top-left corner for every pattern. Bits 0-7
+// of the pattern are set for the neighbours A, B, C, D, F, G, H and I that
+// differ from the centre E:
+//
+//	A B C
+//	D E F
+//	G H I
+var hqxRules = [256]byte{
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 15, 12, 5, 3, 17, 13,
+	4, 4, 6, 18, 4, 4, 6, 18, 5, 3, 12, 12, 5, 3, 1, 12,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 17, 13, 5, 3, 16, 14,
+	4, 4, 6, 18, 4, 4, 6, 18, 5, 3, 16, 12, 5, 3, 1, 14,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 19, 12, 12, 5, 19, 16, 12,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 16, 12, 5, 3, 16, 12,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 19, 1, 12, 5, 19, 1, 14,
+	4, 4, 6, 2, 4, 4, 6, 18, 5, 3, 16, 12, 5, 19, 1, 14,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 15, 12, 5, 3, 17, 13,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 16, 12, 5, 3, 16, 12,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 17, 13, 5, 3, 16, 14,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 16, 13, 5, 3, 1, 14,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 16, 12, 5, 3, 16, 13,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 16, 12, 5, 3, 1, 12,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 16, 12, 5, 3, 1, 14,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 1, 12, 5, 3, 1, 14,
+}
+
+// hqxWeights returns the weights in 16ths of A, B and D in a corner rule,
+// E has the rest. same tells whether B and D are alike.
+func hqxWeights(rule byte, same bool) (a, b, d int) {
+	switch rule {
+	case 1:
+		return 4, 0, 0 // 3:1 with A
+	case 2:
+		return 0, 0, 4 // 3:1 with D
+	case 3:
+		return 0, 4, 0 // 3:1 with B
+	case 4:
+		return 0, 4, 4 // 2:1:1 with D and B
+	case 5:
+		return 4, 4, 0 // 2:1:1 with A and B
+	case 6:
+		return 4, 0, 4 // 2:1:1 with A and D
+	case 12:
+		if same {
+			return 0, 4, 4
+		}
+	case 13:
+		if same {
+			return 0, 6, 6 // 2:3:3 with D and B
+		}
+	case 14:
+		if same {
+			return 0, 1, 1 // 14:1:1 with D and B
+		}
+	case 15:
+		if same {
+			return 0, 4, 4
+		}
+		return 4, 0, 0
+	case 16:
+		if same {
+			return 0, 2, 2 // 6:1:1 with D and B
+		}
+		return 4, 0, 0
+	case 17:
+		if same {
+			return 0, 4, 2 // 5:2:1 with B and D
+		}
+		return 4, 0, 0
+	case 18:
+		if same {
+			return 0, 2, 4 // 5:2:1 with D and B
+		}
+		return 0, 0, 4
+	case 19:
+		if same {
+			return 0, 4, 2
+		}
+		return 0, 4, 0
+	}
+	return 0, 0, 0
+}
+
+// hqxRotate turns a pattern so the top-right corner becomes the top-left one
+func hqxRotate(p byte) byte {
+	return (p>>2)&0x11 | (p<<2)&0x88 | (p&0x01)<<5 | (p&0x08)<<3 | (p&0x10)>>3 | (p&0x80)>>5
+}
+
+func newHQX(factor int) *hqx {
+	s := &hqx{factor: factor}
+	// Distance of a sub-pixel row or column from the centre of the block,
+	// as the share of the corner rule it gets in halves: 2 on the outer
+	// sub-pixels and 1 on the inner ones of hq4x, 0 on the middle of hq3x
+	share := func(i int) (int, int) {
+		d := 2*i + 1 - factor
+		sign := 0
+		if d < 0 {
+			sign, d = -1, -d
+		} else if d > 0 {
+			sign = 1
+		}
+		return sign, min(2, 4*d/factor)
+	}
+	corner := func(sx, sy int) int {
+		switch {
+		case sx < 0 && sy < 0:
+			return hqxTopLeft
+		case sx > 0 && sy < 0:
+			return hqxTopRight
+		case sx > 0:
+			return hqxBottomRight
+		}
+		return hqxBottomLeft
+	}
+
+	for j := 0; j < factor; j++ {
+		sy, gy := share(j)
+		for i := 0; i < factor; i++ {
+			sx, gx := share(i)
+			var parts []hqxPart
+			add := func(c, weight int) {
+				// B is above the centre for the top-left corner, and to the
+				// right of it for the top-right one
+				b, d := gy, gx
+				if c == hqxTopRight || c == hqxBottomLeft {
+					b, d = gx, gy
+				}
+				parts = append(parts, hqxPart{corner: c, a: gx * gy * weight, b: 2 * b * weight, d: 2 * d * weight})
+			}
+			switch {
+			case sx == 0 && sy == 0:
+				// The centre of hq3x keeps E
+			case sx == 0:
+				// The middle of an edge, between two corners
+				add(corner(-1, sy), 1)
+				add(corner(1, sy), 1)
+			case sy == 0:
+				add(corner(sx, -1), 1)
+				add(corner(sx, 1), 1)
+			default:
+				add(corner(sx, sy), 2)
+			}
+			s.subPixels = append(s.subPixels, parts)
+		}
+	}
+	return s
+}
+
+func (s *hqx) Factor() int { return s.factor }
+
+// yuvDiff reports whether two colours differ by the YUV thresholds of hqx
+func yuvDiff(a, b color.RGBA) bool {
+	if a == b {
+		return false
+	}
+	ya, ua, va := yuv(a)
+	yb, ub, vb := yuv(b)
+	return abs(ya-yb) > 0x30 || abs(ua-ub) > 0x07 || abs(va-vb) > 0x06
+}
+
+func yuv(c color.RGBA) (int, int, int) {
+	r, g, b := int(c.R), int(c.G), int(c.B)
+	y := (r + g + b) >> 2
+	u := 128 + ((r - b) >> 2)
+	v := 128 + ((2*g - r - b) >> 3)
+	return y, u, v
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func (s *hqx) Scale(dst, src *image.RGBA) {
+	n := s.factor
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var k [9]color.RGBA // A B C D E F G H I
+			for i := range k {
+				k[i] = pixelClamped(src, x+i%3-1, y+i/3-1)
+			}
+			e := k[4]
+			var pattern byte
+			for bit, i := range [8]int{0, 1, 2, 3, 5, 6, 7, 8} {
+				if yuvDiff(e, k[i]) {
+					pattern |= 1 << bit
+				}
+			}
+
+			// A, B and D of each corner, turning the kernel clockwise
+			var weights [4][3]int
+			var neighbours [4][3]color.RGBA
+			for c, abd := range [4][3]int{{0, 1, 3}, {2, 5, 1}, {8, 7, 5}, {6, 3, 7}} {
+				a, b, d := k[abd[0]], k[abd[1]], k[abd[2]]
+				wa, wb, wd := hqxWeights(hqxRules[pattern], !yuvDiff(b, d))
+				weights[c] = [3]int{wa, wb, wd}
+				neighbours[c] = [3]color.RGBA{a, b, d}
+				pattern = hqxRotate(pattern)
+			}
+
+			for j := 0; j < n; j++ {
+				for i := 0; i < n; i++ {
+					setPixel(dst, x*n+i, y*n+j, s.subPixel(e, s.subPixels[j*n+i], &weights, &neighbours))
+				}
+			}
+		}
+	}
+}
+
+// subPixel mixes e with the neighbours by the shares of the corner rules.
+// The weights are in 16ths and the shares in eighths.
+func (s *hqx) subPixel(e color.RGBA, parts []hqxPart, weights *[4][3]int, neighbours *[4][3]color.RGBA) color.RGBA {
+	if len(parts) == 0 {
+		return e
+	}
+	const total = 16 * 8
+	var r, g, b, we int
+	for _, p := range parts {
+		for i, share := range [3]int{p.a, p.b, p.d} {
+			w := weights[p.corner][i] * share
+			c := neighbours[p.corner][i]
+			r += w * int(c.R)
+			g += w * int(c.G)
+			b += w * int(c.B)
+			we += w
+		}
+	}
+	we = total - we
+	r += we * int(e.R)
+	g += we * int(e.G)
+	b += we * int(e.B)
+	return color.RGBA{uint8(r / total), uint8(g / total), uint8(b / total), e.A}
+}
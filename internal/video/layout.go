@@ -0,0 +1,84 @@
+package video
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+
+	"github.com/sergey121/nes-emulator/internal/ppu"
+)
+
+// Overscan is the number of NES pixels hidden on each side of the picture.
+// TVs did not show the edges, and many games leave garbage there.
+type Overscan struct {
+	Top, Bottom, Left, Right int
+}
+
+// NTSCPixelAspect is the width of an NES pixel relative to its height on an NTSC TV
+const NTSCPixelAspect = 8.0 / 7
+
+// ParseOverscan reads "top,bottom,left,right", or a single number for all sides
+func ParseOverscan(s string) (Overscan, error) {
+	var o Overscan
+	if n, err := strconv.Atoi(s); err == nil {
+		o = Overscan{n, n, n, n}
+	} else if _, err := fmt.Sscanf(s, "%d,%d,%d,%d", &o.Top, &o.Bottom, &o.Left, &o.Right); err != nil {
+		return Overscan{}, fmt.Errorf("invalid overscan %q, expected top,bottom,left,right", s)
+	}
+	return o, o.Validate()
+}
+
+// Validate checks that the crop leaves something to show
+func (o Overscan) Validate() error {
+	if o.Top < 0 || o.Bottom < 0 || o.Left < 0 || o.Right < 0 ||
+		o.Top+o.Bottom >= ppu.ScreenHeight || o.Left+o.Right >= ppu.ScreenWidth {
+		return fmt.Errorf("invalid overscan %+v", o)
+	}
+	return nil
+}
+
+// Size returns the number of visible NES pixels
+func (o Overscan) Size() (int, int) {
+	return ppu.ScreenWidth - o.Left - o.Right, ppu.ScreenHeight - o.Top - o.Bottom
+}
+
+// Crop returns the visible part of a picture of the given size made from a
+// full frame. The picture may be scaled, also by different factors
+// horizontally and vertically like the NTSC filter output.
+func (o Overscan) Crop(picture image.Rectangle) image.Rectangle {
+	w, h := picture.Dx(), picture.Dy()
+	return image.Rect(
+		o.Left*w/ppu.ScreenWidth,
+		o.Top*h/ppu.ScreenHeight,
+		w-o.Right*w/ppu.ScreenWidth,
+		h-o.Bottom*h/ppu.ScreenHeight,
+	).Add(picture.Min)
+}
+
+// Viewport is where the picture is drawn in a window
+type Viewport struct {
+	X, Y          float64 // Top-left corner
+	Width, Height float64
+}
+
+// FitViewport centres a picture of width x height NES pixels in a window,
+// keeping the pixel aspect ratio and leaving black bars around it.
+// With integer set every NES pixel is a whole number of window pixels high,
+// so scanlines and scaler output stay even.
+func FitViewport(width, height, windowW, windowH int, pixelAspect float64, integer bool) Viewport {
+	pixelW := float64(width) * pixelAspect
+	scale := math.Min(float64(windowW)/pixelW, float64(windowH)/float64(height))
+	if integer && scale >= 1 {
+		scale = math.Floor(scale)
+	}
+
+	w := pixelW * scale
+	h := float64(height) * scale
+	return Viewport{
+		X:      math.Floor((float64(windowW) - w) / 2),
+		Y:      math.Floor((float64(windowH) - h) / 2),
+		Width:  w,
+		Height: h,
+	}
+}
@@ -0,0 +1,196 @@
+package video
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/sergey121/nes-emulator/internal/ppu"
+)
+
+// NTSCWidth is the width of the image produced by the NTSC filter
+const NTSCWidth = 602
+
+const (
+	phasesPerDot  = 8
+	samplesPerRow = ppu.ScreenWidth * phasesPerDot
+	// 341 dots of 8 phases: each scanline starts 4 phases (a third of a colour cycle) later
+	phaseShiftPerLine = 341 * phasesPerDot % 12
+)
+
+// NTSCSettings controls how the composite signal is decoded
+type NTSCSettings struct {
+	Hue        float64 // Degrees added to every colour
+	Saturation float64 // 1 is normal, 0 is monochrome
+	Contrast   float64 // 1 is normal
+	Brightness float64 // Added to luma, 0 is normal
+	Sharpness  float64 // -1 (soft) to 1 (sharp)
+	Artifacts  float64 // 0-1: luma detail decoded as colour (rainbows, dot crawl)
+	Fringing   float64 // 0-1: colour edges leaking into luma
+	Bleed      float64 // 0-1: horizontal colour blur
+}
+
+// NTSC filter presets
+var (
+	NTSCComposite = NTSCSettings{Saturation: 1, Contrast: 1, Artifacts: 1, Fringing: 1, Bleed: 0.5}
+	NTSCSVideo    = NTSCSettings{Saturation: 1, Contrast: 1, Sharpness: 0.2, Bleed: 0.5}
+	NTSCRGB       = NTSCSettings{Saturation: 1, Contrast: 1, Sharpness: 0.2}
+	NTSCMono      = NTSCSettings{Contrast: 1, Artifacts: 1, Fringing: 1}
+)
+
+// NTSCPresets maps preset names to settings
+var NTSCPresets = map[string]NTSCSettings{
+	"composite": NTSCComposite,
+	"svideo":    NTSCSVideo,
+	"rgb":       NTSCRGB,
+	"mono":      NTSCMono,
+}
+
+// NTSCPresetNames lists the presets in the order the frontend cycles them
+var NTSCPresetNames = []string{"composite", "svideo", "rgb", "mono"}
+
+// FindNTSCPreset returns the settings of a preset by name
+func FindNTSCPreset(name string) (NTSCSettings, error) {
+	s, ok := NTSCPresets[name]
+	if !ok {
+		return NTSCSettings{}, fmt.Errorf("unknown NTSC preset: %q", name)
+	}
+	return s, nil
+}
+
+// NTSC synthesises the composite signal of a frame dot by dot and decodes it
+// like a TV would. It runs on the CPU and does not need a display.
+type NTSC struct {
+	settings NTSCSettings
+
+	// Signal level and luma of every 9-bit pixel at every subcarrier phase
+	levels [512][12]float32
+	luma   [512]float32
+	// Demodulation carrier for U and V at every phase
+	cos, sin [12]float32
+
+	// Prefix sums of one scanline: composite signal, luma and demodulated U/V
+	sumSignal, sumLuma, sumU, sumV [samplesPerRow + 1]float32
+}
+
+// NewNTSC creates a filter with the given settings
+func NewNTSC(settings NTSCSettings) *NTSC {
+	f := &NTSC{settings: settings}
+	for pixel := range f.levels {
+		var sum float32
+		for phase := range f.levels[pixel] {
+			f.levels[pixel][phase] = float32(ppu.SignalLevel(uint16(pixel), phase))
+			sum += f.levels[pixel][phase]
+		}
+		f.luma[pixel] = sum / 12
+	}
+	hue := settings.Hue * math.Pi / 180
+	for p := range f.cos {
+		angle := 2*math.Pi*float64(p)/12 + hue
+		f.cos[p] = float32(2 * math.Cos(angle))
+		f.sin[p] = float32(-2 * math.Sin(angle))
+	}
+	return f
+}
+
+// NTSCFramePhase returns the subcarrier phase at the start of a frame.
+// With rendering enabled odd frames are one dot shorter, so the phase
+// alternates between two values and the artifacts crawl back and forth.
+func NTSCFramePhase(frameCount int) int {
+	return frameCount & 1 * 4
+}
+
+// NewNTSCImage allocates an image for the filter output
+func NewNTSCImage() *image.RGBA {
+	return image.NewRGBA(image.Rect(0, 0, NTSCWidth, ppu.ScreenHeight))
+}
+
+// Filter decodes frame into dst, which must be NTSCWidth x ScreenHeight.
+// phase is the subcarrier phase of the first dot, see NTSCFramePhase.
+func (f *NTSC) Filter(dst *image.RGBA, frame *ppu.Frame, phase int) {
+	for y := range frame {
+		f.encodeLine(&frame[y], (phase+y*phaseShiftPerLine)%12)
+		f.decodeLine(dst.Pix[y*dst.Stride:])
+	}
+}
+
+// encodeLine builds the prefix sums of the signal of one scanline
+func (f *NTSC) encodeLine(line *[ppu.ScreenWidth]uint16, phase int) {
+	artifacts := float32(f.settings.Artifacts)
+
+	// Luma detail is the difference between the dot luma and its average over a colour cycle,
+	// so the sums of luma are needed before the chroma
+	for n := 0; n < samplesPerRow; n++ {
+		f.sumLuma[n+1] = f.sumLuma[n] + f.luma[line[n/phasesPerDot]&0x1FF]
+	}
+
+	p := phase
+	for n := 0; n < samplesPerRow; n++ {
+		pixel := line[n/phasesPerDot] & 0x1FF
+		signal := f.levels[pixel][p]
+		f.sumSignal[n+1] = f.sumSignal[n] + signal
+
+		// A composite decoder can not tell luma detail from colour
+		chroma := signal - f.luma[pixel]
+		chroma += artifacts * (f.luma[pixel] - box(&f.sumLuma, n, 12))
+
+		f.sumU[n+1] = f.sumU[n] + chroma*f.cos[p]
+		f.sumV[n+1] = f.sumV[n] + chroma*f.sin[p]
+
+		if p++; p == 12 {
+			p = 0
+		}
+	}
+}
+
+// decodeLine converts the signal sums to RGBA pixels
+func (f *NTSC) decodeLine(dst []byte) {
+	s := &f.settings
+	chromaWidth := 12 + int(math.Max(0, s.Bleed)*24)
+	fringing := float32(s.Fringing)
+
+	for x := 0; x < NTSCWidth; x++ {
+		n := (2*x + 1) * samplesPerRow / (2 * NTSCWidth)
+
+		// Averaging over a colour cycle removes the chroma, except at edges (fringing)
+		luma := box(&f.sumLuma, n, 12)*(1-fringing) + box(&f.sumSignal, n, 12)*fringing
+		wide := box(&f.sumLuma, n, 24)*(1-fringing) + box(&f.sumSignal, n, 24)*fringing
+		yv := float64(luma + float32(s.Sharpness)*(luma-wide))
+
+		u := float64(box(&f.sumU, n, chromaWidth))
+		v := float64(box(&f.sumV, n, chromaWidth))
+
+		yv = yv*s.Contrast + s.Brightness
+		u *= s.Saturation * s.Contrast
+		v *= s.Saturation * s.Contrast
+
+		i := x * 4
+		dst[i] = clampByte(yv + 1.140*v)
+		dst[i+1] = clampByte(yv - 0.395*u - 0.581*v)
+		dst[i+2] = clampByte(yv + 2.032*u)
+		dst[i+3] = 0xFF
+	}
+}
+
+// box averages width samples centred on n using prefix sums
+func box(sums *[samplesPerRow + 1]float32, n, width int) float32 {
+	lo := n - width/2
+	hi := lo + width
+	if lo < 0 {
+		lo = 0
+	}
+	if hi > samplesPerRow {
+		hi = samplesPerRow
+	}
+	return (sums[hi] - sums[lo]) / float32(hi-lo)
+}
+
+func clampByte(x float64) byte {
+	switch {
+	case x <= 0:
+		return 0
+	case x >= 1:
+		return 0xFF
+	}
+	return byte(x*255 + 0.5)
+}
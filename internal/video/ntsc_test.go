@@ -0,0 +1,91 @@
+package video
+
+import (
+	"testing"
+
+	"github.com/sergey121/nes-emulator/internal/ppu"
+)
+
+func solidFrame(pixel uint16) *ppu.Frame {
+	var frame ppu.Frame
+	for y := range frame {
+		for x := range frame[y] {
+			frame[y][x] = pixel
+		}
+	}
+	return &frame
+}
+
+func TestNTSCSolidColour(t *testing.T) {
+	// A flat colour decodes to the YUV palette whatever the preset
+	yuv, err := ppu.FindPalette("nestopia-yuv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"composite", "svideo", "rgb"} {
+		settings, _ := FindNTSCPreset(name)
+		f := NewNTSC(settings)
+		img := NewNTSCImage()
+
+		for _, pixel := range []uint16{0x16, 0x2A, 0x12, 0x30, 0x0F, 0x21 | 0x40} {
+			f.Filter(img, solidFrame(pixel), 0)
+			got := img.RGBAAt(NTSCWidth/2, 100)
+			want := yuv[pixel]
+			if diff(got.R, want.R) > 3 || diff(got.G, want.G) > 3 || diff(got.B, want.B) > 3 {
+				t.Errorf("%s: pixel $%03X: expected %v, got %v", name, pixel, want, got)
+			}
+		}
+	}
+}
+
+func TestNTSCMonochrome(t *testing.T) {
+	f := NewNTSC(NTSCMono)
+	img := NewNTSCImage()
+	f.Filter(img, solidFrame(0x16), 0)
+
+	c := img.RGBAAt(300, 120)
+	if c.R != c.G || c.G != c.B {
+		t.Errorf("expected grey, got %v", c)
+	}
+}
+
+func TestNTSCArtifacts(t *testing.T) {
+	// Alternating black and white columns produce colour on a composite TV only
+	var frame ppu.Frame
+	for y := range frame {
+		for x := range frame[y] {
+			if x&1 == 0 {
+				frame[y][x] = 0x30
+			} else {
+				frame[y][x] = 0x0F
+			}
+		}
+	}
+
+	colourful := func(settings NTSCSettings) bool {
+		img := NewNTSCImage()
+		NewNTSC(settings).Filter(img, &frame, 0)
+		for x := 100; x < 500; x++ {
+			c := img.RGBAAt(x, 50)
+			if diff(c.R, c.G) > 20 || diff(c.G, c.B) > 20 {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !colourful(NTSCComposite) {
+		t.Errorf("expected colour artifacts with the composite preset")
+	}
+	if colourful(NTSCRGB) {
+		t.Errorf("expected no colour artifacts with the RGB preset")
+	}
+}
+
+func diff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
@@ -0,0 +1,81 @@
+package video
+
+import (
+	"image"
+
+	"github.com/sergey121/nes-emulator/internal/ppu"
+)
+
+// Pipeline turns PPU frames into the final picture: palette conversion or
+// the NTSC filter, then a scaler and the scanline overlay. It has no
+// display dependency, so the frontend and headless exports share it.
+type Pipeline struct {
+	Palette *ppu.Palette // nil means ppu.DefaultPalette
+	// NTSC replaces the palette conversion when set. Its output is wide,
+	// so lines are doubled instead of using the scaler.
+	NTSC   *NTSC
+	Scaler Scaler // nil keeps the native size
+	// Scanlines is the darkness (0-1) of the gaps between lines
+	Scanlines float64
+
+	frame  *image.RGBA
+	ntsc   *image.RGBA
+	output *image.RGBA
+}
+
+// Size returns the size of the images produced by Render
+func (p *Pipeline) Size() (int, int) {
+	if p.NTSC != nil {
+		return NTSCWidth, ppu.ScreenHeight * 2
+	}
+	factor := 1
+	if p.Scaler != nil {
+		factor = p.Scaler.Factor()
+	}
+	return ppu.ScreenWidth * factor, ppu.ScreenHeight * factor
+}
+
+// Render converts a frame. phase is the NTSC subcarrier phase, see NTSCFramePhase.
+// The returned image is reused by the next call.
+func (p *Pipeline) Render(frame *ppu.Frame, phase int) *image.RGBA {
+	w, h := p.Size()
+	if p.output == nil || p.output.Rect.Dx() != w || p.output.Rect.Dy() != h {
+		p.output = image.NewRGBA(image.Rect(0, 0, w, h))
+	}
+
+	if p.NTSC != nil {
+		if p.ntsc == nil {
+			p.ntsc = NewNTSCImage()
+		}
+		p.NTSC.Filter(p.ntsc, frame, phase)
+		doubleLines(p.output, p.ntsc)
+		Scanlines(p.output, 2, p.Scanlines)
+		return p.output
+	}
+
+	palette := p.Palette
+	if palette == nil {
+		palette = &ppu.DefaultPalette
+	}
+	if p.Scaler == nil {
+		palette.ToRGBA(p.output.Pix, frame)
+		return p.output
+	}
+
+	if p.frame == nil {
+		p.frame = image.NewRGBA(image.Rect(0, 0, ppu.ScreenWidth, ppu.ScreenHeight))
+	}
+	palette.ToRGBA(p.frame.Pix, frame)
+	p.Scaler.Scale(p.output, p.frame)
+	Scanlines(p.output, p.Scaler.Factor(), p.Scanlines)
+	return p.output
+}
+
+// doubleLines copies every row of src twice into dst
+func doubleLines(dst, src *image.RGBA) {
+	for y := 0; y < src.Rect.Dy(); y++ {
+		row := src.Pix[y*src.Stride : (y+1)*src.Stride]
+		copy(dst.Pix[2*y*dst.Stride:], row)
+		copy(dst.Pix[(2*y+1)*dst.Stride:], row)
+	}
+}
@@ -0,0 +1,108 @@
+package video
+
+import (
+	"image"
+	"image/color"
+)
+
+// Scale2x and Scale3x (AdvanceMAME) copy a neighbour into the corners of
+// the block when two of them form an edge, without creating new colours.
+// https://www.scale2x.it/algorithm
+
+type scale2x struct{}
+
+func (scale2x) Factor() int { return 2 }
+
+func (scale2x) Scale(dst, src *image.RGBA) {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			//   B
+			// D E F
+			//   H
+			b := pixelClamped(src, x, y-1)
+			d := pixelClamped(src, x-1, y)
+			e := pixelAt(src, x, y)
+			f := pixelClamped(src, x+1, y)
+			hh := pixelClamped(src, x, y+1)
+
+			e0, e1, e2, e3 := e, e, e, e
+			if b != hh && d != f {
+				if d == b {
+					e0 = d
+				}
+				if b == f {
+					e1 = f
+				}
+				if d == hh {
+					e2 = d
+				}
+				if hh == f {
+					e3 = f
+				}
+			}
+			setPixel(dst, x*2, y*2, e0)
+			setPixel(dst, x*2+1, y*2, e1)
+			setPixel(dst, x*2, y*2+1, e2)
+			setPixel(dst, x*2+1, y*2+1, e3)
+		}
+	}
+}
+
+type scale3x struct{}
+
+func (scale3x) Factor() int { return 3 }
+
+func (scale3x) Scale(dst, src *image.RGBA) {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// A B C
+			// D E F
+			// G H I
+			a := pixelClamped(src, x-1, y-1)
+			b := pixelClamped(src, x, y-1)
+			c := pixelClamped(src, x+1, y-1)
+			d := pixelClamped(src, x-1, y)
+			e := pixelAt(src, x, y)
+			f := pixelClamped(src, x+1, y)
+			g := pixelClamped(src, x-1, y+1)
+			hh := pixelClamped(src, x, y+1)
+			i := pixelClamped(src, x+1, y+1)
+
+			var out [9]color.RGBA
+			for n := range out {
+				out[n] = e
+			}
+			if b != hh && d != f {
+				if d == b {
+					out[0] = d
+				}
+				if (d == b && e != c) || (b == f && e != a) {
+					out[1] = b
+				}
+				if b == f {
+					out[2] = f
+				}
+				if (d == b && e != g) || (d == hh && e != a) {
+					out[3] = d
+				}
+				if (b == f && e != i) || (hh == f && e != c) {
+					out[5] = f
+				}
+				if d == hh {
+					out[6] = d
+				}
+				if (d == hh && e != i) || (hh == f && e != g) {
+					out[7] = hh
+				}
+				if hh == f {
+					out[8] = f
+				}
+			}
+			for n, p := range out {
+				setPixel(dst, x*3+n%3, y*3+n/3, p)
+			}
+		}
+	}
+}
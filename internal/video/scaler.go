@@ -0,0 +1,150 @@
+package video
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// Scaler enlarges an image by an integer factor
+type Scaler interface {
+	Factor() int
+	// Scale writes src enlarged by Factor() to dst, which must have the scaled size
+	Scale(dst, src *image.RGBA)
+}
+
+// ScalerNames lists the scalers accepted by NewScaler in the order the frontend cycles them
+var ScalerNames = []string{
+	"none",
+	"nearest2x", "nearest3x", "nearest4x",
+	"bilinear2x", "bilinear3x", "bilinear4x",
+	"scale2x", "scale3x",
+	"hq2x", "hq3x", "hq4x",
+	"xbrz2x", "xbrz3x", "xbrz4x", "xbrz5x", "xbrz6x",
+}
+
+// NewScaler creates a scaler by name: "none", or an algorithm followed by
+// the factor, e.g. "nearest3x", "scale2x", "hq4x", "xbrz6x"
+func NewScaler(name string) (Scaler, error) {
+	if name == "" || name == "none" {
+		return nil, nil
+	}
+
+	var algorithm string
+	var factor int
+	i := strings.IndexAny(name, "23456")
+	if i > 0 && strings.HasSuffix(name, "x") {
+		algorithm = name[:i]
+		fmt.Sscanf(name[i:], "%dx", &factor)
+	}
+
+	switch {
+	case algorithm == "nearest" && factor >= 2 && factor <= 6:
+		return nearest(factor), nil
+	case algorithm == "bilinear" && factor >= 2 && factor <= 6:
+		return bilinear(factor), nil
+	case algorithm == "scale" && factor == 2:
+		return scale2x{}, nil
+	case algorithm == "scale" && factor == 3:
+		return scale3x{}, nil
+	case algorithm == "hq" && factor >= 2 && factor <= 4:
+		return newHQX(factor), nil
+	case algorithm == "xbrz" && factor >= 2 && factor <= 6:
+		return newXBRZ(factor), nil
+	}
+	return nil, fmt.Errorf("unknown scaler: %q", name)
+}
+
+// ScaledImage allocates the destination image of s for src
+func ScaledImage(s Scaler, src image.Rectangle) *image.RGBA {
+	return image.NewRGBA(image.Rect(0, 0, src.Dx()*s.Factor(), src.Dy()*s.Factor()))
+}
+
+// nearest repeats every pixel
+type nearest int
+
+func (n nearest) Factor() int { return int(n) }
+
+func (n nearest) Scale(dst, src *image.RGBA) {
+	f := int(n)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	for y := 0; y < h; y++ {
+		row := dst.Pix[y*f*dst.Stride:]
+		for x := 0; x < w; x++ {
+			p := src.Pix[y*src.Stride+x*4 : y*src.Stride+x*4+4]
+			for i := 0; i < f; i++ {
+				copy(row[(x*f+i)*4:], p)
+			}
+		}
+		// The other rows of the block are copies of the first
+		for i := 1; i < f; i++ {
+			copy(dst.Pix[(y*f+i)*dst.Stride:(y*f+i+1)*dst.Stride], row[:dst.Stride])
+		}
+	}
+}
+
+// bilinear interpolates between the centres of the source pixels
+type bilinear int
+
+func (b bilinear) Factor() int { return int(b) }
+
+func (b bilinear) Scale(dst, src *image.RGBA) {
+	f := int(b)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	for dy := 0; dy < h*f; dy++ {
+		y0, ty := bilinearSource(dy, f, h)
+		for dx := 0; dx < w*f; dx++ {
+			x0, tx := bilinearSource(dx, f, w)
+			x1, y1 := min(x0+1, w-1), min(y0+1, h-1)
+
+			top := mix(pixelAt(src, x0, y0), pixelAt(src, x1, y0), tx)
+			bottom := mix(pixelAt(src, x0, y1), pixelAt(src, x1, y1), tx)
+			setPixel(dst, dx, dy, mix(top, bottom, ty))
+		}
+	}
+}
+
+// bilinearSource returns the source pixel left of (or above) destination
+// coordinate d and the weight of the next one
+func bilinearSource(d, f, size int) (int, float64) {
+	s := (float64(d)+0.5)/float64(f) - 0.5
+	if s < 0 {
+		return 0, 0
+	}
+	i := int(s)
+	if i >= size-1 {
+		return size - 1, 0
+	}
+	return i, s - float64(i)
+}
+
+func pixelAt(img *image.RGBA, x, y int) color.RGBA {
+	i := y*img.Stride + x*4
+	return color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3]}
+}
+
+// pixelClamped returns the pixel at (x, y), repeating the edges outside the image
+func pixelClamped(img *image.RGBA, x, y int) color.RGBA {
+	x = max(0, min(x, img.Rect.Dx()-1))
+	y = max(0, min(y, img.Rect.Dy()-1))
+	return pixelAt(img, x, y)
+}
+
+func setPixel(img *image.RGBA, x, y int, c color.RGBA) {
+	i := y*img.Stride + x*4
+	img.Pix[i] = c.R
+	img.Pix[i+1] = c.G
+	img.Pix[i+2] = c.B
+	img.Pix[i+3] = c.A
+}
+
+// mix blends t of b into a
+func mix(a, b color.RGBA, t float64) color.RGBA {
+	return color.RGBA{
+		uint8(float64(a.R) + (float64(b.R)-float64(a.R))*t + 0.5),
+		uint8(float64(a.G) + (float64(b.G)-float64(a.G))*t + 0.5),
+		uint8(float64(a.B) + (float64(b.B)-float64(a.B))*t + 0.5),
+		uint8(float64(a.A) + (float64(b.A)-float64(a.A))*t + 0.5),
+	}
+}
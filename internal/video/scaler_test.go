@@ -0,0 +1,236 @@
+package video
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/sergey121/nes-emulator/internal/config"
+)
+
+var (
+	black = color.RGBA{0, 0, 0, 255}
+	white = color.RGBA{255, 255, 255, 255}
+)
+
+// diagonalImage has white above the main diagonal and black below it
+func diagonalImage(size int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if x > y {
+				setPixel(img, x, y, white)
+			} else {
+				setPixel(img, x, y, black)
+			}
+		}
+	}
+	return img
+}
+
+func TestScalersKeepFlatAreas(t *testing.T) {
+	src := diagonalImage(8)
+	for _, name := range ScalerNames[1:] {
+		s, err := NewScaler(name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		dst := ScaledImage(s, src.Rect)
+		s.Scale(dst, src)
+
+		f := s.Factor()
+		if dst.Rect.Dx() != 8*f || dst.Rect.Dy() != 8*f {
+			t.Fatalf("%s: unexpected size %v", name, dst.Rect)
+		}
+		// Far from the edge the colours are untouched
+		if got := pixelAt(dst, 7*f, 0); got != white {
+			t.Errorf("%s: expected white top-right, got %v", name, got)
+		}
+		if got := pixelAt(dst, 0, 7*f+f-1); got != black {
+			t.Errorf("%s: expected black bottom-left, got %v", name, got)
+		}
+	}
+}
+
+func TestScale2x(t *testing.T) {
+	src := diagonalImage(4)
+	dst := ScaledImage(scale2x{}, src.Rect)
+	scale2x{}.Scale(dst, src)
+
+	// The black pixel (1,1) on the diagonal gets a white top-right corner
+	if got := pixelAt(dst, 3, 2); got != white {
+		t.Errorf("expected white sub-pixel, got %v", got)
+	}
+	if got := pixelAt(dst, 2, 3); got != black {
+		t.Errorf("expected black sub-pixel, got %v", got)
+	}
+}
+
+func TestXBRZDiagonal(t *testing.T) {
+	src := diagonalImage(8)
+	s, _ := NewScaler("xbrz4x")
+	dst := ScaledImage(s, src.Rect)
+	s.Scale(dst, src)
+
+	// Pixel (3,3) is black with white neighbours above and right:
+	// its top-right corner is blended towards white
+	c := pixelAt(dst, 3*4+3, 3*4)
+	if c == black {
+		t.Errorf("expected a blended corner, got black")
+	}
+}
+
+// A lone pixel has every neighbour different: hq2x keeps it with
+// 1/16 of the surroundings in each corner (rule 14:1:1)
+func TestHQ2xLonePixel(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 3, 3))
+	for i := 0; i < 9; i++ {
+		setPixel(src, i%3, i/3, white)
+	}
+	setPixel(src, 1, 1, black)
+
+	for _, name := range []string{"hq2x", "hq4x"} {
+		s, _ := NewScaler(name)
+		dst := ScaledImage(s, src.Rect)
+		s.Scale(dst, src)
+
+		f := s.Factor()
+		want := color.RGBA{31, 31, 31, 255} // (14*0 + 255 + 255) / 16
+		if got := pixelAt(dst, f, f); got != want {
+			t.Errorf("%s: expected %v in the outer corner, got %v", name, want, got)
+		}
+	}
+	// The inner sub-pixels of hq4x get half of it
+	s, _ := NewScaler("hq4x")
+	dst := ScaledImage(s, src.Rect)
+	s.Scale(dst, src)
+	if got := pixelAt(dst, 5, 5); got != (color.RGBA{15, 15, 15, 255}) {
+		t.Errorf("hq4x: unexpected inner sub-pixel %v", got)
+	}
+}
+
+// hqxRules is the rule list of the top-left corner: the same pattern
+// mirrored along the diagonal must use the mirrored rule
+func TestHQXRulesSymmetry(t *testing.T) {
+	// Bits of A, B, C, D, F, G, H, I after swapping B-D, C-G and F-H
+	mirrorBit := [8]int{0, 3, 5, 1, 6, 2, 4, 7}
+	mirrorRule := map[byte]byte{2: 3, 3: 2, 5: 6, 6: 5, 18: 19, 19: 18}
+	for p := 0; p < 256; p++ {
+		var m int
+		for bit := 0; bit < 8; bit++ {
+			if p&(1<<bit) != 0 {
+				m |= 1 << mirrorBit[bit]
+			}
+		}
+		rule, mirrored := hqxRules[p], hqxRules[m]
+		if want, ok := mirrorRule[rule]; ok {
+			rule = want
+		}
+		if rule != mirrored {
+			t.Errorf("pattern $%02X has rule %d, its mirror $%02X has %d", p, hqxRules[p], m, mirrored)
+		}
+	}
+}
+
+func TestNewScalerErrors(t *testing.T) {
+	for _, name := range []string{"scale4x", "hq5x", "xbrz7x", "edge2x", "smooth3x", "fancy2x", "nearest"} {
+		if _, err := NewScaler(name); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if s, err := NewScaler("none"); s != nil || err != nil {
+		t.Errorf("none: expected no scaler, got %v, %v", s, err)
+	}
+}
+
+func TestScanlines(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 2; x++ {
+			setPixel(img, x, y, white)
+		}
+	}
+	Scanlines(img, 2, 1)
+
+	for y := 0; y < 4; y++ {
+		want := white
+		if y%2 == 1 {
+			want = black
+		}
+		if got := pixelAt(img, 0, y); got != want {
+			t.Errorf("row %d: expected %v, got %v", y, want, got)
+		}
+	}
+}
+
+func TestOverscanCrop(t *testing.T) {
+	o := Overscan{Top: 8, Bottom: 8, Left: 4}
+	if w, h := o.Size(); w != 252 || h != 224 {
+		t.Errorf("unexpected size %dx%d", w, h)
+	}
+	if got := o.Crop(image.Rect(0, 0, 512, 480)); got != image.Rect(8, 16, 512, 464) {
+		t.Errorf("unexpected crop %v", got)
+	}
+	if got := o.Crop(image.Rect(0, 0, NTSCWidth, 480)); got != image.Rect(9, 16, NTSCWidth, 464) {
+		t.Errorf("unexpected NTSC crop %v", got)
+	}
+}
+
+func TestParseOverscan(t *testing.T) {
+	if o, err := ParseOverscan("8,8,0,0"); err != nil || o != Overscan(config.Default().Video.Overscan) {
+		t.Errorf("got %+v, %v", o, err)
+	}
+	if o, err := ParseOverscan("4"); err != nil || o != (Overscan{4, 4, 4, 4}) {
+		t.Errorf("got %+v, %v", o, err)
+	}
+	for _, s := range []string{"", "8,8", "-1,0,0,0", "120,120,0,0"} {
+		if _, err := ParseOverscan(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestFitViewport(t *testing.T) {
+	// 3.5x does not fit exactly: integer scaling rounds down and letterboxes
+	vp := FitViewport(256, 224, 900, 784, 1, true)
+	if vp != (Viewport{X: 66, Y: 56, Width: 768, Height: 672}) {
+		t.Errorf("unexpected integer viewport %+v", vp)
+	}
+	vp = FitViewport(256, 224, 900, 784, 1, false)
+	if vp.Height != 784 || vp.Width != 896 || vp.X != 2 {
+		t.Errorf("unexpected viewport %+v", vp)
+	}
+	// 8:7 pixels are wider than high
+	vp = FitViewport(256, 224, 1280, 448, NTSCPixelAspect, true)
+	if vp.Height != 448 || math.Abs(vp.Width-512*8.0/7) > 1e-9 {
+		t.Errorf("unexpected 8:7 viewport %+v", vp)
+	}
+}
+
+func TestY4MWriterCrop(t *testing.T) {
+	img := diagonalImage(4)
+	var buf bytes.Buffer
+	w, err := NewY4MWriter(&buf, 2, 1, 60.0988)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFrame(img.SubImage(image.Rect(2, 1, 4, 2)).(*image.RGBA)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	header := "YUV4MPEG2 W2 H1 F60099:1000 Ip A1:1 C444\nFRAME\n"
+	if !strings.HasPrefix(buf.String(), header) {
+		t.Fatalf("unexpected header %q", buf.String())
+	}
+	// Both pixels are white: full luma, neutral chroma
+	want := []byte{235, 235, 128, 128, 128, 128}
+	if got := buf.Bytes()[len(header):]; !bytes.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
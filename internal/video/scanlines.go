@@ -0,0 +1,21 @@
+package video
+
+import "image"
+
+// Scanlines darkens the last row of every source line of an image scaled
+// by factor, like the gaps between the beam lines of a CRT.
+// intensity 0 leaves the image unchanged, 1 makes the gaps black.
+func Scanlines(img *image.RGBA, factor int, intensity float64) {
+	if factor < 2 || intensity <= 0 {
+		return
+	}
+	keep := int((1 - min(intensity, 1)) * 256)
+	for y := factor - 1; y < img.Rect.Dy(); y += factor {
+		row := img.Pix[y*img.Stride : y*img.Stride+img.Rect.Dx()*4]
+		for i := 0; i < len(row); i += 4 {
+			row[i] = byte(int(row[i]) * keep >> 8)
+			row[i+1] = byte(int(row[i+1]) * keep >> 8)
+			row[i+2] = byte(int(row[i+2]) * keep >> 8)
+		}
+	}
+}
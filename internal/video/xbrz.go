@@ -0,0 +1,346 @@
+package video
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// xbrz is Zenju's xBRZ. Every 2x2 block of pixels looks at the colour
+// distances in the 4x4 kernel around it to decide which of its inner corners
+// lie on an edge. The enlarged pixel is filled with its colour, then each
+// corner on an edge is blended with the most similar neighbour along a
+// diagonal, shallow or steep line, or rounded off, by the tables of xBRZ
+// for the scale factor.
+// https://sourceforge.net/projects/xbrz/
+
+const (
+	xbrzEqualColorTolerance = 30
+	xbrzDominantDirection   = 3.6
+	xbrzSteepDirection      = 2.2
+)
+
+// Blend types of a pixel corner
+const (
+	blendNone = iota
+	blendNormal
+	blendDominant
+)
+
+// Pixel corners, in the order a clockwise kernel rotation visits them
+const (
+	cornerBottomRight = iota
+	cornerTopRight
+	cornerTopLeft
+	cornerBottomLeft
+)
+
+// xbrzAlpha blends num/den of the line colour into the sub-pixel at row, col
+// of the bottom-right corner of the block
+type xbrzAlpha struct{ row, col, num, den int }
+
+// xbrzBlends are the blends of a scale factor. Steep lines are the shallow
+// ones mirrored along the diagonal.
+type xbrzBlends struct {
+	shallow, steepAndShallow, diagonal, corner []xbrzAlpha
+}
+
+var xbrzScalers = map[int]xbrzBlends{
+	2: {
+		shallow:         []xbrzAlpha{{1, 0, 1, 4}, {1, 1, 3, 4}},
+		steepAndShallow: []xbrzAlpha{{1, 0, 1, 4}, {0, 1, 1, 4}, {1, 1, 5, 6}},
+		diagonal:        []xbrzAlpha{{1, 1, 1, 2}},
+		corner:          []xbrzAlpha{{1, 1, 21, 100}}, // 1 - pi/4
+	},
+	3: {
+		shallow: []xbrzAlpha{
+			{2, 0, 1, 4}, {1, 2, 1, 4},
+			{2, 1, 3, 4}, {2, 2, 1, 1},
+		},
+		steepAndShallow: []xbrzAlpha{
+			{2, 0, 1, 4}, {0, 2, 1, 4},
+			{2, 1, 3, 4}, {1, 2, 3, 4},
+			{2, 2, 1, 1},
+		},
+		diagonal: []xbrzAlpha{{1, 2, 1, 8}, {2, 1, 1, 8}, {2, 2, 7, 8}},
+		corner:   []xbrzAlpha{{2, 2, 45, 100}},
+	},
+	4: {
+		shallow: []xbrzAlpha{
+			{3, 0, 1, 4}, {2, 2, 1, 4},
+			{3, 1, 3, 4}, {2, 3, 3, 4},
+			{3, 2, 1, 1}, {3, 3, 1, 1},
+		},
+		steepAndShallow: []xbrzAlpha{
+			{3, 1, 3, 4}, {1, 3, 3, 4},
+			{3, 0, 1, 4}, {0, 3, 1, 4},
+			{2, 2, 1, 3},
+			{3, 3, 1, 1}, {3, 2, 1, 1}, {2, 3, 1, 1},
+		},
+		diagonal: []xbrzAlpha{{3, 2, 1, 2}, {2, 3, 1, 2}, {3, 3, 1, 1}},
+		corner:   []xbrzAlpha{{3, 3, 68, 100}, {3, 2, 9, 100}, {2, 3, 9, 100}},
+	},
+	5: {
+		shallow: []xbrzAlpha{
+			{4, 0, 1, 4}, {3, 2, 1, 4}, {2, 4, 1, 4},
+			{4, 1, 3, 4}, {3, 3, 3, 4},
+			{4, 2, 1, 1}, {4, 3, 1, 1}, {4, 4, 1, 1}, {3, 4, 1, 1},
+		},
+		steepAndShallow: []xbrzAlpha{
+			{0, 4, 1, 4}, {2, 3, 1, 4}, {1, 4, 3, 4},
+			{4, 0, 1, 4}, {3, 2, 1, 4}, {4, 1, 3, 4},
+			{3, 3, 2, 3},
+			{2, 4, 1, 1}, {3, 4, 1, 1}, {4, 4, 1, 1},
+			{4, 2, 1, 1}, {4, 3, 1, 1},
+		},
+		diagonal: []xbrzAlpha{
+			{4, 2, 1, 8}, {3, 3, 1, 8}, {2, 4, 1, 8},
+			{4, 3, 7, 8}, {3, 4, 7, 8},
+			{4, 4, 1, 1},
+		},
+		corner: []xbrzAlpha{{4, 4, 86, 100}, {4, 3, 23, 100}, {3, 4, 23, 100}},
+	},
+	6: {
+		shallow: []xbrzAlpha{
+			{5, 0, 1, 4}, {4, 2, 1, 4}, {3, 4, 1, 4},
+			{5, 1, 3, 4}, {4, 3, 3, 4}, {3, 5, 3, 4},
+			{5, 2, 1, 1}, {5, 3, 1, 1}, {5, 4, 1, 1}, {5, 5, 1, 1},
+			{4, 4, 1, 1}, {4, 5, 1, 1},
+		},
+		steepAndShallow: []xbrzAlpha{
+			{0, 5, 1, 4}, {2, 4, 1, 4}, {1, 5, 3, 4}, {3, 4, 3, 4},
+			{5, 0, 1, 4}, {4, 2, 1, 4}, {5, 1, 3, 4}, {4, 3, 3, 4},
+			{2, 5, 1, 1}, {3, 5, 1, 1}, {4, 5, 1, 1}, {5, 5, 1, 1},
+			{4, 4, 1, 1}, {5, 4, 1, 1},
+			{5, 2, 1, 1}, {5, 3, 1, 1},
+		},
+		diagonal: []xbrzAlpha{
+			{5, 3, 1, 2}, {4, 4, 1, 2}, {3, 5, 1, 2},
+			{4, 5, 1, 1}, {5, 5, 1, 1}, {5, 4, 1, 1},
+		},
+		corner: []xbrzAlpha{
+			{5, 5, 97, 100}, {4, 5, 42, 100}, {5, 4, 42, 100},
+			{5, 3, 6, 100}, {3, 5, 6, 100},
+		},
+	},
+}
+
+type xbrz struct {
+	factor int
+	scaler xbrzBlends
+
+	// Per-frame buffers
+	ycc    [][3]float64
+	blends [][4]uint8
+}
+
+func newXBRZ(factor int) *xbrz {
+	return &xbrz{factor: factor, scaler: xbrzScalers[factor]}
+}
+
+func (s *xbrz) Factor() int { return s.factor }
+
+// toYCbCr converts to the colour space used for distances (BT.2020 weights)
+func toYCbCr(c color.RGBA) [3]float64 {
+	const kb, kr = 0.0593, 0.2627
+	const kg = 1 - kb - kr
+	r, g, b := float64(c.R), float64(c.G), float64(c.B)
+	y := kr*r + kg*g + kb*b
+	return [3]float64{y, 0.5 / (1 - kb) * (b - y), 0.5 / (1 - kr) * (r - y)}
+}
+
+func (s *xbrz) Scale(dst, src *image.RGBA) {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	if len(s.ycc) != w*h {
+		s.ycc = make([][3]float64, w*h)
+		s.blends = make([][4]uint8, w*h)
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			s.ycc[y*w+x] = toYCbCr(pixelAt(src, x, y))
+			s.blends[y*w+x] = [4]uint8{}
+		}
+	}
+
+	// Every 2x2 block decides the blending of its four inner corners
+	for y := -1; y < h; y++ {
+		for x := -1; x < w; x++ {
+			s.preprocess(src, x, y)
+		}
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			s.scalePixel(dst, src, x, y)
+		}
+	}
+}
+
+// dist returns the colour distance between the pixels at (x1, y1) and (x2, y2)
+func (s *xbrz) dist(src *image.RGBA, x1, y1, x2, y2 int) float64 {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	a := s.ycc[max(0, min(y1, h-1))*w+max(0, min(x1, w-1))]
+	b := s.ycc[max(0, min(y2, h-1))*w+max(0, min(x2, w-1))]
+	dy, dcb, dcr := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return math.Sqrt(dy*dy + dcb*dcb + dcr*dcr)
+}
+
+// preprocess handles the 2x2 block with its top-left pixel at (x, y):
+//
+//	a b c d
+//	e f g h
+//	i j k l
+//	m n o p
+func (s *xbrz) preprocess(src *image.RGBA, x, y int) {
+	f := pixelClamped(src, x, y)
+	g := pixelClamped(src, x+1, y)
+	j := pixelClamped(src, x, y+1)
+	k := pixelClamped(src, x+1, y+1)
+	if (f == g && j == k) || (f == j && g == k) {
+		return
+	}
+
+	d := func(x1, y1, x2, y2 int) float64 { return s.dist(src, x+x1, y+y1, x+x2, y+y2) }
+
+	// Weighted distances across the two diagonals
+	jg := d(-1, 1, 0, 0) + d(0, 0, 1, -1) + d(0, 2, 1, 1) + d(1, 1, 2, 0) + 4*d(0, 1, 1, 0)
+	fk := d(-1, 0, 0, 1) + d(0, 1, 1, 2) + d(0, -1, 1, 0) + d(1, 0, 2, 1) + 4*d(0, 0, 1, 1)
+
+	set := func(px, py, corner int, blend uint8) {
+		w, h := src.Rect.Dx(), src.Rect.Dy()
+		if px >= 0 && px < w && py >= 0 && py < h {
+			s.blends[py*w+px][corner] = blend
+		}
+	}
+	blendType := func(dominant bool) uint8 {
+		if dominant {
+			return blendDominant
+		}
+		return blendNormal
+	}
+
+	switch {
+	case jg < fk:
+		// Edge along j-g: round off the corners of f and k
+		blend := blendType(xbrzDominantDirection*jg < fk)
+		if f != g && f != j {
+			set(x, y, cornerBottomRight, blend)
+		}
+		if k != j && k != g {
+			set(x+1, y+1, cornerTopLeft, blend)
+		}
+	case fk < jg:
+		// Edge along f-k: round off the corners of j and g
+		blend := blendType(xbrzDominantDirection*fk < jg)
+		if j != f && j != k {
+			set(x, y+1, cornerTopRight, blend)
+		}
+		if g != f && g != k {
+			set(x+1, y, cornerBottomLeft, blend)
+		}
+	}
+}
+
+// scalePixel fills the block of the pixel at (x, y) and blends its corners.
+// Each corner is handled as the bottom-right one of a rotated kernel.
+func (s *xbrz) scalePixel(dst, src *image.RGBA, x, y int) {
+	n := s.factor
+	e := pixelAt(src, x, y)
+	for j := 0; j < n; j++ {
+		for i := 0; i < n; i++ {
+			setPixel(dst, x*n+i, y*n+j, e)
+		}
+	}
+
+	blends := s.blends[y*src.Rect.Dx()+x]
+	for rot := 0; rot < 4; rot++ {
+		blend := blends[rot]
+		if blend == blendNone {
+			continue
+		}
+
+		// Offsets in the rotated kernel map back to the image by turning them
+		// counter-clockwise rot times
+		actual := func(dx, dy int) (int, int) {
+			for r := 0; r < rot; r++ {
+				dx, dy = dy, -dx
+			}
+			return dx, dy
+		}
+		at := func(dx, dy int) color.RGBA {
+			ax, ay := actual(dx, dy)
+			return pixelClamped(src, x+ax, y+ay)
+		}
+		dist := func(dx1, dy1, dx2, dy2 int) float64 {
+			ax1, ay1 := actual(dx1, dy1)
+			ax2, ay2 := actual(dx2, dy2)
+			return s.dist(src, x+ax1, y+ay1, x+ax2, y+ay2)
+		}
+		eq := func(dx1, dy1, dx2, dy2 int) bool {
+			return dist(dx1, dy1, dx2, dy2) < xbrzEqualColorTolerance
+		}
+
+		// a b c
+		// d e f
+		// g h i
+		b, c, d := at(0, -1), at(1, -1), at(-1, 0)
+		f, g, h := at(1, 0), at(-1, 1), at(0, 1)
+
+		lineBlending := true
+		switch {
+		case blend >= blendDominant:
+		case blends[(rot+cornerTopRight)%4] != blendNone && !eq(0, 0, -1, 1):
+			lineBlending = false
+		case blends[(rot+cornerBottomLeft)%4] != blendNone && !eq(0, 0, 1, -1):
+			lineBlending = false
+		case !eq(0, 0, 1, 1) && eq(-1, 1, 0, 1) && eq(0, 1, 1, 1) && eq(1, 1, 1, 0) && eq(1, 0, 1, -1):
+			// Only round off the corner of an L shape, like the eyes of Mario's mushroom
+			lineBlending = false
+		}
+
+		px := h
+		if dist(0, 0, 1, 0) <= dist(0, 0, 0, 1) {
+			px = f
+		}
+
+		alphas := s.scaler.corner
+		transpose := false
+		if lineBlending {
+			fg := dist(1, 0, -1, 1)
+			hc := dist(0, 1, 1, -1)
+			shallow := xbrzSteepDirection*fg <= hc && e != g && d != g
+			steep := xbrzSteepDirection*hc <= fg && e != c && b != c
+			switch {
+			case shallow && steep:
+				alphas = s.scaler.steepAndShallow
+			case shallow:
+				alphas = s.scaler.shallow
+			case steep:
+				alphas, transpose = s.scaler.shallow, true
+			default:
+				alphas = s.scaler.diagonal
+			}
+		}
+
+		for _, a := range alphas {
+			i, j := a.col, a.row
+			if transpose {
+				i, j = j, i
+			}
+			// Sub-pixel (i, j) of the rotated block
+			for r := 0; r < rot; r++ {
+				i, j = j, n-1-i
+			}
+			ox, oy := x*n+i, y*n+j
+			setPixel(dst, ox, oy, alphaBlend(pixelAt(dst, ox, oy), px, a.num, a.den))
+		}
+	}
+}
+
+// alphaBlend mixes num/den of front into back, truncating like xBRZ
+func alphaBlend(back, front color.RGBA, num, den int) color.RGBA {
+	ch := func(b, f uint8) uint8 {
+		return uint8((num*int(f) + (den-num)*int(b)) / den)
+	}
+	return color.RGBA{ch(back.R, front.R), ch(back.G, front.G), ch(back.B, front.B), ch(back.A, front.A)}
+}
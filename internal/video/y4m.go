@@ -0,0 +1,68 @@
+package video
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"math"
+)
+
+// Y4MWriter writes frames as an uncompressed YUV4MPEG2 stream, which
+// ffmpeg and most players read directly:
+//
+//	ffmpeg -i capture.y4m capture.mp4
+type Y4MWriter struct {
+	w      *bufio.Writer
+	width  int
+	height int
+	planes []byte
+}
+
+// NewY4MWriter writes the stream header for frames of the given size and rate
+func NewY4MWriter(w io.Writer, width, height int, fps float64) (*Y4MWriter, error) {
+	y := &Y4MWriter{
+		w:      bufio.NewWriter(w),
+		width:  width,
+		height: height,
+		planes: make([]byte, width*height*3),
+	}
+	// 4:4:4 keeps the colours of single pixels
+	rate := int(math.Round(fps * 1000))
+	if _, err := fmt.Fprintf(y.w, "YUV4MPEG2 W%d H%d F%d:1000 Ip A1:1 C444\n", width, height, rate); err != nil {
+		return nil, err
+	}
+	return y, nil
+}
+
+// WriteFrame converts img to BT.601 YCbCr and appends it to the stream.
+// img may be a sub-image, e.g. cropped by Overscan.Crop.
+func (y *Y4MWriter) WriteFrame(img *image.RGBA) error {
+	if img.Rect.Dx() != y.width || img.Rect.Dy() != y.height {
+		return fmt.Errorf("frame size %dx%d does not match the stream size %dx%d",
+			img.Rect.Dx(), img.Rect.Dy(), y.width, y.height)
+	}
+	size := y.width * y.height
+	luma, cb, cr := y.planes[:size], y.planes[size:2*size], y.planes[2*size:]
+	for row := 0; row < y.height; row++ {
+		for x := 0; x < y.width; x++ {
+			i := img.PixOffset(img.Rect.Min.X+x, img.Rect.Min.Y+row)
+			r, g, b := int(img.Pix[i]), int(img.Pix[i+1]), int(img.Pix[i+2])
+			n := row*y.width + x
+			// Studio range, as players expect
+			luma[n] = byte((66*r+129*g+25*b+128)>>8 + 16)
+			cb[n] = byte((-38*r-74*g+112*b+128)>>8 + 128)
+			cr[n] = byte((112*r-94*g-18*b+128)>>8 + 128)
+		}
+	}
+	if _, err := y.w.WriteString("FRAME\n"); err != nil {
+		return err
+	}
+	_, err := y.w.Write(y.planes)
+	return err
+}
+
+// Flush writes any buffered frames
+func (y *Y4MWriter) Flush() error {
+	return y.w.Flush()
+}